@@ -17,7 +17,11 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"kubevault.dev/cli/pkg/cmds"
 
@@ -29,7 +33,16 @@ func main() {
 	logs.InitLogs()
 	defer logs.FlushLogs()
 
-	if err := cmds.NewRootCmd().Execute(); err != nil {
+	// on interrupt the context is cancelled, so that the running command stops
+	// and cleans up its key store, a second interrupt terminates immediately
+	// unless the command holds the interrupts itself until its clean up is done.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if err := cmds.NewRootCmd().ExecuteContext(ctx); err != nil {
 		fmt.Println(err)
 	}
 }
@@ -21,6 +21,8 @@ import (
 	"os"
 	"strings"
 
+	opsapi "kubevault.dev/apimachinery/apis/ops/v1alpha1"
+
 	"github.com/spf13/cobra"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
@@ -43,10 +45,39 @@ var secretAccessApprovedCond = kmapi.Condition{
 	Message: "This was approved by: kubectl vault approve secretaccessrequest",
 }
 
+var vaultOpsApprovedCond = kmapi.Condition{
+	Type:    opsapi.AccessApproved,
+	Status:  metav1.ConditionTrue,
+	Reason:  "KubectlApprove",
+	Message: "This was approved by: kubectl vault approve vaultopsrequest",
+}
+
 func NewCmdApprove(clientGetter genericclioptions.RESTClientGetter) *cobra.Command {
+	o := newDecisionOptions()
 	cmd := &cobra.Command{
-		Use:               "approve",
-		Short:             "Approve request",
+		Use:   "approve",
+		Short: "Approve request",
+		Long: `
+$ kubectl vault approve secretaccessrequest <name> -n <namespace>
+$ kubectl vault approve vaultopsrequest <name> -n <namespace>
+
+A vaultopsrequest gets the Approved condition and phase. It is refused unless the request
+is pending or waiting for approval, and if it is already approved or denied.
+
+The user of the current kubeconfig, the time and the --reason are recorded in the condition
+message and in an event on the request. The user is looked up with a selfsubjectreview, if that
+fails the user name of the kubeconfig is recorded with the prefix unverified:.
+
+Examples:
+ # approve the secretaccessrequest
+ $ kubectl vault approve secretaccessrequest my-request -n demo
+
+ # approve the vaultopsrequest waiting for approval
+ $ kubectl vault approve vaultopsrequest vault-restart -n demo
+
+ # approve the secretaccessrequest with the reason for the audit trail
+ $ kubectl vault approve secretaccessrequest my-request -n demo --reason="incident 4711"
+`,
 		DisableAutoGenTag: true,
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) > 0 {
@@ -54,15 +85,16 @@ func NewCmdApprove(clientGetter genericclioptions.RESTClientGetter) *cobra.Comma
 				ObjectNames = args[1:]
 			}
 
-			if err := modifyStatusCondition(clientGetter, secretAccessApprovedCond); err != nil {
+			if err := modifyStatusCondition(cmd.Context(), clientGetter, secretAccessApprovedCond, o); err != nil {
 				Fatal(err)
 			} else {
-				fmt.Printf("secretaccessrequests %s approved\n", strings.Join(ObjectNames, ", "))
+				fmt.Printf("%s %s approved\n", requestResourceName(), strings.Join(ObjectNames, ", "))
 			}
 			os.Exit(0)
 		},
 	}
 
 	cmdutil.AddFilenameOptionFlags(cmd, &FilenameOptions, "identifying the resource to update")
+	o.addDecisionFlags(cmd.Flags())
 	return cmd
 }
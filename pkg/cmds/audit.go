@@ -0,0 +1,186 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authenticationv1beta1 "k8s.io/api/authentication/v1beta1"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+// The annotations of the decision events, so that auditors don't need to parse the message.
+const (
+	decidedByAnnotation      = "kubevault.com/decided-by"
+	decisionReasonAnnotation = "kubevault.com/decision-reason"
+)
+
+// unverifiedUserPrefix marks a user that is taken from the kubeconfig, as it is not verified by the cluster.
+const unverifiedUserPrefix = "unverified:"
+
+// decisionEventComponent is the source of the decision events.
+const decisionEventComponent = "kubectl-vault"
+
+type decisionOptions struct {
+	reason string
+}
+
+// decision records who approved, denied or revoked a request, when and why.
+type decision struct {
+	user   string
+	at     time.Time
+	reason string
+}
+
+func newDecisionOptions() *decisionOptions {
+	return &decisionOptions{}
+}
+
+func (o *decisionOptions) addDecisionFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.reason, "reason", o.reason, "reason for the decision, recorded in the request condition and event")
+}
+
+// newDecision looks up the user of the current kubeconfig with a SelfSubjectReview.
+// Clusters before Kubernetes 1.28 only serve the v1beta1 SelfSubjectReview. If the review
+// fails, e.g. it is forbidden or not served, the user is taken from the kubeconfig and recorded
+// with the prefix unverified: in the condition message and the event.
+func newDecision(ctx context.Context, clientGetter genericclioptions.RESTClientGetter, kubeClient kubernetes.Interface, reason string) (*decision, error) {
+	user, err := reviewUser(ctx, kubeClient)
+	if err != nil {
+		user, err = kubeconfigUser(clientGetter, err)
+		if err != nil {
+			return nil, err
+		}
+		// the cluster doesn't verify the kubeconfig user, so it is recorded as unverified
+		user = unverifiedUserPrefix + user
+	}
+
+	return &decision{
+		user:   user,
+		at:     time.Now().UTC(),
+		reason: reason,
+	}, nil
+}
+
+// reviewUser returns the username of the current user as authenticated by the cluster.
+func reviewUser(ctx context.Context, kubeClient kubernetes.Interface) (string, error) {
+	var user string
+	review, err := kubeClient.AuthenticationV1().SelfSubjectReviews().Create(ctx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{})
+	if err == nil {
+		user = review.Status.UserInfo.Username
+	} else if kerr.IsNotFound(err) {
+		var betaReview *authenticationv1beta1.SelfSubjectReview
+		betaReview, err = kubeClient.AuthenticationV1beta1().SelfSubjectReviews().Create(ctx, &authenticationv1beta1.SelfSubjectReview{}, metav1.CreateOptions{})
+		if err == nil {
+			user = betaReview.Status.UserInfo.Username
+		}
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "failed to look up the current user with a selfsubjectreview")
+	}
+	if len(user) == 0 {
+		return "", errors.New("the selfsubjectreview returned no username for the current user")
+	}
+	return user, nil
+}
+
+// kubeconfigUser returns the username of the kubeconfig, or the user name of its current context.
+// The user is not verified by the cluster, so a warning with the review error is printed.
+func kubeconfigUser(clientGetter genericclioptions.RESTClientGetter, reviewErr error) (string, error) {
+	cfg, err := clientGetter.ToRESTConfig()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read kubeconfig")
+	}
+
+	user := cfg.Username
+	if len(user) == 0 {
+		raw, err := clientGetter.ToRawKubeConfigLoader().RawConfig()
+		if err != nil {
+			return "", errors.Wrap(err, "failed to read kubeconfig")
+		}
+		if kubeContext, ok := raw.Contexts[raw.CurrentContext]; ok {
+			user = kubeContext.AuthInfo
+		}
+	}
+	if len(user) == 0 {
+		return "", errors.Wrap(reviewErr, "no user found in the kubeconfig")
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "warning: %v, the decision is recorded for the unverified user %s of the kubeconfig\n", reviewErr, user)
+	return user, nil
+}
+
+// message appends the user, time and reason of the decision to the condition message.
+func (d *decision) message(msg string) string {
+	msg = fmt.Sprintf("%s, user: %s, time: %s", msg, d.user, d.at.Format(time.RFC3339))
+	if len(d.reason) > 0 {
+		msg = fmt.Sprintf("%s, reason: %s", msg, d.reason)
+	}
+	return msg
+}
+
+// recordEvent emits an event for the decision on the request. The decision is already stored
+// in the request condition, so a failure is only reported as a warning.
+func (d *decision) recordEvent(ctx context.Context, kubeClient kubernetes.Interface, gvk schema.GroupVersionKind, obj metav1.ObjectMeta, cond kmapi.Condition) {
+	annotations := map[string]string{
+		decidedByAnnotation: d.user,
+	}
+	if len(d.reason) > 0 {
+		annotations[decisionReasonAnnotation] = d.reason
+	}
+
+	now := metav1.NewTime(d.at)
+	event := &core.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%s.%x", obj.Name, d.at.UnixNano()),
+			Namespace:   obj.Namespace,
+			Annotations: annotations,
+		},
+		InvolvedObject: core.ObjectReference{
+			APIVersion:      gvk.GroupVersion().String(),
+			Kind:            gvk.Kind,
+			Namespace:       obj.Namespace,
+			Name:            obj.Name,
+			UID:             obj.UID,
+			ResourceVersion: obj.ResourceVersion,
+		},
+		Reason:              cond.Reason,
+		Message:             cond.Message,
+		Type:                core.EventTypeNormal,
+		Source:              core.EventSource{Component: decisionEventComponent},
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+		ReportingController: decisionEventComponent,
+	}
+
+	if _, err := kubeClient.CoreV1().Events(obj.Namespace).Create(ctx, event, metav1.CreateOptions{}); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "warning: failed to record event for %s %s/%s: %v\n", gvk.Kind, obj.Namespace, obj.Name, err)
+	}
+}
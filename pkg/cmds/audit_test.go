@@ -0,0 +1,201 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authenticationv1beta1 "k8s.io/api/authentication/v1beta1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestDecisionMessage(t *testing.T) {
+	at := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		reason string
+		want   string
+	}{
+		{
+			name: "no reason",
+			want: "approved, user: alice, time: 2024-05-01T10:30:00Z",
+		},
+		{
+			name:   "reason",
+			reason: "planned maintenance",
+			want:   "approved, user: alice, time: 2024-05-01T10:30:00Z, reason: planned maintenance",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &decision{user: "alice", at: at, reason: tt.reason}
+			if got := d.message("approved"); got != tt.want {
+				t.Errorf("message() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeSelfSubjectReview serves the v1 and v1beta1 selfsubjectreviews, a zero status
+// responds with a 404 as if the api version is not served.
+func fakeSelfSubjectReview(t *testing.T, v1Status, v1beta1Status int, user string) kubernetes.Interface {
+	t.Helper()
+
+	respond := func(w http.ResponseWriter, status int, review any) {
+		if status == 0 {
+			http.NotFound(w, nil)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if status == http.StatusCreated {
+			_ = json.NewEncoder(w).Encode(review)
+		}
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/apis/authentication.k8s.io/v1/selfsubjectreviews":
+			review := &authenticationv1.SelfSubjectReview{}
+			review.Status.UserInfo.Username = user
+			respond(w, v1Status, review)
+		case "/apis/authentication.k8s.io/v1beta1/selfsubjectreviews":
+			review := &authenticationv1beta1.SelfSubjectReview{}
+			review.Status.UserInfo.Username = user
+			respond(w, v1beta1Status, review)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	kubeClient, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kubeClient
+}
+
+func TestReviewUser(t *testing.T) {
+	tests := []struct {
+		name          string
+		v1Status      int
+		v1beta1Status int
+		user          string
+		want          string
+		wantErr       bool
+	}{
+		{name: "v1", v1Status: http.StatusCreated, user: "alice", want: "alice"},
+		{name: "v1beta1", v1beta1Status: http.StatusCreated, user: "alice", want: "alice"},
+		{name: "not served", wantErr: true},
+		{name: "forbidden", v1Status: http.StatusForbidden, v1beta1Status: http.StatusCreated, user: "alice", wantErr: true},
+		{name: "no username", v1Status: http.StatusCreated, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubeClient := fakeSelfSubjectReview(t, tt.v1Status, tt.v1beta1Status, tt.user)
+			got, err := reviewUser(context.Background(), kubeClient)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reviewUser() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("reviewUser() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKubeconfigUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		authInfo *clientcmdapi.AuthInfo
+		want     string
+		wantErr  bool
+	}{
+		{name: "username", authInfo: &clientcmdapi.AuthInfo{Username: "alice", Password: "secret"}, want: "alice"},
+		{name: "context user", authInfo: &clientcmdapi.AuthInfo{Token: "token"}, want: "admin"},
+		{name: "no user", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := clientcmdapi.NewConfig()
+			cfg.Clusters["kind"] = &clientcmdapi.Cluster{Server: "https://127.0.0.1:6443"}
+			cfg.Contexts["kind"] = &clientcmdapi.Context{Cluster: "kind"}
+			if tt.authInfo != nil {
+				cfg.AuthInfos["admin"] = tt.authInfo
+				cfg.Contexts["kind"].AuthInfo = "admin"
+			}
+			cfg.CurrentContext = "kind"
+			clientGetter := genericclioptions.NewTestConfigFlags().
+				WithClientConfig(clientcmd.NewDefaultClientConfig(*cfg, &clientcmd.ConfigOverrides{}))
+
+			got, err := kubeconfigUser(clientGetter, errors.New("selfsubjectreview forbidden"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("kubeconfigUser() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("kubeconfigUser() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewDecision(t *testing.T) {
+	cfg := clientcmdapi.NewConfig()
+	cfg.Clusters["kind"] = &clientcmdapi.Cluster{Server: "https://127.0.0.1:6443"}
+	cfg.AuthInfos["kind-kind"] = &clientcmdapi.AuthInfo{Token: "token"}
+	cfg.Contexts["kind"] = &clientcmdapi.Context{Cluster: "kind", AuthInfo: "kind-kind"}
+	cfg.CurrentContext = "kind"
+	clientGetter := genericclioptions.NewTestConfigFlags().
+		WithClientConfig(clientcmd.NewDefaultClientConfig(*cfg, &clientcmd.ConfigOverrides{}))
+
+	tests := []struct {
+		name     string
+		v1Status int
+		want     string
+	}{
+		{name: "verified user", v1Status: http.StatusCreated, want: "alice"},
+		{name: "unverified user", v1Status: http.StatusForbidden, want: "unverified:kind-kind"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubeClient := fakeSelfSubjectReview(t, tt.v1Status, 0, "alice")
+			d, err := newDecision(context.Background(), clientGetter, kubeClient, "maintenance")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.user != tt.want {
+				t.Errorf("newDecision() user = %q, want %q", d.user, tt.want)
+			}
+			if want := "user: " + tt.want + ","; !strings.Contains(d.message("approved"), want) {
+				t.Errorf("newDecision() message = %q, want it to contain %q", d.message("approved"), want)
+			}
+		})
+	}
+}
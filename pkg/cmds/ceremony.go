@@ -0,0 +1,232 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"golang.org/x/term"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The sources of the unseal-key shares.
+const (
+	keysFromStore  = "store"
+	keysFromPrompt = "prompt"
+	keysFromStdin  = "stdin"
+	keysFromFiles  = "files"
+)
+
+// errCeremonyIncomplete is returned when the custodians stop entering unseal-key shares
+// before the root-token generation completes. The generation is left in progress.
+var errCeremonyIncomplete = errors.New("root-token generation is left in progress")
+
+type keysFromOptions struct {
+	keysFrom         string
+	keyFiles         []string
+	otp              string
+	cancelInProgress bool
+}
+
+// keySource hands out unseal-key shares in order. The shares that are read once are kept,
+// so that the same shares can be submitted again to the next vault pod after a rewind.
+type keySource struct {
+	keys []string
+	pos  int
+	read func(prompt string) (string, error)
+}
+
+func newKeysFromOptions() *keysFromOptions {
+	return &keysFromOptions{
+		keysFrom: keysFromStore,
+	}
+}
+
+func (o *keysFromOptions) addKeysFromFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.keysFrom, "keys-from", o.keysFrom, "read the unseal-key shares from store/prompt/stdin/files. prompt reads the shares without echo, stdin reads one share per line")
+	fs.StringSliceVar(&o.keyFiles, "key-files", o.keyFiles, "files with one unseal-key share each, used with --keys-from=files")
+	fs.BoolVar(&o.cancelInProgress, "cancel-in-progress", o.cancelInProgress, "cancel an in-progress attempt and start over, it is resumed otherwise. ignored with --keys-from=store")
+}
+
+func (o *keysFromOptions) addGenerateRootFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.otp, "otp", o.otp, "otp printed by the session that started the in-progress root-token generation, required to resume it")
+}
+
+func (o *keysFromOptions) fromStore() bool {
+	return o.keysFrom == keysFromStore
+}
+
+// keySource returns the unseal-key shares from the store or the source given by --keys-from.
+// Shares from the store are limited to the threshold.
+func (o *keysFromOptions) keySource(ctx context.Context, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) (*keySource, error) {
+	switch o.keysFrom {
+	case keysFromStore:
+		keys, err := getKeys(ctx, vs, kubeClient)
+		if err != nil {
+			return nil, err
+		}
+		if threshold := vs.Spec.Unsealer.SecretThreshold; int64(len(keys)) > threshold {
+			keys = keys[:threshold]
+		}
+		return &keySource{keys: keys}, nil
+
+	case keysFromPrompt:
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return nil, errors.New("--keys-from=prompt requires a terminal, use --keys-from=stdin instead")
+		}
+		return &keySource{
+			read: func(prompt string) (string, error) {
+				_, _ = fmt.Fprint(os.Stderr, prompt)
+				key, err := term.ReadPassword(int(os.Stdin.Fd()))
+				_, _ = fmt.Fprintln(os.Stderr)
+				return string(key), err
+			},
+		}, nil
+
+	case keysFromStdin:
+		r := bufio.NewReader(os.Stdin)
+		return &keySource{
+			read: func(_ string) (string, error) {
+				line, err := r.ReadString('\n')
+				if err == io.EOF && len(line) > 0 {
+					err = nil
+				}
+				return line, err
+			},
+		}, nil
+
+	case keysFromFiles:
+		if len(o.keyFiles) == 0 {
+			return nil, errors.New("--keys-from=files requires --key-files")
+		}
+		var keys []string
+		for _, name := range o.keyFiles {
+			data, err := os.ReadFile(name)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, strings.TrimSpace(string(data)))
+		}
+		return &keySource{keys: keys}, nil
+	}
+
+	return nil, errors.Errorf("unknown --keys-from %s, use store, prompt, stdin or files", o.keysFrom)
+}
+
+// next returns the next unseal-key share, or io.EOF if there is none left.
+// An empty share entered by a custodian ends the session.
+func (s *keySource) next(ctx context.Context, prompt string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if s.pos < len(s.keys) {
+		s.pos++
+		return s.keys[s.pos-1], nil
+	}
+	if s.read == nil {
+		return "", io.EOF
+	}
+
+	key, err := s.read(prompt)
+	if err != nil {
+		return "", err
+	}
+	key = strings.TrimSpace(key)
+	if len(key) == 0 {
+		return "", io.EOF
+	}
+	s.keys = append(s.keys, key)
+	s.pos++
+	return key, nil
+}
+
+// rewind starts over with the first share.
+func (s *keySource) rewind() {
+	s.pos = 0
+}
+
+// generateRootCeremony generates a root-token with unseal-key shares entered by the custodians.
+// An in-progress generation is resumed with --otp unless --cancel-in-progress is set. If the custodians
+// stop before the generation completes, it is left in progress to be continued by another
+// session and errCeremonyIncomplete is returned.
+func (o *keysFromOptions) generateRootCeremony(ctx context.Context, client *api.Client, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) (string, error) {
+	src, err := o.keySource(ctx, vs, kubeClient)
+	if err != nil {
+		return "", err
+	}
+
+	status, err := client.Sys().GenerateRootStatusWithContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	otp := o.otp
+	if status.Started && o.cancelInProgress {
+		if err = client.Sys().GenerateRootCancelWithContext(ctx); err != nil {
+			return "", err
+		}
+		fmt.Println("cancelled the in-progress root-token generation")
+		status.Started = false
+	}
+
+	if status.Started {
+		// the encoded root-token can't be decoded without the otp, so no share is submitted without it
+		if len(otp) == 0 {
+			return "", errors.Errorf("a root-token generation with nonce %s is in progress, resume it with the --otp printed by the session that started it or use --cancel-in-progress", status.Nonce)
+		}
+		fmt.Printf("resuming root-token generation with nonce %s at progress %d/%d\n", status.Nonce, status.Progress, status.Required)
+	} else {
+		status, err = client.Sys().GenerateRootInitWithContext(ctx, "", "")
+		if err != nil {
+			return "", err
+		}
+		otp = status.OTP
+		fmt.Printf("started root-token generation with nonce %s\n", status.Nonce)
+		// the otp alone can't decode the root-token, it is printed for the custodians resuming the generation in another session
+		_, _ = fmt.Fprintf(os.Stderr, "otp: %s, pass it with --otp to resume the generation in another session\n", otp)
+	}
+
+	for !status.Complete {
+		key, err := src.next(ctx, fmt.Sprintf("Enter unseal-key share (progress %d/%d, empty to stop): ", status.Progress, status.Required))
+		if err == io.EOF {
+			return "", errors.Wrapf(errCeremonyIncomplete, "progress %d/%d with nonce %s, resume it with --keys-from", status.Progress, status.Required, status.Nonce)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		status, err = client.Sys().GenerateRootUpdateWithContext(ctx, key, status.Nonce)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to submit unseal-key share")
+		}
+		if !status.Complete {
+			fmt.Printf("root-token generation progress %d/%d\n", status.Progress, status.Required)
+		}
+	}
+
+	return decodeRootToken(status.EncodedToken, otp)
+}
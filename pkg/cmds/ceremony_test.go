@@ -0,0 +1,182 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// lineReader returns the lines in order and io.EOF after the last one.
+func lineReader(lines ...string) func(string) (string, error) {
+	return func(string) (string, error) {
+		if len(lines) == 0 {
+			return "", io.EOF
+		}
+		line := lines[0]
+		lines = lines[1:]
+		return line, nil
+	}
+}
+
+// drain returns the shares of the source until it fails.
+func drain(s *keySource) ([]string, error) {
+	var keys []string
+	for {
+		key, err := s.next(context.Background(), "")
+		if err != nil {
+			return keys, err
+		}
+		keys = append(keys, key)
+	}
+}
+
+func TestKeySource(t *testing.T) {
+	tests := []struct {
+		name      string
+		src       *keySource
+		want      []string
+		wantErr   error
+		wantAgain []string
+	}{
+		{
+			name:      "stored shares",
+			src:       &keySource{keys: []string{"k0", "k1"}},
+			want:      []string{"k0", "k1"},
+			wantErr:   io.EOF,
+			wantAgain: []string{"k0", "k1"},
+		},
+		{
+			name:      "entered shares are trimmed",
+			src:       &keySource{read: lineReader("k0\n", " k1 \n")},
+			want:      []string{"k0", "k1"},
+			wantErr:   io.EOF,
+			wantAgain: []string{"k0", "k1"},
+		},
+		{
+			name:      "empty share ends the session",
+			src:       &keySource{read: lineReader("k0\n", "\n", "k2\n")},
+			want:      []string{"k0"},
+			wantErr:   io.EOF,
+			wantAgain: []string{"k0", "k2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := drain(tt.src)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("next() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("next() = %v, want %v", got, tt.want)
+			}
+
+			// the shares read so far are handed out again after a rewind, before new ones are read
+			tt.src.rewind()
+			got, _ = drain(tt.src)
+			if !reflect.DeepEqual(got, tt.wantAgain) {
+				t.Errorf("next() after rewind = %v, want %v", got, tt.wantAgain)
+			}
+		})
+	}
+}
+
+func TestKeySourceCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	src := &keySource{keys: []string{"k0"}}
+	if _, err := src.next(ctx, ""); !errors.Is(err, context.Canceled) {
+		t.Errorf("next() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestKeySourceFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for i, key := range []string{"k0\n", "  k1"} {
+		file := filepath.Join(dir, fmt.Sprintf("key-%d", i))
+		if err := os.WriteFile(file, []byte(key), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+
+	tests := []struct {
+		name    string
+		opts    *keysFromOptions
+		want    []string
+		wantErr bool
+	}{
+		{name: "files", opts: &keysFromOptions{keysFrom: keysFromFiles, keyFiles: files}, want: []string{"k0", "k1"}},
+		{name: "no files", opts: &keysFromOptions{keysFrom: keysFromFiles}, wantErr: true},
+		{name: "missing file", opts: &keysFromOptions{keysFrom: keysFromFiles, keyFiles: []string{filepath.Join(dir, "missing")}}, wantErr: true},
+		{name: "unknown source", opts: &keysFromOptions{keysFrom: "vault"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := tt.opts.keySource(context.Background(), &vaultapi.VaultServer{}, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("keySource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got, _ := drain(src)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("keySource() shares = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateRootCeremonyRequiresOTP(t *testing.T) {
+	fake := &fakeGenerateRoot{required: 3, started: true, progress: 1}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	cfg := api.DefaultConfig()
+	cfg.Address = srv.URL
+	client, err := api.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "key")
+	if err = os.WriteFile(file, []byte("k0"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	o := &keysFromOptions{keysFrom: keysFromFiles, keyFiles: []string{file}}
+
+	if _, err = o.generateRootCeremony(context.Background(), client, &vaultapi.VaultServer{}, nil); err == nil {
+		t.Fatal("generateRootCeremony() resumed a generation without the otp")
+	}
+	if fake.progress != 1 {
+		t.Errorf("generateRootCeremony() submitted shares without the otp, progress %d", fake.progress)
+	}
+}
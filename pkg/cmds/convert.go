@@ -0,0 +1,156 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"os"
+
+	vaultv1alpha1 "kubevault.dev/apimachinery/apis/kubevault/v1alpha1"
+	"kubevault.dev/cli/pkg/vaultserver"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
+	"k8s.io/cli-runtime/pkg/resource"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+)
+
+type convertOptions struct {
+	output string
+}
+
+func newConvertOptions() *convertOptions {
+	return &convertOptions{
+		output: "yaml",
+	}
+}
+
+func (o *convertOptions) addConvertFlags(fs *pflag.FlagSet) {
+	fs.StringVarP(&o.output, "output", "o", o.output, "output format yaml/json")
+}
+
+func NewCmdConvert(clientGetter genericclioptions.RESTClientGetter) *cobra.Command {
+	o := newConvertOptions()
+	cmd := &cobra.Command{
+		Use:   "convert",
+		Short: "convert vaultserver manifests to the latest api version",
+		Long: `
+$ kubectl vault convert -f <file> [flags]
+
+Rewrites kubevault.com/v1alpha1 VaultServer manifests into kubevault.com/v1alpha2 without
+contacting the cluster. Any other object in the manifests is printed unchanged.
+
+Examples:
+ # convert the vaultserver manifest to v1alpha2
+ $ kubectl vault convert -f old.yaml
+
+ # convert every manifest in a directory and print json
+ $ kubectl vault convert -f manifests/ -R -o json
+`,
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := o.convert(clientGetter); err != nil {
+				Fatal(err)
+			}
+			os.Exit(0)
+		},
+	}
+
+	cmdutil.AddFilenameOptionFlags(cmd, &FilenameOptions, "with the manifests to convert")
+	o.addConvertFlags(cmd.Flags())
+	return cmd
+}
+
+func (o *convertOptions) convert(clientGetter genericclioptions.RESTClientGetter) error {
+	if len(FilenameOptions.Filenames) == 0 {
+		return errors.New("manifests to convert must be given with -f")
+	}
+
+	var printer printers.ResourcePrinter
+	switch o.output {
+	case "yaml":
+		printer = &printers.YAMLPrinter{}
+	case "json":
+		printer = &printers.JSONPrinter{}
+	default:
+		return errors.Errorf("unknown output format %s, use yaml or json", o.output)
+	}
+
+	r := cmdutil.NewFactory(clientGetter).NewBuilder().
+		Unstructured().
+		Local().
+		ContinueOnError().
+		FilenameParam(false, &FilenameOptions).
+		Flatten().
+		Do()
+
+	var objects []runtime.Object
+	err := r.Visit(func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+
+		obj, err := convertObject(info.Object)
+		if err != nil {
+			return errors.Wrapf(err, "failed to convert %s", info.Source)
+		}
+		objects = append(objects, obj)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(objects) == 1 || o.output == "yaml" {
+		for _, obj := range objects {
+			if err = printer.PrintObj(obj, os.Stdout); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	list := &metav1.List{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "List",
+		},
+	}
+	for _, obj := range objects {
+		list.Items = append(list.Items, runtime.RawExtension{Object: obj})
+	}
+	return printer.PrintObj(list, os.Stdout)
+}
+
+// convertObject converts a v1alpha1 VaultServer to v1alpha2, any other object is returned unchanged.
+func convertObject(obj runtime.Object) (runtime.Object, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok || u.GroupVersionKind() != vaultv1alpha1.SchemeGroupVersion.WithKind(vaultv1alpha1.ResourceKindVaultServer) {
+		return obj, nil
+	}
+
+	old := &vaultv1alpha1.VaultServer{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, old); err != nil {
+		return nil, err
+	}
+	return vaultserver.ToHub(old)
+}
@@ -0,0 +1,96 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"testing"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestConvertObject(t *testing.T) {
+	vaultServer := func(apiVersion string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": apiVersion,
+			"kind":       "VaultServer",
+			"metadata": map[string]any{
+				"name":      "vault",
+				"namespace": "demo",
+			},
+			"spec": map[string]any{
+				"version":  "1.10.3",
+				"replicas": int64(3),
+				"unsealer": map[string]any{
+					"secretShares":    int64(5),
+					"secretThreshold": int64(3),
+					"mode": map[string]any{
+						"kubernetesSecret": map[string]any{
+							"secretName": "vault-keys",
+						},
+					},
+				},
+			},
+		}}
+	}
+
+	t.Run("v1alpha1 vaultserver", func(t *testing.T) {
+		obj, err := convertObject(vaultServer("kubevault.com/v1alpha1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		vs, ok := obj.(*vaultapi.VaultServer)
+		if !ok {
+			t.Fatalf("convertObject() returned %T, want %T", obj, vs)
+		}
+		if vs.Namespace != "demo" || vs.Name != "vault" {
+			t.Errorf("convertObject() returned vaultserver %s/%s, want demo/vault", vs.Namespace, vs.Name)
+		}
+		if vs.Spec.Replicas == nil || *vs.Spec.Replicas != 3 || string(vs.Spec.Version) != "1.10.3" {
+			t.Errorf("convertObject() returned replicas %v and version %s, want 3 and 1.10.3", vs.Spec.Replicas, vs.Spec.Version)
+		}
+		u := vs.Spec.Unsealer
+		if u == nil || u.SecretShares != 5 || u.SecretThreshold != 3 {
+			t.Fatalf("convertObject() returned unsealer %+v, want 5 shares and threshold 3", u)
+		}
+		if u.Mode.KubernetesSecret == nil || u.Mode.KubernetesSecret.SecretName != "vault-keys" {
+			t.Errorf("convertObject() returned unsealer mode %+v, want kubernetesSecret vault-keys", u.Mode)
+		}
+	})
+
+	unchanged := []struct {
+		name string
+		obj  runtime.Object
+	}{
+		{name: "v1alpha2 vaultserver", obj: vaultServer("kubevault.com/v1alpha2")},
+		{name: "typed object", obj: &core.Secret{}},
+	}
+	for _, tt := range unchanged {
+		t.Run(tt.name, func(t *testing.T) {
+			obj, err := convertObject(tt.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if obj != tt.obj {
+				t.Errorf("convertObject() converted %s", tt.name)
+			}
+		})
+	}
+}
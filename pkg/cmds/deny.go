@@ -21,6 +21,8 @@ import (
 	"os"
 	"strings"
 
+	opsapi "kubevault.dev/apimachinery/apis/ops/v1alpha1"
+
 	"github.com/spf13/cobra"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
@@ -37,10 +39,39 @@ var secretAccessDeniedCond = kmapi.Condition{
 	Message: "This was denied by: kubectl vault deny secretaccessrequest",
 }
 
+var vaultOpsDeniedCond = kmapi.Condition{
+	Type:    opsapi.AccessDenied,
+	Status:  metav1.ConditionTrue,
+	Reason:  "KubectlDeny",
+	Message: "This was denied by: kubectl vault deny vaultopsrequest",
+}
+
 func NewCmdDeny(clientGetter genericclioptions.RESTClientGetter) *cobra.Command {
+	o := newDecisionOptions()
 	cmd := &cobra.Command{
-		Use:               "deny",
-		Short:             "Deny request",
+		Use:   "deny",
+		Short: "Deny request",
+		Long: `
+$ kubectl vault deny secretaccessrequest <name> -n <namespace>
+$ kubectl vault deny vaultopsrequest <name> -n <namespace>
+
+A vaultopsrequest gets the Denied condition and phase. It is refused unless the request
+is pending or waiting for approval, and if it is already approved or denied.
+
+The user of the current kubeconfig, the time and the --reason are recorded in the condition
+message and in an event on the request. The user is looked up with a selfsubjectreview, if that
+fails the user name of the kubeconfig is recorded with the prefix unverified:.
+
+Examples:
+ # deny the secretaccessrequest
+ $ kubectl vault deny secretaccessrequest my-request -n demo
+
+ # deny the vaultopsrequest waiting for approval
+ $ kubectl vault deny vaultopsrequest vault-restart -n demo
+
+ # deny the secretaccessrequest with the reason for the audit trail
+ $ kubectl vault deny secretaccessrequest my-request -n demo --reason="incident 4711"
+`,
 		DisableAutoGenTag: true,
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) > 0 {
@@ -48,15 +79,16 @@ func NewCmdDeny(clientGetter genericclioptions.RESTClientGetter) *cobra.Command
 				ObjectNames = args[1:]
 			}
 
-			if err := modifyStatusCondition(clientGetter, secretAccessDeniedCond); err != nil {
+			if err := modifyStatusCondition(cmd.Context(), clientGetter, secretAccessDeniedCond, o); err != nil {
 				Fatal(err)
 			} else {
-				fmt.Printf("secretaccessrequests %s denied\n", strings.Join(ObjectNames, ", "))
+				fmt.Printf("%s %s denied\n", requestResourceName(), strings.Join(ObjectNames, ", "))
 			}
 			os.Exit(0)
 		},
 	}
 
 	cmdutil.AddFilenameOptionFlags(cmd, &FilenameOptions, "identifying the resource to update")
+	o.addDecisionFlags(cmd.Flags())
 	return cmd
 }
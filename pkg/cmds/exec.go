@@ -0,0 +1,258 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gomodules.xyz/pointer"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+type execOptions struct {
+	ttl time.Duration
+}
+
+func newExecOptions() *execOptions {
+	return &execOptions{
+		ttl: time.Hour,
+	}
+}
+
+func (o *execOptions) addExecFlags(fs *pflag.FlagSet) {
+	fs.DurationVar(&o.ttl, "ttl", o.ttl, "ttl of the root-token, it expires after the ttl even if it can't be revoked")
+}
+
+func NewCmdExecToken(clientGetter genericclioptions.RESTClientGetter) *cobra.Command {
+	o := newExecOptions()
+	cmd := &cobra.Command{
+		Use:   "exec",
+		Short: "run a command with a short-lived root-token",
+		Long: `
+$ kubectl vault root-token exec vaultserver <name> -n <namespace> -- <command> [args...]
+
+Generates a root-token from the stored unseal-keys, creates an orphan token with the root policy
+and --ttl with it and revokes the generated root-token right away. The command is run with
+VAULT_ADDR, VAULT_TOKEN and VAULT_CACERT (or VAULT_SKIP_VERIFY) set for the port-forward
+to the active vault pod. The command gets interrupts from the terminal and SIGTERM is
+forwarded to it, kubectl-vault waits for the command to exit, and the token is revoked when
+the command exits, also if the command fails or is interrupted. The accessor of the token
+is printed to stderr, so that its use can be found in the vault audit log.
+
+Exits with the exit code of the command.
+
+Examples:
+ # check the status of the vaultserver with the vault cli
+ $ kubectl vault root-token exec vaultserver vault -n demo -- vault status
+
+ # run a script with root access for at most 10 minutes
+ $ kubectl vault root-token exec vaultserver vault -n demo --ttl=10m -- ./configure-vault.sh
+`,
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			dash := cmd.ArgsLenAtDash()
+			if dash < 0 || dash == len(args) {
+				Fatal(errors.New("the command to run must follow --"))
+			}
+			if dash > 0 {
+				ResourceName = args[0]
+				ObjectNames = args[1:dash]
+			}
+
+			err := o.execWithRootToken(cmd.Context(), clientGetter, args[dash:])
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				os.Exit(exitErr.ExitCode())
+			}
+			if err != nil {
+				Fatal(err)
+			}
+			os.Exit(0)
+		},
+	}
+
+	o.addExecFlags(cmd.Flags())
+	return cmd
+}
+
+func (o *execOptions) execWithRootToken(ctx context.Context, clientGetter genericclioptions.RESTClientGetter, command []string) error {
+	if len(ObjectNames) != 1 {
+		return errors.Errorf("exactly one vaultserver is required, found %d", len(ObjectNames))
+	}
+	if o.ttl <= 0 {
+		return errors.New("--ttl must be positive")
+	}
+
+	cfg, err := clientGetter.ToRESTConfig()
+	if err != nil {
+		return errors.Wrap(err, "failed to read kubeconfig")
+	}
+
+	return visitVaultServers(clientGetter, func(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
+		return o.execCommand(ctx, cfg, vs, kubeClient, command)
+	})
+}
+
+func (o *execOptions) execCommand(ctx context.Context, cfg *rest.Config, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface, command []string) (err error) {
+	keys, err := getKeys(ctx, vs, kubeClient)
+	if err != nil {
+		return err
+	}
+
+	client, tunnel, err := NewVaultClient(cfg, kubeClient, vs)
+	if err != nil {
+		return err
+	}
+	defer tunnel.Close()
+
+	env := append(os.Environ(), "VAULT_ADDR="+client.Address())
+	if vs.Spec.TLS != nil {
+		tlsConfig, err := newVaultTLSConfig(kubeClient, vs)
+		if err != nil {
+			return err
+		}
+		if tlsConfig.Insecure {
+			env = append(env, "VAULT_SKIP_VERIFY=true")
+		} else {
+			caFile, err := os.CreateTemp("", "vault-ca-*.crt")
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = os.Remove(caFile.Name())
+			}()
+
+			_, err = caFile.Write(tlsConfig.CACertBytes)
+			if err2 := caFile.Close(); err == nil {
+				err = err2
+			}
+			if err != nil {
+				return err
+			}
+			env = append(env, "VAULT_CACERT="+caFile.Name(), "VAULT_TLS_SERVER_NAME="+tlsConfig.TLSServerName)
+		}
+	}
+
+	// interrupts are held from before the generation until the tokens are revoked, the tokens
+	// are generated, created and revoked without ctx, so that no root-token is left on interrupt
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	rootToken, err := generateTokenWithClient(context.Background(), client, vs, keys)
+	if err != nil {
+		return err
+	}
+
+	// the generated root-token never expires, it is only used to create a token with ttl
+	token, accessor, err := createTokenWithTTL(context.Background(), client, rootToken, o.ttl)
+	if err2 := revokeToken(context.Background(), client, rootToken); err2 != nil {
+		if err == nil {
+			_ = revokeToken(context.Background(), client, token)
+		}
+		return errors.Wrap(err2, "failed to revoke the generated root-token")
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to create a root-token with ttl, the generated root-token is revoked")
+	}
+
+	defer func() {
+		if err2 := revokeToken(context.Background(), client, token); err2 != nil {
+			err2 = errors.Wrapf(err2, "failed to revoke the root-token, it expires in %s", o.ttl)
+			if err == nil {
+				err = err2
+			} else {
+				fmt.Fprintln(os.Stderr, err2)
+			}
+			return
+		}
+		fmt.Fprintln(os.Stderr, "root-token revoked")
+	}()
+
+	fmt.Fprintf(os.Stderr, "generated root-token with accessor %s and ttl %s for vaultserver %s/%s\n", accessor, o.ttl, vs.Namespace, vs.Name)
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = append(env, "VAULT_TOKEN="+token)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return runCommand(cmd, sigCh)
+}
+
+// runCommand runs cmd and forwards SIGTERM to it until it exits. Interrupts are not forwarded,
+// the command runs in the foreground process group and gets them from the terminal itself.
+func runCommand(cmd *exec.Cmd, sigCh <-chan os.Signal) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	// the command decides how to handle signals, it is waited for in any case
+	for {
+		select {
+		case err := <-done:
+			return err
+		case sig := <-sigCh:
+			if sig == syscall.SIGTERM {
+				_ = cmd.Process.Signal(sig)
+			}
+		}
+	}
+}
+
+// createTokenWithTTL creates an orphan token with the root policy and the ttl, so that it
+// expires even if it can't be revoked. It returns the token and its accessor.
+func createTokenWithTTL(ctx context.Context, client *api.Client, rootToken string, ttl time.Duration) (string, string, error) {
+	c, err := client.Clone()
+	if err != nil {
+		return "", "", err
+	}
+	c.SetToken(rootToken)
+
+	secret, err := c.Auth().Token().CreateOrphanWithContext(ctx, &api.TokenCreateRequest{
+		Policies:       []string{"root"},
+		TTL:            ttl.String(),
+		ExplicitMaxTTL: ttl.String(),
+		DisplayName:    "kubectl-vault-exec",
+		Renewable:      pointer.FalseP(),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	if secret == nil || secret.Auth == nil {
+		return "", "", errors.New("vault returned no token")
+	}
+	return secret.Auth.ClientToken, secret.Auth.Accessor, nil
+}
@@ -0,0 +1,92 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunCommand(t *testing.T) {
+	// the script reports the first signal it receives with its exit code
+	const script = `trap 'exit 3' INT; trap 'exit 4' TERM; echo ready; while :; do sleep 0.05; done`
+
+	cases := []struct {
+		name    string
+		signals []os.Signal
+		want    int
+	}{
+		{name: "sigterm is forwarded", signals: []os.Signal{syscall.SIGTERM}, want: 4},
+		{name: "interrupt is not forwarded", signals: []os.Signal{os.Interrupt, syscall.SIGTERM}, want: 4},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cmd := exec.Command("sh", "-c", script)
+			stdout, err := cmd.StdoutPipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sigCh := make(chan os.Signal)
+			done := make(chan error, 1)
+			go func() {
+				done <- runCommand(cmd, sigCh)
+			}()
+
+			// wait until the traps are installed
+			buf := make([]byte, len("ready\n"))
+			if _, err := stdout.Read(buf); err != nil {
+				t.Fatal(err)
+			}
+			for _, sig := range c.signals {
+				sigCh <- sig
+			}
+
+			select {
+			case err = <-done:
+			case <-time.After(10 * time.Second):
+				_ = cmd.Process.Kill()
+				t.Fatal("the command did not exit")
+			}
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) {
+				t.Fatalf("runCommand() = %v, want an exit error", err)
+			}
+			if got := exitErr.ExitCode(); got != c.want {
+				t.Errorf("exit code = %d, want %d", got, c.want)
+			}
+		})
+	}
+
+	t.Run("exit code", func(t *testing.T) {
+		err := runCommand(exec.Command("sh", "-c", "exit 7"), make(chan os.Signal))
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 7 {
+			t.Errorf("runCommand() = %v, want exit status 7", err)
+		}
+	})
+
+	t.Run("start failure", func(t *testing.T) {
+		if err := runCommand(exec.Command("/nonexistent/command"), make(chan os.Signal)); err == nil {
+			t.Error("runCommand() = nil, want an error")
+		}
+	})
+}
@@ -0,0 +1,457 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+	"kubevault.dev/cli/pkg/encryption"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/term"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+)
+
+const keyBundleVersion = "v1"
+
+// keyBundle is the plaintext content of an exported unseal-key bundle.
+type keyBundle struct {
+	Version         string           `json:"version"`
+	Namespace       string           `json:"namespace"`
+	Name            string           `json:"name"`
+	UID             types.UID        `json:"uid,omitempty"`
+	Mode            string           `json:"mode"`
+	SecretShares    int64            `json:"secretShares"`
+	SecretThreshold int64            `json:"secretThreshold"`
+	UnsealKeys      []keyBundleEntry `json:"unsealKeys"`
+	RootToken       *keyBundleEntry  `json:"rootToken,omitempty"`
+	ExportedAt      time.Time        `json:"exportedAt"`
+}
+
+type keyBundleEntry struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type exportOptions struct {
+	ageRecipients     []string
+	ageRecipientsFile string
+	pgpRecipientFiles []string
+	output            string
+}
+
+type importOptions struct {
+	file              string
+	ageIdentityFile   string
+	pgpSecretKeyFiles []string
+	force             bool
+	overwrite         bool
+}
+
+func newExportOptions() *exportOptions {
+	return &exportOptions{}
+}
+
+func newImportOptions() *importOptions {
+	return &importOptions{}
+}
+
+func (o *exportOptions) addExportFlags(fs *pflag.FlagSet) {
+	fs.StringSliceVar(&o.ageRecipients, "age-recipient", o.ageRecipients, "age public key to encrypt the bundle to, can be repeated")
+	fs.StringVar(&o.ageRecipientsFile, "age-recipients-file", o.ageRecipientsFile, "file containing age public keys to encrypt the bundle to, one per line")
+	fs.StringSliceVar(&o.pgpRecipientFiles, "pgp-recipient-file", o.pgpRecipientFiles, "file containing an OpenPGP public key to encrypt the bundle to, can be repeated")
+	fs.StringVarP(&o.output, "output", "o", o.output, "file to write the encrypted bundle to")
+}
+
+func (o *importOptions) addImportFlags(fs *pflag.FlagSet) {
+	fs.StringVarP(&o.file, "file", "f", o.file, "encrypted bundle file to import")
+	fs.StringVar(&o.ageIdentityFile, "age-identity-file", o.ageIdentityFile, "age identity file to decrypt the bundle")
+	fs.StringSliceVar(&o.pgpSecretKeyFiles, "pgp-secret-key-file", o.pgpSecretKeyFiles, "file containing an OpenPGP secret key to decrypt the bundle, can be repeated")
+	fs.BoolVar(&o.force, "force", o.force, "import the bundle even if it was exported from a different vaultserver")
+	fs.BoolVar(&o.overwrite, "overwrite", o.overwrite, "overwrite the unseal-keys and root-token already present in the key store")
+}
+
+func NewCmdExportKeys(clientGetter genericclioptions.RESTClientGetter) *cobra.Command {
+	o := newExportOptions()
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "export vault unseal-keys and root-token as an encrypted bundle",
+		Long: `
+$ kubectl vault unseal-key export vaultserver <name> -n <namespace> --output=<file> [flags]
+
+Reads every unseal-key and the root-token of one vaultserver from the key store and writes them, along with the vaultserver
+identity and the unsealer mode, as a bundle encrypted to the given age or OpenPGP recipients. The bundle
+can be restored with "kubectl vault unseal-key import" even if the original key store is lost.
+
+Examples:
+ # export the unseal-keys and root-token of a vaultserver with name vault in demo namespace for an age recipient
+ $ kubectl vault unseal-key export vaultserver vault -n demo --age-recipient=age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p --output=vault.age
+
+ # export for OpenPGP recipients
+ $ kubectl vault unseal-key export vaultserver vault -n demo --pgp-recipient-file=alice.asc --pgp-recipient-file=bob.asc --output=vault.asc
+`,
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				ResourceName = args[0]
+				ObjectNames = args[1:]
+			}
+
+			if err := o.export(cmd.Context(), clientGetter); err != nil {
+				Fatal(err)
+			}
+			os.Exit(0)
+		},
+	}
+
+	o.addExportFlags(cmd.Flags())
+	return cmd
+}
+
+func NewCmdImportKeys(clientGetter genericclioptions.RESTClientGetter) *cobra.Command {
+	o := newImportOptions()
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "import vault unseal-keys and root-token from an encrypted bundle",
+		Long: `
+$ kubectl vault unseal-key import vaultserver <name> -n <namespace> --file=<file> [flags]
+
+Decrypts a bundle created by "kubectl vault unseal-key export" and writes the unseal-keys and root-token
+to the key store currently configured for the vaultserver.
+
+Examples:
+ # import the bundle into the key store of a vaultserver with name vault in demo namespace
+ $ kubectl vault unseal-key import vaultserver vault -n demo --file=vault.age --age-identity-file=key.txt
+
+ # import an OpenPGP encrypted bundle, replacing the existing keys
+ $ kubectl vault unseal-key import vaultserver vault -n demo --file=vault.asc --pgp-secret-key-file=alice.key --overwrite
+`,
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				ResourceName = args[0]
+				ObjectNames = args[1:]
+			}
+
+			if err := o.importKeys(cmd.Context(), clientGetter); err != nil {
+				Fatal(err)
+			}
+			os.Exit(0)
+		},
+	}
+
+	o.addImportFlags(cmd.Flags())
+	return cmd
+}
+
+func (o *exportOptions) export(ctx context.Context, clientGetter genericclioptions.RESTClientGetter) error {
+	if len(o.output) == 0 {
+		return errors.New("--output is required")
+	}
+	// the bundle of a vaultserver is written to --output, so only one vaultserver can be exported at a time
+	if len(ObjectNames) != 1 {
+		return errors.Errorf("exactly one vaultserver is required, found %d", len(ObjectNames))
+	}
+
+	encrypt, err := o.encrypter()
+	if err != nil {
+		return err
+	}
+
+	return visitVaultServers(clientGetter, func(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
+		return o.exportKeys(ctx, vs, kubeClient, encrypt)
+	})
+}
+
+// encrypter returns a function that encrypts the bundle to the recipients given by the flags.
+// Exactly one kind of recipient, age or OpenPGP, must be provided.
+func (o *exportOptions) encrypter() (func([]byte) ([]byte, error), error) {
+	keys := o.ageRecipients
+	if len(o.ageRecipientsFile) > 0 {
+		data, err := os.ReadFile(o.ageRecipientsFile)
+		if err != nil {
+			return nil, err
+		}
+		sc := bufio.NewScanner(strings.NewReader(string(data)))
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			keys = append(keys, line)
+		}
+	}
+
+	switch {
+	case len(keys) > 0 && len(o.pgpRecipientFiles) > 0:
+		return nil, errors.New("age and pgp recipients can't be used together")
+	case len(keys) > 0:
+		recipients, err := encryption.ParseAgeRecipients(keys)
+		if err != nil {
+			return nil, err
+		}
+		return func(data []byte) ([]byte, error) {
+			return encryption.EncryptAge(data, recipients...)
+		}, nil
+	case len(o.pgpRecipientFiles) > 0:
+		entities, err := encryption.ReadPGPKeys(o.pgpRecipientFiles)
+		if err != nil {
+			return nil, err
+		}
+		return func(data []byte) ([]byte, error) {
+			return encryption.EncryptPGP(data, entities)
+		}, nil
+	default:
+		return nil, errors.New("either --age-recipient, --age-recipients-file or --pgp-recipient-file is required")
+	}
+}
+
+func (o *exportOptions) exportKeys(ctx context.Context, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface, encrypt func([]byte) ([]byte, error)) error {
+	// For export:
+	// - every unseal-key must be present in the key store
+	// - root-token must be present in the key store if storeRootToken is set
+	if vs.Spec.Unsealer == nil {
+		return errors.New("vaultServer unsealer spec is empty")
+	}
+
+	modes := modeNames(&vs.Spec.Unsealer.Mode)
+	if len(modes) != 1 {
+		return errors.Errorf("vaultserver %s/%s must have exactly one unsealer mode, found %d", vs.Namespace, vs.Name, len(modes))
+	}
+
+	ti, err := newTokenKeyInterface(vs, kubeClient)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		ti.Clean()
+	}()
+
+	bundle := keyBundle{
+		Version:         keyBundleVersion,
+		Namespace:       vs.Namespace,
+		Name:            vs.Name,
+		UID:             vs.UID,
+		Mode:            modes[0],
+		SecretShares:    vs.Spec.Unsealer.SecretShares,
+		SecretThreshold: vs.Spec.Unsealer.SecretThreshold,
+		ExportedAt:      time.Now().UTC(),
+	}
+
+	for i := 0; int64(i) < vs.Spec.Unsealer.SecretShares; i++ {
+		name, err := ti.NewUnsealKeyName(ctx, i)
+		if err != nil {
+			return err
+		}
+
+		value, err := ti.Get(ctx, name)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read unseal-key %s", name)
+		}
+
+		bundle.UnsealKeys = append(bundle.UnsealKeys, keyBundleEntry{ID: i, Name: name, Value: value})
+	}
+
+	name := ti.NewTokenName(ctx)
+	value, err := ti.Get(ctx, name)
+	if err != nil {
+		if vs.Spec.Unsealer.StoreRootToken {
+			return errors.Wrapf(err, "failed to read root-token %s", name)
+		}
+		fmt.Printf("root-token %s not found, skipping\n", name)
+	} else {
+		bundle.RootToken = &keyBundleEntry{Name: name, Value: value}
+	}
+
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		return err
+	}
+
+	out, err := encrypt(data)
+	if err != nil {
+		return errors.Wrap(err, "failed to encrypt bundle")
+	}
+
+	if err = os.WriteFile(o.output, out, 0o600); err != nil {
+		return err
+	}
+
+	fmt.Printf("unseal-keys and root-token of vaultserver %s/%s successfully exported to %s\n", vs.Namespace, vs.Name, o.output)
+	return nil
+}
+
+func (o *importOptions) importKeys(ctx context.Context, clientGetter genericclioptions.RESTClientGetter) error {
+	bundle, err := o.readBundle()
+	if err != nil {
+		return err
+	}
+
+	return visitVaultServers(clientGetter, func(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
+		return o.restoreKeys(ctx, vs, kubeClient, bundle)
+	})
+}
+
+// readBundle decrypts the bundle file with the age identity or OpenPGP secret keys.
+func (o *importOptions) readBundle() (*keyBundle, error) {
+	if len(o.file) == 0 {
+		return nil, errors.New("--file is required")
+	}
+
+	data, err := os.ReadFile(o.file)
+	if err != nil {
+		return nil, err
+	}
+
+	var plain []byte
+	switch {
+	case encryption.IsAgeEncrypted(data):
+		if len(o.ageIdentityFile) == 0 {
+			return nil, errors.New("--age-identity-file is required to decrypt an age encrypted bundle")
+		}
+		identities, err := encryption.ReadAgeIdentities(o.ageIdentityFile)
+		if err != nil {
+			return nil, err
+		}
+		plain, err = encryption.DecryptAge(data, identities...)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decrypt bundle")
+		}
+	case encryption.IsPGPEncrypted(data):
+		if len(o.pgpSecretKeyFiles) == 0 {
+			return nil, errors.New("--pgp-secret-key-file is required to decrypt a pgp encrypted bundle")
+		}
+		keyring, err := encryption.ReadPGPKeys(o.pgpSecretKeyFiles)
+		if err != nil {
+			return nil, err
+		}
+		plain, err = encryption.DecryptPGP(data, keyring, readPassphrase)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decrypt bundle")
+		}
+	default:
+		return nil, errors.Errorf("%s is neither an age nor a pgp encrypted bundle", o.file)
+	}
+
+	var bundle keyBundle
+	if err = json.Unmarshal(plain, &bundle); err != nil {
+		return nil, errors.Wrap(err, "failed to parse bundle")
+	}
+	if bundle.Version != keyBundleVersion {
+		return nil, errors.Errorf("unsupported bundle version %s", bundle.Version)
+	}
+
+	return &bundle, nil
+}
+
+func (o *importOptions) restoreKeys(ctx context.Context, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface, bundle *keyBundle) error {
+	// For import:
+	// - bundle must belong to the same vaultserver, unless force is set
+	// - no unseal-key or root-token must exist in the key store, unless overwrite is set
+	// - every key written to the key store must be read back successfully
+	if vs.Spec.Unsealer == nil {
+		return errors.New("vaultServer unsealer spec is empty")
+	}
+
+	if !o.force && (bundle.Namespace != vs.Namespace || bundle.Name != vs.Name) {
+		return errors.Errorf("bundle belongs to vaultserver %s/%s, use --force to import it into %s/%s", bundle.Namespace, bundle.Name, vs.Namespace, vs.Name)
+	}
+
+	if int64(len(bundle.UnsealKeys)) < vs.Spec.Unsealer.SecretThreshold {
+		return errors.Errorf("bundle contains %d unseal-keys, %d required", len(bundle.UnsealKeys), vs.Spec.Unsealer.SecretThreshold)
+	}
+
+	ti, err := newTokenKeyInterface(vs, kubeClient)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		ti.Clean()
+	}()
+
+	if !o.overwrite {
+		existing, err := existingKeys(ctx, vs, ti)
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			return errors.Errorf("keys %s already exist, use --overwrite to replace them", strings.Join(existing, ", "))
+		}
+	}
+
+	type keyPair struct {
+		name  string
+		value string
+	}
+
+	var pairs []keyPair
+	for _, key := range bundle.UnsealKeys {
+		name, err := ti.NewUnsealKeyName(ctx, key.ID)
+		if err != nil {
+			return err
+		}
+		pairs = append(pairs, keyPair{name: name, value: key.Value})
+	}
+	if bundle.RootToken != nil {
+		pairs = append(pairs, keyPair{name: ti.NewTokenName(ctx), value: bundle.RootToken.Value})
+	}
+
+	values := map[string]string{}
+	for _, p := range pairs {
+		values[p.name] = p.value
+	}
+	if err = ti.SetMany(ctx, values); err != nil {
+		return errors.Wrap(err, "failed to write the unseal-keys and root-token")
+	}
+
+	for _, p := range pairs {
+		got, err := ti.Get(ctx, p.name)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read back %s", p.name)
+		}
+		if got != p.value {
+			return errors.Errorf("%s in the key store doesn't match the bundle", p.name)
+		}
+
+		fmt.Printf("%s successfully imported\n", p.name)
+	}
+
+	fmt.Printf("unseal-keys and root-token successfully imported into vaultserver %s/%s\n", vs.Namespace, vs.Name)
+	return nil
+}
+
+// readPassphrase prompts for the passphrase of an OpenPGP secret key without echoing it.
+func readPassphrase(keyID string) ([]byte, error) {
+	fmt.Fprintf(os.Stderr, "Enter passphrase for pgp key %s: ", keyID)
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return passphrase, err
+}
@@ -127,7 +127,7 @@ Examples:
 				ObjectNames = args[1:]
 			}
 
-			if err := o.generate(clientGetter); err != nil {
+			if err := o.generate(cmd.Context(), clientGetter); err != nil {
 				Fatal(err)
 			}
 
@@ -139,7 +139,7 @@ Examples:
 	return cmd
 }
 
-func (o *generateOption) generate(clientGetter genericclioptions.RESTClientGetter) error {
+func (o *generateOption) generate(ctx context.Context, clientGetter genericclioptions.RESTClientGetter) error {
 	var resourceName string
 	switch strings.ToLower(ResourceName) {
 	case ResourceKindSecretProviderClass:
@@ -172,7 +172,7 @@ func (o *generateOption) generate(clientGetter genericclioptions.RESTClientGette
 
 	spc := NewSecretProviderClassOptions(o, namespace, ObjectNames[0])
 
-	objectsList, err := spc.generateSecretObjects(engineClient, vaultClient, policyClient, kubeClient)
+	objectsList, err := spc.generateSecretObjects(ctx, engineClient, vaultClient, policyClient, kubeClient)
 	if err != nil {
 		return err
 	}
@@ -184,7 +184,7 @@ func (o *generateOption) generate(clientGetter genericclioptions.RESTClientGette
 	return nil
 }
 
-func (s *SecretProviderClassOptions) generateSecretObjects(engineClient *enginecs.EngineV1alpha1Client, vaultClient *vaultcs.KubevaultV1alpha2Client, policyClient *policycs.PolicyV1alpha1Client, kubeClient *kubernetes.Clientset) (string, error) {
+func (s *SecretProviderClassOptions) generateSecretObjects(ctx context.Context, engineClient *enginecs.EngineV1alpha1Client, vaultClient *vaultcs.KubevaultV1alpha2Client, policyClient *policycs.PolicyV1alpha1Client, kubeClient *kubernetes.Clientset) (string, error) {
 	if engineClient == nil || vaultClient == nil || policyClient == nil || kubeClient == nil {
 		return "", errors.New("engineClient/vaultClient/policyClient/kubeClient is nil")
 	}
@@ -199,7 +199,7 @@ func (s *SecretProviderClassOptions) generateSecretObjects(engineClient *enginec
 		srbName = srb[1]
 	}
 
-	srbObj, err := engineClient.SecretRoleBindings(srbNs).Get(context.TODO(), srbName, metav1.GetOptions{})
+	srbObj, err := engineClient.SecretRoleBindings(srbNs).Get(ctx, srbName, metav1.GetOptions{})
 	if err != nil {
 		return "", err
 	}
@@ -220,24 +220,24 @@ func (s *SecretProviderClassOptions) generateSecretObjects(engineClient *enginec
 		return "", errors.Errorf("%s/%s not found in secretrolebinding", role[0], role[1])
 	}
 
-	gen, err := generate.NewGenerator(role, srbObj, s.options.keys, engineClient, vaultClient, policyClient, kubeClient)
+	gen, err := generate.NewGenerator(ctx, role, srbObj, s.options.keys, engineClient, vaultClient, policyClient, kubeClient)
 	if err != nil {
 		return "", err
 	}
 
-	address, err := gen.GetVaultServerURL()
+	address, err := gen.GetVaultServerURL(ctx)
 	if err != nil {
 		return "", err
 	}
 	s.vsURL = address
 
-	vaultRoleName, err := gen.GetVaultRoleName()
+	vaultRoleName, err := gen.GetVaultRoleName(ctx)
 	if err != nil {
 		return "", err
 	}
 	s.roleName = vaultRoleName
 
-	return gen.Generate()
+	return gen.Generate(ctx)
 }
 
 func (s *SecretProviderClassOptions) generateSecretProviderClass(objectsList string) error {
@@ -0,0 +1,226 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+	"kubevault.dev/cli/pkg/token-keys-store/api"
+
+	vaultclient "github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func NewCmdInit(clientGetter genericclioptions.RESTClientGetter) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "initialize vault",
+		Long: `
+# initialize an uninitialized vaultserver and store the unseal keys and root-token in the configured key store
+$ kubectl vault init vaultserver <name> -n <namespace> [flags]
+
+The number of unseal-keys and the threshold are taken from spec.unsealer.secretShares and spec.unsealer.secretThreshold.
+The root-token is stored only if spec.unsealer.storeRootToken is true. Existing keys are never overwritten
+unless spec.unsealer.overwriteExisting is true. If the keys can't be stored once vault is initialized,
+they are printed to stderr, as vault can't return them again.
+
+Examples:
+ # initialize a vaultserver with name vault in demo namespace
+ $ kubectl vault init vaultserver vault -n demo
+`,
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				ResourceName = args[0]
+				ObjectNames = args[1:]
+			}
+
+			if err := initVaultServer(cmd.Context(), clientGetter); err != nil {
+				Fatal(err)
+			}
+			os.Exit(0)
+		},
+	}
+
+	return cmd
+}
+
+func initVaultServer(ctx context.Context, clientGetter genericclioptions.RESTClientGetter) error {
+	cfg, err := clientGetter.ToRESTConfig()
+	if err != nil {
+		return errors.Wrap(err, "failed to read kubeconfig")
+	}
+
+	return visitVaultServers(clientGetter, func(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
+		return initVault(ctx, cfg, vs, kubeClient)
+	})
+}
+
+func initVault(ctx context.Context, cfg *rest.Config, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
+	// For initialization:
+	// - no vault pod must be initialized
+	// - no unseal-key or root-token must exist in the key store, unless overwriteExisting is set
+	// - every unseal-key and the root-token (if storeRootToken is set) must be successfully stored
+	if vs.Spec.Unsealer == nil {
+		return errors.New("vaultServer unsealer spec is empty")
+	}
+
+	ti, err := newTokenKeyInterface(vs, kubeClient)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		ti.Clean()
+	}()
+
+	if !vs.Spec.Unsealer.OverwriteExisting {
+		existing, err := existingKeys(ctx, vs, ti)
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			return errors.Errorf("keys %s already exist, set spec.unsealer.overwriteExisting to overwrite them", strings.Join(existing, ", "))
+		}
+	}
+
+	podNames, err := getVaultPodNames(vs, kubeClient)
+	if err != nil {
+		return err
+	}
+	if len(podNames) == 0 {
+		return errors.Errorf("no vault pod found for vaultserver %s/%s", vs.Namespace, vs.Name)
+	}
+	sort.Strings(podNames)
+
+	client, tunnel, err := NewVaultClientForPod(cfg, kubeClient, vs, podNames[0])
+	if err != nil {
+		return err
+	}
+	defer tunnel.Close()
+
+	initialized, err := client.Sys().InitStatusWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	if initialized {
+		return errors.Errorf("vaultserver %s/%s is already initialized", vs.Namespace, vs.Name)
+	}
+
+	resp, err := client.Sys().InitWithContext(ctx, &vaultclient.InitRequest{
+		SecretShares:    int(vs.Spec.Unsealer.SecretShares),
+		SecretThreshold: int(vs.Spec.Unsealer.SecretThreshold),
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("vaultserver %s/%s successfully initialized\n", vs.Namespace, vs.Name)
+
+	// vault is initialized now and its unseal-keys can't be recovered if they are lost. So they are
+	// stored without ctx, interrupts are held until they are stored, and they are printed otherwise.
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	if err = storeInitKeys(context.Background(), vs, ti, resp); err != nil {
+		printInitKeys(vs, resp)
+		return errors.Wrap(err, "failed to store unseal-keys and root-token, they are printed to stderr instead")
+	}
+	return nil
+}
+
+// storeInitKeys stores the unseal-keys and root-token all together or not at all.
+func storeInitKeys(ctx context.Context, vs *vaultapi.VaultServer, ti api.TokenKeyInterface, resp *vaultclient.InitResponse) error {
+	values := map[string]string{}
+	var names []string
+	for i, key := range resp.Keys {
+		name, err := ti.NewUnsealKeyName(ctx, i)
+		if err != nil {
+			return err
+		}
+		values[name] = key
+		names = append(names, name)
+	}
+
+	var tokenName string
+	if vs.Spec.Unsealer.StoreRootToken {
+		tokenName = ti.NewTokenName(ctx)
+		values[tokenName] = resp.RootToken
+	}
+
+	if err := ti.SetMany(ctx, values); err != nil {
+		return err
+	}
+	for _, name := range names {
+		fmt.Printf("unseal-key with name %s successfully stored\n", name)
+	}
+	if len(tokenName) > 0 {
+		fmt.Printf("root-token with name %s successfully stored\n", tokenName)
+	}
+
+	return nil
+}
+
+// printInitKeys prints the unseal-keys and root-token to stderr, so that they are not lost
+// if they can't be stored.
+func printInitKeys(vs *vaultapi.VaultServer, resp *vaultclient.InitResponse) {
+	fmt.Fprintf(os.Stderr, "WARNING: vaultserver %s/%s is initialized, but its unseal-keys and root-token could not be stored.\n", vs.Namespace, vs.Name)
+	fmt.Fprintln(os.Stderr, "They can't be recovered from vault, keep them safe and store them with `kubectl vault unseal-key set` and `kubectl vault root-token set`:")
+	for i, key := range resp.Keys {
+		fmt.Fprintf(os.Stderr, "unseal-key %d: %s\n", i, key)
+	}
+	fmt.Fprintf(os.Stderr, "root-token: %s\n", resp.RootToken)
+}
+
+// existingKeys returns the names of the unseal-keys and root-token already present in the key store.
+func existingKeys(ctx context.Context, vs *vaultapi.VaultServer, ti api.TokenKeyInterface) ([]string, error) {
+	var names []string
+	for i := 0; int64(i) < vs.Spec.Unsealer.SecretShares; i++ {
+		name, err := ti.NewUnsealKeyName(ctx, i)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	names = append(names, ti.NewTokenName(ctx))
+
+	var existing []string
+	for _, name := range names {
+		_, err := ti.Get(ctx, name)
+		if api.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to check if %s exists", name)
+		}
+		existing = append(existing, name)
+	}
+
+	return existing, nil
+}
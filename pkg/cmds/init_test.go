@@ -0,0 +1,149 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+	"kubevault.dev/cli/pkg/token-keys-store/fake"
+
+	vaultclient "github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+func TestExistingKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  map[string]string
+		getErr  error
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "empty store",
+		},
+		{
+			name: "unseal-keys and root-token",
+			values: map[string]string{
+				"vault-unseal-key-1": "key-1",
+				"vault-root-token":   "token",
+				"vault-unseal-key-7": "out of range",
+				"other-unseal-key-0": "other prefix",
+			},
+			want: []string{"vault-unseal-key-1", "vault-root-token"},
+		},
+		{
+			name:    "read error is not treated as absent",
+			getErr:  errors.New("permission denied"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ti := fake.NewStore(tt.values)
+			ti.Shares = 3
+			ti.GetErr = tt.getErr
+			vs := &vaultapi.VaultServer{}
+			vs.Spec.Unsealer = &vaultapi.UnsealerSpec{SecretShares: 3}
+
+			got, err := existingKeys(t.Context(), vs, ti)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("existingKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("existingKeys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStoreInitKeys(t *testing.T) {
+	resp := &vaultclient.InitResponse{
+		Keys:      []string{"key-0", "key-1", "key-2"},
+		RootToken: "hvs.root",
+	}
+
+	tests := []struct {
+		name           string
+		storeRootToken bool
+		failing        string
+		want           map[string]string
+		wantErr        bool
+	}{
+		{
+			name:           "unseal-keys and root-token",
+			storeRootToken: true,
+			want: map[string]string{
+				"vault-unseal-key-0": "key-0",
+				"vault-unseal-key-1": "key-1",
+				"vault-unseal-key-2": "key-2",
+				"vault-root-token":   "hvs.root",
+			},
+		},
+		{
+			name: "unseal-keys only",
+			want: map[string]string{
+				"vault-unseal-key-0": "key-0",
+				"vault-unseal-key-1": "key-1",
+				"vault-unseal-key-2": "key-2",
+			},
+		},
+		{
+			name:           "nothing is stored if a key can't be written",
+			storeRootToken: true,
+			failing:        "vault-root-token",
+			want:           map[string]string{},
+			wantErr:        true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ti := fake.NewStore(nil)
+			ti.Shares = len(resp.Keys)
+			ti.Failing = tt.failing
+			vs := &vaultapi.VaultServer{}
+			vs.Spec.Unsealer = &vaultapi.UnsealerSpec{
+				SecretShares:   int64(len(resp.Keys)),
+				StoreRootToken: tt.storeRootToken,
+			}
+
+			err := storeInitKeys(t.Context(), vs, ti, resp)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("storeInitKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !maps.Equal(ti.Values, tt.want) {
+				t.Errorf("stored values = %v, want %v", ti.Values, tt.want)
+			}
+		})
+	}
+
+	t.Run("more keys than shares", func(t *testing.T) {
+		ti := fake.NewStore(nil)
+		ti.Shares = 2
+		vs := &vaultapi.VaultServer{}
+		vs.Spec.Unsealer = &vaultapi.UnsealerSpec{SecretShares: 2}
+		if err := storeInitKeys(t.Context(), vs, ti, resp); err == nil {
+			t.Error("storeInitKeys() error = nil, want an error")
+		}
+		if len(ti.Values) > 0 {
+			t.Errorf("stored values = %v, want none", ti.Values)
+		}
+	})
+}
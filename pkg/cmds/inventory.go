@@ -0,0 +1,392 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+	"kubevault.dev/cli/pkg/token-keys-store/api"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	keyFormatNew    = "new"
+	keyFormatLegacy = "legacy"
+
+	keyKindUnsealKey = "unseal-key"
+	keyKindRootToken = "root-token"
+	keyKindOther     = "other"
+
+	keyStatusOK        = "ok"
+	keyStatusMissing   = "missing"
+	keyStatusOrphan    = "orphan"
+	keyStatusDuplicate = "duplicate"
+	keyStatusUnknown   = "unknown"
+)
+
+type inventoryOptions struct {
+	output string
+}
+
+type keyInventory struct {
+	Namespace       string              `json:"namespace"`
+	Name            string              `json:"name"`
+	SecretShares    int64               `json:"secretShares"`
+	SecretThreshold int64               `json:"secretThreshold"`
+	Keys            []keyInventoryEntry `json:"keys"`
+}
+
+type keyInventoryEntry struct {
+	Name         string     `json:"name"`
+	Format       string     `json:"format,omitempty"`
+	Kind         string     `json:"kind"`
+	ID           *int       `json:"id,omitempty"`
+	Status       string     `json:"status"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+}
+
+func newInventoryOptions() *inventoryOptions {
+	return &inventoryOptions{}
+}
+
+func (o *inventoryOptions) addInventoryFlags(fs *pflag.FlagSet) {
+	fs.StringVarP(&o.output, "output", "o", o.output, "output format json/yaml. prints a table otherwise")
+}
+
+func NewCmdInventory(clientGetter genericclioptions.RESTClientGetter) *cobra.Command {
+	o := newInventoryOptions()
+	cmd := &cobra.Command{
+		Use:   "inventory",
+		Short: "show every unseal-key and root-token stored for a vaultserver",
+		Long: `
+$ kubectl vault unseal-key inventory vaultserver <name> -n <namespace> [flags]
+
+Lists the keys stored in the key store under the new and the legacy naming convention and reports
+- missing: an unseal-key or root-token that is stored under neither name
+- orphan: an unseal-key with an id beyond spec.unsealer.secretShares
+- duplicate: an unseal-key or root-token that is stored under both names
+- unknown: any other key derived from the key names, e.g. a staged rekey
+Keys of other vaultservers sharing the name prefix are not shown.
+The last modified time is shown if the key store records it.
+
+Examples:
+ # show the stored keys of the vaultserver
+ $ kubectl vault unseal-key inventory vaultserver vault -n demo
+
+ # show the stored keys in json format
+ $ kubectl vault unseal-key inventory vaultserver vault -n demo -o json
+`,
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				ResourceName = args[0]
+				ObjectNames = args[1:]
+			}
+
+			if err := o.inventory(cmd.Context(), clientGetter); err != nil {
+				Fatal(err)
+			}
+			os.Exit(0)
+		},
+	}
+
+	o.addInventoryFlags(cmd.Flags())
+	return cmd
+}
+
+func (o *inventoryOptions) inventory(ctx context.Context, clientGetter genericclioptions.RESTClientGetter) error {
+	switch o.output {
+	case "", "json", "yaml":
+	default:
+		return errors.Errorf("unknown/unsupported output format %s", o.output)
+	}
+
+	var inventories []keyInventory
+	err := visitVaultServers(clientGetter, func(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
+		inv, err := keyInventoryOf(ctx, vs, kubeClient)
+		if err != nil {
+			return err
+		}
+		inventories = append(inventories, *inv)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return o.Print(inventories)
+}
+
+func keyInventoryOf(ctx context.Context, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) (*keyInventory, error) {
+	ti, err := newTokenKeyInterface(vs, kubeClient)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		ti.Clean()
+	}()
+
+	newTokenName := ti.NewTokenName(ctx)
+	if len(newTokenName) == 0 {
+		return nil, errors.New("failed to get root-token name")
+	}
+	newUnsealKeyName, err := ti.NewUnsealKeyName(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	oldUnsealKeyName, err := ti.OldUnsealKeyName(0)
+	if err != nil {
+		return nil, err
+	}
+
+	formats := map[string]keyNames{
+		keyFormatNew: {
+			rootToken:       newTokenName,
+			unsealKeyPrefix: strings.TrimSuffix(newUnsealKeyName, "0"),
+		},
+		keyFormatLegacy: {
+			rootToken:       ti.OldTokenName(),
+			unsealKeyPrefix: strings.TrimSuffix(oldUnsealKeyName, "0"),
+		},
+	}
+
+	// the listed keys may belong to other vaultservers sharing the name prefix, they are skipped by classifyKey
+	stored := map[string]api.KeyInfo{}
+	for _, names := range formats {
+		keys, err := ti.List(ctx, names.listPrefix())
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			stored[key.Name] = key
+		}
+	}
+
+	shares := vs.Spec.Unsealer.SecretShares
+	inv := &keyInventory{
+		Namespace:       vs.Namespace,
+		Name:            vs.Name,
+		SecretShares:    shares,
+		SecretThreshold: vs.Spec.Unsealer.SecretThreshold,
+	}
+
+	// names of the same unseal-key or root-token in both formats
+	found := map[string][]int{}
+	for _, key := range stored {
+		entry, ok := classifyKey(key.Name, formats)
+		if !ok {
+			continue
+		}
+		if !key.LastModified.IsZero() {
+			entry.LastModified = &key.LastModified
+		}
+		if entry.Kind == keyKindUnsealKey && int64(*entry.ID) >= shares {
+			entry.Status = keyStatusOrphan
+		}
+		if entry.Status == keyStatusOK {
+			id := keyIdentity(entry.Kind, entry.ID)
+			found[id] = append(found[id], len(inv.Keys))
+		}
+		inv.Keys = append(inv.Keys, entry)
+	}
+
+	for _, idx := range found {
+		if len(idx) > 1 {
+			for _, i := range idx {
+				inv.Keys[i].Status = keyStatusDuplicate
+			}
+		}
+	}
+
+	for i := 0; int64(i) < shares; i++ {
+		if _, ok := found[keyIdentity(keyKindUnsealKey, &i)]; !ok {
+			name, err := ti.NewUnsealKeyName(ctx, i)
+			if err != nil {
+				return nil, err
+			}
+			id := i
+			inv.Keys = append(inv.Keys, keyInventoryEntry{
+				Name:   name,
+				Format: keyFormatNew,
+				Kind:   keyKindUnsealKey,
+				ID:     &id,
+				Status: keyStatusMissing,
+			})
+		}
+	}
+	if _, ok := found[keyIdentity(keyKindRootToken, nil)]; !ok {
+		inv.Keys = append(inv.Keys, keyInventoryEntry{
+			Name:   newTokenName,
+			Format: keyFormatNew,
+			Kind:   keyKindRootToken,
+			Status: keyStatusMissing,
+		})
+	}
+
+	sort.Slice(inv.Keys, func(i, j int) bool {
+		a, b := inv.Keys[i], inv.Keys[j]
+		if a.Kind != b.Kind {
+			return a.Kind > b.Kind
+		}
+		if a.ID != nil && b.ID != nil && *a.ID != *b.ID {
+			return *a.ID < *b.ID
+		}
+		return a.Name < b.Name
+	})
+	return inv, nil
+}
+
+// normalizeKeyName returns the key name as stored by every key store.
+// Azure Key Vault stores the dots of the key names as dashes.
+func normalizeKeyName(name string) string {
+	return strings.ReplaceAll(name, ".", "-")
+}
+
+// sameKeyName reports whether a listed key name is the stored name of the key.
+func sameKeyName(listed, key string) bool {
+	return normalizeKeyName(listed) == normalizeKeyName(key)
+}
+
+// keyNames are the names of the keys of a vaultserver in one naming convention,
+// the name of an unseal-key is unsealKeyPrefix followed by its id.
+type keyNames struct {
+	rootToken       string
+	unsealKeyPrefix string
+}
+
+// listPrefix returns the longest common prefix of the root-token and unseal-key names.
+func (n keyNames) listPrefix() string {
+	i := 0
+	for i < len(n.rootToken) && i < len(n.unsealKeyPrefix) && n.rootToken[i] == n.unsealKeyPrefix[i] {
+		i++
+	}
+	return n.rootToken[:i]
+}
+
+// parseKeyID parses the id of an unseal-key, only the canonical decimal form is accepted.
+func parseKeyID(s string) (int, bool) {
+	id, err := strconv.Atoi(s)
+	if err != nil || id < 0 || strconv.Itoa(id) != s {
+		return 0, false
+	}
+	return id, true
+}
+
+// classifyKey finds the format, kind and id of a stored key name. Keys derived from the names of
+// the vaultserver, e.g. a staged rekey, are unknown. It returns false if the key is not of the vaultserver.
+func classifyKey(name string, formats map[string]keyNames) (keyInventoryEntry, bool) {
+	entry := keyInventoryEntry{
+		Name:   name,
+		Kind:   keyKindOther,
+		Status: keyStatusUnknown,
+	}
+
+	listed := normalizeKeyName(name)
+	for _, format := range []string{keyFormatNew, keyFormatLegacy} {
+		names := formats[format]
+		rootToken := normalizeKeyName(names.rootToken)
+		if listed == rootToken {
+			entry.Format, entry.Kind, entry.Status = format, keyKindRootToken, keyStatusOK
+			return entry, true
+		}
+
+		if rest, ok := strings.CutPrefix(listed, normalizeKeyName(names.unsealKeyPrefix)); ok {
+			if id, ok := parseKeyID(rest); ok {
+				entry.Format, entry.Kind, entry.ID, entry.Status = format, keyKindUnsealKey, &id, keyStatusOK
+				return entry, true
+			}
+			if idStr, _, ok := strings.Cut(rest, "-"); ok {
+				if _, ok := parseKeyID(idStr); ok && len(entry.Format) == 0 {
+					entry.Format = format
+				}
+			}
+		}
+		if strings.HasPrefix(listed, rootToken+"-") && len(entry.Format) == 0 {
+			entry.Format = format
+		}
+	}
+	return entry, len(entry.Format) > 0
+}
+
+func keyIdentity(kind string, id *int) string {
+	if id == nil {
+		return kind
+	}
+	return fmt.Sprintf("%s-%d", kind, *id)
+}
+
+func (o *inventoryOptions) Print(inventories []keyInventory) error {
+	switch o.output {
+	case "json":
+		data, err := json.MarshalIndent(inventories, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	case "yaml":
+		data, err := yaml.Marshal(inventories)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+		return nil
+	}
+
+	w := printers.GetNewTabWriter(os.Stdout)
+	for idx, inv := range inventories {
+		if idx > 0 {
+			_, _ = fmt.Fprintln(w)
+		}
+
+		_, _ = fmt.Fprintln(w, "NAMESPACE\tNAME\tSHARES\tTHRESHOLD")
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", inv.Namespace, inv.Name, inv.SecretShares, inv.SecretThreshold)
+
+		_, _ = fmt.Fprintln(w)
+		_, _ = fmt.Fprintln(w, "KEY\tFORMAT\tKIND\tID\tSTATUS\tLAST-MODIFIED")
+		for _, key := range inv.Keys {
+			id, lastModified := "<none>", "<unknown>"
+			if key.ID != nil {
+				id = strconv.Itoa(*key.ID)
+			}
+			if key.LastModified != nil {
+				lastModified = key.LastModified.Format(time.RFC3339)
+			} else if key.Status == keyStatusMissing {
+				lastModified = "<none>"
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", key.Name, orNone(key.Format), key.Kind, id, key.Status, lastModified)
+		}
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,143 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import "testing"
+
+func TestClassifyKey(t *testing.T) {
+	formats := map[string]keyNames{
+		keyFormatNew: {
+			rootToken:       "k8s.kubevault.com.demo.vault-root-token",
+			unsealKeyPrefix: "k8s.kubevault.com.demo.vault-unseal-key-",
+		},
+		keyFormatLegacy: {
+			rootToken:       "vault-root-token",
+			unsealKeyPrefix: "vault-unseal-key-",
+		},
+	}
+
+	id := func(i int) *int {
+		return &i
+	}
+	tests := []struct {
+		name string
+		key  string
+		want keyInventoryEntry
+		ok   bool
+	}{
+		{
+			name: "new root-token",
+			key:  "k8s.kubevault.com.demo.vault-root-token",
+			want: keyInventoryEntry{Format: keyFormatNew, Kind: keyKindRootToken, Status: keyStatusOK},
+			ok:   true,
+		},
+		{
+			name: "new unseal-key",
+			key:  "k8s.kubevault.com.demo.vault-unseal-key-12",
+			want: keyInventoryEntry{Format: keyFormatNew, Kind: keyKindUnsealKey, ID: id(12), Status: keyStatusOK},
+			ok:   true,
+		},
+		{
+			name: "azure key vault name",
+			key:  "k8s-kubevault-com-demo-vault-unseal-key-0",
+			want: keyInventoryEntry{Format: keyFormatNew, Kind: keyKindUnsealKey, ID: id(0), Status: keyStatusOK},
+			ok:   true,
+		},
+		{
+			name: "legacy root-token",
+			key:  "vault-root-token",
+			want: keyInventoryEntry{Format: keyFormatLegacy, Kind: keyKindRootToken, Status: keyStatusOK},
+			ok:   true,
+		},
+		{
+			name: "legacy unseal-key",
+			key:  "vault-unseal-key-3",
+			want: keyInventoryEntry{Format: keyFormatLegacy, Kind: keyKindUnsealKey, ID: id(3), Status: keyStatusOK},
+			ok:   true,
+		},
+		{
+			name: "staged rekey",
+			key:  "k8s.kubevault.com.demo.vault-unseal-key-1-rekey",
+			want: keyInventoryEntry{Format: keyFormatNew, Kind: keyKindOther, Status: keyStatusUnknown},
+			ok:   true,
+		},
+		{
+			name: "staged rotation",
+			key:  "k8s.kubevault.com.demo.vault-root-token-rotate",
+			want: keyInventoryEntry{Format: keyFormatNew, Kind: keyKindOther, Status: keyStatusUnknown},
+			ok:   true,
+		},
+		{
+			name: "non canonical id",
+			key:  "k8s.kubevault.com.demo.vault-unseal-key-01",
+			ok:   false,
+		},
+		{
+			name: "negative id",
+			key:  "k8s.kubevault.com.demo.vault-unseal-key--1",
+			ok:   false,
+		},
+		{
+			name: "other vaultserver sharing the name prefix",
+			key:  "k8s.kubevault.com.demo.vault-2-unseal-key-0",
+			ok:   false,
+		},
+		{
+			name: "other vaultserver root-token",
+			key:  "k8s.kubevault.com.demo.vault-2-root-token",
+			ok:   false,
+		},
+		{
+			name: "legacy name prefix only",
+			key:  "vault-2-root-token",
+			ok:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := classifyKey(tt.key, formats)
+			if ok != tt.ok {
+				t.Fatalf("classifyKey(%s) ok = %v, want %v", tt.key, ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if got.Name != tt.key || got.Format != tt.want.Format || got.Kind != tt.want.Kind || got.Status != tt.want.Status {
+				t.Errorf("classifyKey(%s) = %s/%s/%s, want %s/%s/%s", tt.key, got.Format, got.Kind, got.Status, tt.want.Format, tt.want.Kind, tt.want.Status)
+			}
+			if (got.ID == nil) != (tt.want.ID == nil) || got.ID != nil && *got.ID != *tt.want.ID {
+				t.Errorf("classifyKey(%s) id = %v, want %v", tt.key, got.ID, tt.want.ID)
+			}
+		})
+	}
+}
+
+func TestKeyNamesListPrefix(t *testing.T) {
+	tests := []struct {
+		names keyNames
+		want  string
+	}{
+		{names: keyNames{rootToken: "k8s.c.demo.vault-root-token", unsealKeyPrefix: "k8s.c.demo.vault-unseal-key-"}, want: "k8s.c.demo.vault-"},
+		{names: keyNames{rootToken: "vault-root-token", unsealKeyPrefix: "vault-unseal-key-"}, want: "vault-"},
+		{names: keyNames{rootToken: "ssm-vault-root-token", unsealKeyPrefix: "ssm-vault-unseal-key-"}, want: "ssm-vault-"},
+	}
+	for _, tt := range tests {
+		if got := tt.names.listPrefix(); got != tt.want {
+			t.Errorf("listPrefix() of %s = %s, want %s", tt.names.rootToken, got, tt.want)
+		}
+	}
+}
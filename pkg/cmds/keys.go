@@ -0,0 +1,389 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+	tokenapi "kubevault.dev/cli/pkg/token-keys-store/api"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	keyStatusValid         = "valid"
+	keyStatusInvalid       = "invalid"
+	keyStatusUnchecked     = "unchecked"
+	keyStatusLive          = "live"
+	keyStatusNotApplicable = "not-applicable"
+)
+
+type keyCheck struct {
+	ID     int
+	Name   string
+	Status string
+	Reason string
+
+	value string
+}
+
+type keysVerification struct {
+	Namespace string
+	Name      string
+	Shares    []keyCheck
+	RootToken keyCheck
+}
+
+func (v *keysVerification) failed() bool {
+	for _, share := range v.Shares {
+		if share.Status != keyStatusValid {
+			return true
+		}
+	}
+	return v.RootToken.Status != keyStatusLive && v.RootToken.Status != keyStatusNotApplicable
+}
+
+func NewCmdKeys(clientGetter genericclioptions.RESTClientGetter) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keys",
+		Short: "verify the stored unseal-keys and root-token",
+		Long: `
+$ kubectl vault keys [command] [flags] to verify the stored vault unseal-keys and root-token
+
+Examples:
+ $ kubectl vault keys verify [flags]
+`,
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			_ = cmd.Help()
+			os.Exit(1)
+		},
+	}
+
+	cmd.AddCommand(NewCmdVerifyKeys(clientGetter))
+	return cmd
+}
+
+func NewCmdVerifyKeys(clientGetter genericclioptions.RESTClientGetter) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "verify that the stored unseal-keys and root-token work",
+		Long: `
+$ kubectl vault keys verify vaultserver <name> -n <namespace>
+
+Verifies the unseal-keys by submitting threshold many of them to a sys/generate-root attempt.
+If the attempt completes the submitted unseal-keys are valid shares of the current master key, the
+generated root-token is revoked right away and never printed. Interrupts are held until it is revoked.
+Every other unseal-key is verified by an attempt together with threshold-1 valid unseal-keys.
+The attempts are cancelled if they do not complete. The stored root-token is verified with
+auth/token/lookup-self, it is not applicable if spec.unsealer.storeRootToken is false and no
+root-token is stored.
+
+Exits with a non-zero code if any unseal-key is not valid or the root-token is not live.
+Fails if a root-token generation is already in progress.
+
+Examples:
+ # verify the unseal-keys and root-token of the vaultserver
+ $ kubectl vault keys verify vaultserver vault -n demo
+`,
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				ResourceName = args[0]
+				ObjectNames = args[1:]
+			}
+
+			if err := verifyKeys(cmd.Context(), clientGetter); err != nil {
+				Fatal(err)
+			}
+			os.Exit(0)
+		},
+	}
+
+	return cmd
+}
+
+func verifyKeys(ctx context.Context, clientGetter genericclioptions.RESTClientGetter) error {
+	cfg, err := clientGetter.ToRESTConfig()
+	if err != nil {
+		return errors.Wrap(err, "failed to read kubeconfig")
+	}
+
+	var failed bool
+	err = visitVaultServers(clientGetter, func(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
+		v, err := verifyVaultServerKeys(ctx, cfg, vs, kubeClient)
+		if err != nil {
+			return err
+		}
+		failed = failed || v.failed()
+		return v.Print()
+	})
+	if err != nil {
+		return err
+	}
+	if failed {
+		return errors.New("key verification failed")
+	}
+	return nil
+}
+
+func verifyVaultServerKeys(ctx context.Context, cfg *rest.Config, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) (*keysVerification, error) {
+	if vs.Spec.Unsealer == nil {
+		return nil, errors.New("vaultServer unsealer spec is empty")
+	}
+
+	ti, err := newTokenKeyInterface(vs, kubeClient)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		ti.Clean()
+	}()
+
+	v := &keysVerification{
+		Namespace: vs.Namespace,
+		Name:      vs.Name,
+	}
+
+	var readable []int
+	for i := 0; int64(i) < vs.Spec.Unsealer.SecretShares; i++ {
+		share := keyCheck{ID: i, Status: keyStatusUnchecked}
+		share.Name, err = ti.NewUnsealKeyName(ctx, i)
+		if err != nil {
+			return nil, err
+		}
+		share.value, err = ti.Get(ctx, share.Name)
+		if err != nil {
+			share.Status, share.Reason = keyStatusInvalid, err.Error()
+		} else {
+			readable = append(readable, i)
+		}
+		v.Shares = append(v.Shares, share)
+	}
+
+	v.RootToken = keyCheck{Name: ti.NewTokenName(ctx), Status: keyStatusUnchecked}
+	v.RootToken.value, err = ti.Get(ctx, v.RootToken.Name)
+	if tokenapi.IsNotFound(err) && !vs.Spec.Unsealer.StoreRootToken {
+		v.RootToken.Status, v.RootToken.Reason = keyStatusNotApplicable, "spec.unsealer.storeRootToken is false"
+	} else if err != nil {
+		v.RootToken.Status, v.RootToken.Reason = keyStatusInvalid, err.Error()
+	}
+
+	client, tunnel, err := NewVaultClient(cfg, kubeClient, vs)
+	if err != nil {
+		return nil, err
+	}
+	defer tunnel.Close()
+
+	if err = verifyShares(ctx, client, v.Shares, readable); err != nil {
+		return nil, err
+	}
+
+	if len(v.RootToken.value) > 0 {
+		c, err := client.Clone()
+		if err != nil {
+			return nil, err
+		}
+		c.SetToken(v.RootToken.value)
+		if _, err = c.Auth().Token().LookupSelfWithContext(ctx); err != nil {
+			v.RootToken.Status, v.RootToken.Reason = keyStatusInvalid, err.Error()
+		} else {
+			v.RootToken.Status = keyStatusLive
+		}
+	}
+
+	return v, nil
+}
+
+// verifyShares looks for threshold many readable shares that complete a root-token generation.
+// The other shares are verified one by one together with threshold-1 shares of that combination.
+func verifyShares(ctx context.Context, client *api.Client, shares []keyCheck, readable []int) error {
+	status, err := client.Sys().GenerateRootStatusWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	if status.Started {
+		return errors.New("a root-token generation is already in progress")
+	}
+
+	threshold := status.Required
+	if threshold < 1 || len(readable) < threshold {
+		for _, id := range readable {
+			shares[id].Reason = fmt.Sprintf("found %d readable unseal-keys, threshold %d required", len(readable), threshold)
+		}
+		return nil
+	}
+
+	var valid []int
+	var reason string
+	for _, ids := range combinations(readable, threshold) {
+		keys := make([]string, 0, len(ids))
+		for _, id := range ids {
+			keys = append(keys, shares[id].value)
+		}
+		ok, why, err := tryGenerateRoot(ctx, client, keys)
+		if err != nil {
+			return err
+		}
+		if ok {
+			valid = ids
+			break
+		}
+		reason = why
+	}
+
+	if valid == nil {
+		for _, id := range readable {
+			shares[id].Status = keyStatusInvalid
+			shares[id].Reason = "no threshold combination of the unseal-keys completes: " + reason
+		}
+		return nil
+	}
+
+	for _, id := range valid {
+		shares[id].Status = keyStatusValid
+	}
+
+	base := make([]string, 0, threshold)
+	for _, id := range valid[:threshold-1] {
+		base = append(base, shares[id].value)
+	}
+	for _, id := range readable {
+		if shares[id].Status == keyStatusValid {
+			continue
+		}
+		ok, why, err := tryGenerateRoot(ctx, client, append(base, shares[id].value))
+		if err != nil {
+			return err
+		}
+		if ok {
+			shares[id].Status = keyStatusValid
+		} else {
+			shares[id].Status, shares[id].Reason = keyStatusInvalid, why
+		}
+	}
+	return nil
+}
+
+// tryGenerateRoot submits the keys to a new root-token generation. It reports whether the
+// generation completed and why not otherwise. A generated root-token is revoked immediately,
+// an incomplete generation is cancelled. Errors other than rejected keys are returned.
+func tryGenerateRoot(ctx context.Context, client *api.Client, keys []string) (bool, string, error) {
+	// the last key may generate a root-token, so interrupts are held until it is revoked
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	status, err := client.Sys().GenerateRootInitWithContext(ctx, "", "")
+	if err != nil {
+		return false, "", err
+	}
+	otp := status.OTP
+
+	for i, key := range keys {
+		// the last key is submitted without ctx, so that a generated root-token is never lost
+		keyCtx := ctx
+		if i == len(keys)-1 {
+			keyCtx = context.Background()
+		}
+
+		progress := status.Progress
+		status, err = client.Sys().GenerateRootUpdateWithContext(keyCtx, key, status.Nonce)
+		if err != nil {
+			// the attempt is cancelled without ctx, so that it is also cleaned up on interrupt
+			_ = client.Sys().GenerateRootCancel()
+
+			var respErr *api.ResponseError
+			if errors.As(err, &respErr) && respErr.StatusCode == http.StatusBadRequest {
+				return false, fmt.Sprint(respErr.Errors), nil
+			}
+			return false, "", err
+		}
+		if !status.Complete && status.Progress != progress+1 {
+			_ = client.Sys().GenerateRootCancel()
+			return false, fmt.Sprintf("progress %d/%d after submitting unseal-key", status.Progress, status.Required), nil
+		}
+	}
+
+	if !status.Complete {
+		_ = client.Sys().GenerateRootCancel()
+		return false, fmt.Sprintf("generation not complete at progress %d/%d", status.Progress, status.Required), nil
+	}
+
+	token, err := decodeRootToken(status.EncodedToken, otp)
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to decode generated root-token, it must be revoked manually")
+	}
+	c, err := client.Clone()
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to revoke generated root-token, it must be revoked manually")
+	}
+	c.SetToken(token)
+	// the generated root-token is revoked without ctx, so that it is also revoked on interrupt
+	if err = c.Auth().Token().RevokeSelfWithContext(context.Background(), ""); err != nil {
+		return false, "", errors.Wrap(err, "failed to revoke generated root-token, it must be revoked manually")
+	}
+	return true, "", nil
+}
+
+// combinations returns every subset of ids with k elements in lexicographic order.
+func combinations(ids []int, k int) [][]int {
+	var result [][]int
+	var cur []int
+	var walk func(start int)
+	walk = func(start int) {
+		if len(cur) == k {
+			result = append(result, append([]int(nil), cur...))
+			return
+		}
+		for i := start; i <= len(ids)-(k-len(cur)); i++ {
+			cur = append(cur, ids[i])
+			walk(i + 1)
+			cur = cur[:len(cur)-1]
+		}
+	}
+	walk(0)
+	return result
+}
+
+func (v *keysVerification) Print() error {
+	w := printers.GetNewTabWriter(os.Stdout)
+	_, _ = fmt.Fprintf(w, "vaultserver %s/%s\n", v.Namespace, v.Name)
+	_, _ = fmt.Fprintln(w, "SHARE\tKEY\tSTATUS\tREASON")
+	for _, share := range v.Shares {
+		_, _ = fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", share.ID, share.Name, share.Status, orNone(share.Reason))
+	}
+
+	_, _ = fmt.Fprintln(w)
+	_, _ = fmt.Fprintln(w, "ROOT-TOKEN\tSTATUS\tREASON")
+	_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", v.RootToken.Name, v.RootToken.Status, orNone(v.RootToken.Reason))
+	_, _ = fmt.Fprintln(w)
+	return w.Flush()
+}
@@ -0,0 +1,258 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/sdk/helper/xor"
+)
+
+func TestKeysVerificationFailed(t *testing.T) {
+	accepted := []keyCheck{{Status: keyStatusValid}, {Status: keyStatusValid}}
+	tests := []struct {
+		name   string
+		shares []keyCheck
+		token  string
+		want   bool
+	}{
+		{name: "all accepted and live root-token", shares: accepted, token: keyStatusLive, want: false},
+		{name: "root-token not stored", shares: accepted, token: keyStatusNotApplicable, want: false},
+		{name: "invalid root-token", shares: accepted, token: keyStatusInvalid, want: true},
+		{name: "unchecked root-token", shares: accepted, token: keyStatusUnchecked, want: true},
+		{name: "invalid share", shares: []keyCheck{{Status: keyStatusValid}, {Status: keyStatusInvalid}}, token: keyStatusLive, want: true},
+		{name: "unchecked share", shares: []keyCheck{{Status: keyStatusUnchecked}}, token: keyStatusLive, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &keysVerification{Shares: tt.shares, RootToken: keyCheck{Status: tt.token}}
+			if got := v.failed(); got != tt.want {
+				t.Errorf("failed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeGenerateRoot serves sys/generate-root and auth/token/revoke-self. Like vault, it only
+// combines the shares at the threshold, a generation that includes a share starting with "bad"
+// is rejected then.
+type fakeGenerateRoot struct {
+	mu        sync.Mutex
+	required  int
+	started   bool
+	progress  int
+	keys      []string
+	attempts  int
+	generated int
+	revoked   int
+}
+
+const (
+	fakeOTP       = "abcdefghijklmnopqrstuvwxyz01"
+	fakeRootToken = "hvs.generatedroottoken123456"
+)
+
+func (f *fakeGenerateRoot) status() api.GenerateRootStatusResponse {
+	return api.GenerateRootStatusResponse{
+		Nonce:    "nonce",
+		Started:  f.started,
+		Progress: f.progress,
+		Required: f.required,
+	}
+}
+
+func (f *fakeGenerateRoot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	status := f.status()
+	switch {
+	case r.URL.Path == "/v1/sys/generate-root/attempt" && r.Method == http.MethodGet:
+	case r.URL.Path == "/v1/sys/generate-root/attempt" && r.Method == http.MethodPut:
+		f.started, f.progress, f.keys = true, 0, nil
+		f.attempts++
+		status = f.status()
+		status.OTP = fakeOTP
+	case r.URL.Path == "/v1/sys/generate-root/attempt" && r.Method == http.MethodDelete:
+		f.started, f.progress, f.keys = false, 0, nil
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case r.URL.Path == "/v1/sys/generate-root/update" && r.Method == http.MethodPut:
+		var req struct {
+			Key string `json:"key"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if !f.started {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":["no root generation in progress"]}`))
+			return
+		}
+		f.keys = append(f.keys, req.Key)
+		f.progress++
+		if f.progress < f.required {
+			status = f.status()
+			break
+		}
+
+		keys := f.keys
+		f.started, f.progress, f.keys = false, 0, nil
+		for _, key := range keys {
+			if strings.HasPrefix(key, "bad") {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"errors":["root key verification failed"]}`))
+				return
+			}
+		}
+		f.generated++
+		encoded, _ := xor.XORBytes([]byte(fakeRootToken), []byte(fakeOTP))
+		status = f.status()
+		status.Complete = true
+		status.EncodedToken = base64.RawStdEncoding.EncodeToString(encoded)
+	case r.URL.Path == "/v1/auth/token/revoke-self" && r.Method == http.MethodPut:
+		if r.Header.Get("X-Vault-Token") == fakeRootToken {
+			f.revoked++
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+func TestVerifyShares(t *testing.T) {
+	tests := []struct {
+		name          string
+		required      int
+		started       bool
+		keys          []string
+		want          []string
+		wantAttempts  int
+		wantGenerated int
+		wantErr       bool
+	}{
+		{
+			name:          "threshold 3",
+			required:      3,
+			keys:          []string{"k0", "k1", "k2", "k3", "k4"},
+			want:          []string{keyStatusValid, keyStatusValid, keyStatusValid, keyStatusValid, keyStatusValid},
+			wantAttempts:  3,
+			wantGenerated: 3,
+		},
+		{
+			// a stale share is only detected at the threshold
+			name:          "stale share",
+			required:      3,
+			keys:          []string{"k0", "bad1", "k2", "k3"},
+			want:          []string{keyStatusValid, keyStatusInvalid, keyStatusValid, keyStatusValid},
+			wantAttempts:  4,
+			wantGenerated: 1,
+		},
+		{
+			name:          "threshold 1",
+			required:      1,
+			keys:          []string{"k0", "bad1"},
+			want:          []string{keyStatusValid, keyStatusInvalid},
+			wantAttempts:  2,
+			wantGenerated: 1,
+		},
+		{
+			name:         "no valid combination",
+			required:     2,
+			keys:         []string{"k0", "bad1"},
+			want:         []string{keyStatusInvalid, keyStatusInvalid},
+			wantAttempts: 1,
+		},
+		{
+			name:     "fewer shares than the threshold",
+			required: 3,
+			keys:     []string{"k0", "k1"},
+			want:     []string{keyStatusUnchecked, keyStatusUnchecked},
+		},
+		{
+			name:     "generation in progress",
+			required: 3,
+			started:  true,
+			keys:     []string{"k0"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGenerateRoot{required: tt.required, started: tt.started}
+			srv := httptest.NewServer(fake)
+			defer srv.Close()
+
+			cfg := api.DefaultConfig()
+			cfg.Address = srv.URL
+			client, err := api.NewClient(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var shares []keyCheck
+			var readable []int
+			for i, key := range tt.keys {
+				shares = append(shares, keyCheck{ID: i, Status: keyStatusUnchecked, value: key})
+				readable = append(readable, i)
+			}
+
+			err = verifyShares(context.Background(), client, shares, readable)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyShares() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if fake.revoked != fake.generated {
+				t.Errorf("verifyShares() revoked %d of %d generated root-tokens", fake.revoked, fake.generated)
+			}
+			if tt.wantErr {
+				return
+			}
+			if fake.started {
+				t.Error("verifyShares() left a root-token generation in progress")
+			}
+			if fake.attempts != tt.wantAttempts {
+				t.Errorf("verifyShares() started %d attempts, want %d", fake.attempts, tt.wantAttempts)
+			}
+			if fake.generated != tt.wantGenerated {
+				t.Errorf("verifyShares() generated %d root-tokens, want %d", fake.generated, tt.wantGenerated)
+			}
+			for i, share := range shares {
+				if share.Status != tt.want[i] {
+					t.Errorf("share %d status = %s, want %s", i, share.Status, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCombinations(t *testing.T) {
+	got := combinations([]int{0, 2, 3, 5}, 2)
+	want := [][]int{{0, 2}, {0, 3}, {0, 5}, {2, 3}, {2, 5}, {3, 5}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("combinations() = %v, want %v", got, want)
+	}
+}
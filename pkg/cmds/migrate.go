@@ -0,0 +1,342 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+	token_key_store "kubevault.dev/cli/pkg/token-keys-store"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	modeKubernetesSecret = "kubernetesSecret"
+	modeAwsKmsSsm        = "awsKmsSsm"
+	modeGoogleKmsGcs     = "googleKmsGcs"
+	modeAzureKeyVault    = "azureKeyVault"
+
+	patchNone  = "none"
+	patchPrint = "print"
+	patchApply = "apply"
+)
+
+type migrateOptions struct {
+	toMode        string
+	specFile      string
+	toStoreConfig string
+	patch         string
+}
+
+func newMigrateOptions() *migrateOptions {
+	return &migrateOptions{
+		patch: patchNone,
+	}
+}
+
+func (o *migrateOptions) addMigrateFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.toMode, "to-mode", o.toMode, "unsealer mode to migrate to: kubernetesSecret, awsKmsSsm, googleKmsGcs or azureKeyVault")
+	fs.StringVar(&o.specFile, "spec-file", o.specFile, "yaml/json file containing the unsealer mode spec to migrate to")
+	fs.StringVar(&o.toStoreConfig, "to-store-config", o.toStoreConfig, "yaml/json key store config file to migrate to instead of an unsealer mode, e.g. an encrypted local backup")
+	fs.StringVar(&o.patch, "patch", o.patch, "print or apply the vaultserver patch that switches spec.unsealer.mode: none, print or apply")
+}
+
+func NewCmdMigrateKeys(clientGetter genericclioptions.RESTClientGetter) *cobra.Command {
+	o := newMigrateOptions()
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "migrate vault unseal-keys and root-token to another unsealer mode",
+		Long: `
+$ kubectl vault unseal-key migrate vaultserver <name> -n <namespace> --to-mode=<mode> --spec-file=<file> [flags]
+
+Copies every unseal-key and the root-token from the current key store to the key store described by
+the spec file, then reads them back from the new key store to verify them.
+
+The spec file contains the unsealer mode, for example:
+ awsKmsSsm:
+   kmsKeyID: 65ed2c85-4915-4e82-be47-d56ccaa8019b
+   region: us-west-1
+   credentialSecretRef:
+     name: aws-cred
+
+Examples:
+ # migrate the unseal-keys and root-token of a vaultserver with name vault in demo namespace to aws kms ssm
+ $ kubectl vault unseal-key migrate vaultserver vault -n demo --to-mode=awsKmsSsm --spec-file=aws.yaml
+
+ # migrate and switch the vaultserver to the new unsealer mode
+ $ kubectl vault unseal-key migrate vaultserver vault -n demo --to-mode=awsKmsSsm --spec-file=aws.yaml --patch=apply
+
+ # back up the unseal-keys and root-token to a passphrase encrypted local directory
+ # store.yaml:
+ #  localEncrypted:
+ #    directory: ./vault-keys
+ #    passphraseFile: ./passphrase
+ $ kubectl vault unseal-key migrate vaultserver vault -n demo --to-store-config=store.yaml
+
+ # restore the unseal-keys and root-token from the backup into the key store of the current unsealer mode
+ $ kubectl vault unseal-key migrate vaultserver vault -n demo --key-store-config=store.yaml --to-mode=awsKmsSsm --spec-file=aws.yaml
+`,
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				ResourceName = args[0]
+				ObjectNames = args[1:]
+			}
+
+			if err := o.migrate(cmd.Context(), clientGetter); err != nil {
+				Fatal(err)
+			}
+			os.Exit(0)
+		},
+	}
+
+	o.addMigrateFlags(cmd.Flags())
+	return cmd
+}
+
+func (o *migrateOptions) migrate(ctx context.Context, clientGetter genericclioptions.RESTClientGetter) error {
+	switch o.patch {
+	case patchNone, patchPrint, patchApply:
+	default:
+		return errors.Errorf("unknown/unsupported patch option %s", o.patch)
+	}
+
+	var mode *vaultapi.ModeSpec
+	var storeConfig *token_key_store.StoreConfig
+	var err error
+	if len(o.toStoreConfig) > 0 {
+		if len(o.specFile) > 0 || len(o.toMode) > 0 {
+			return errors.New("--to-store-config can't be used with --to-mode or --spec-file")
+		}
+		if o.patch != patchNone {
+			return errors.New("--patch can't be used with --to-store-config")
+		}
+		if storeConfig, err = token_key_store.ReadStoreConfig(o.toStoreConfig); err != nil {
+			return err
+		}
+	} else if mode, err = o.readModeSpec(); err != nil {
+		return err
+	}
+
+	return visitVaultServerResources(clientGetter, vaultServerSelector{}, func(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface, vsHelper *resource.Helper) error {
+		return o.migrateKeys(ctx, vs, mode, storeConfig, kubeClient, vsHelper)
+	})
+}
+
+// readModeSpec reads the target unsealer mode from the spec file and
+// ensures that it contains exactly the mode given by --to-mode.
+func (o *migrateOptions) readModeSpec() (*vaultapi.ModeSpec, error) {
+	if len(o.specFile) == 0 {
+		return nil, errors.New("--spec-file is required")
+	}
+
+	data, err := os.ReadFile(o.specFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var mode vaultapi.ModeSpec
+	if err = yaml.UnmarshalStrict(data, &mode); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse spec file %s", o.specFile)
+	}
+
+	modes := modeNames(&mode)
+	if len(modes) != 1 {
+		return nil, errors.Errorf("spec file %s must contain exactly one unsealer mode, found %d", o.specFile, len(modes))
+	}
+
+	if !strings.EqualFold(modes[0], o.toMode) {
+		return nil, errors.Errorf("--to-mode %s doesn't match mode %s of spec file %s", o.toMode, modes[0], o.specFile)
+	}
+
+	return &mode, nil
+}
+
+func (o *migrateOptions) migrateKeys(ctx context.Context, vs *vaultapi.VaultServer, mode *vaultapi.ModeSpec, storeConfig *token_key_store.StoreConfig, kubeClient kubernetes.Interface, vsHelper *resource.Helper) error {
+	// For migration:
+	// - every unseal-key must be present in the current key store
+	// - root-token must be present in the current key store if storeRootToken is set
+	// - every key written to the new key store must be read back successfully
+	if vs.Spec.Unsealer == nil {
+		return errors.New("vaultServer unsealer spec is empty")
+	}
+
+	src, err := newTokenKeyInterface(vs, kubeClient)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		src.Clean()
+	}()
+
+	target := o.toMode
+	targetVS := vs.DeepCopy()
+	if mode != nil {
+		targetVS.Spec.Unsealer.Mode = *mode
+	} else {
+		target = o.toStoreConfig
+	}
+
+	dst, err := token_key_store.NewTokenKeyInterfaceForConfig(targetVS, kubeClient, storeConfig)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		dst.Clean()
+	}()
+
+	type keyPair struct {
+		srcName string
+		dstName string
+		value   string
+	}
+
+	var pairs []keyPair
+	for i := 0; int64(i) < vs.Spec.Unsealer.SecretShares; i++ {
+		srcName, err := src.NewUnsealKeyName(ctx, i)
+		if err != nil {
+			return err
+		}
+
+		dstName, err := dst.NewUnsealKeyName(ctx, i)
+		if err != nil {
+			return err
+		}
+
+		value, err := src.Get(ctx, srcName)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read unseal-key %s", srcName)
+		}
+
+		pairs = append(pairs, keyPair{srcName: srcName, dstName: dstName, value: value})
+	}
+
+	srcName := src.NewTokenName(ctx)
+	value, err := src.Get(ctx, srcName)
+	if err != nil {
+		if vs.Spec.Unsealer.StoreRootToken {
+			return errors.Wrapf(err, "failed to read root-token %s", srcName)
+		}
+		fmt.Printf("root-token %s not found, skipping\n", srcName)
+	} else {
+		pairs = append(pairs, keyPair{srcName: srcName, dstName: dst.NewTokenName(ctx), value: value})
+	}
+
+	values := map[string]string{}
+	for _, p := range pairs {
+		values[p.dstName] = p.value
+	}
+	if err = dst.SetMany(ctx, values); err != nil {
+		return errors.Wrap(err, "failed to write the unseal-keys and root-token")
+	}
+
+	for _, p := range pairs {
+		got, err := dst.Get(ctx, p.dstName)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read back %s", p.dstName)
+		}
+		if got != p.value {
+			return errors.Errorf("%s in the new key store doesn't match %s", p.dstName, p.srcName)
+		}
+
+		fmt.Printf("%s successfully migrated to %s\n", p.srcName, p.dstName)
+	}
+
+	fmt.Printf("successfully migrated unseal-keys and root-token of vaultserver %s/%s to %s\n", vs.Namespace, vs.Name, target)
+
+	if o.patch == patchNone {
+		return nil
+	}
+
+	patch, err := modePatch(vs.Spec.Unsealer.Mode, *mode)
+	if err != nil {
+		return err
+	}
+
+	if o.patch == patchPrint {
+		fmt.Println(string(patch))
+		return nil
+	}
+
+	// the VaultServer is patched with the api version served by the cluster
+	_, err = vsHelper.Patch(vs.Namespace, vs.Name, types.MergePatchType, patch, &metav1.PatchOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to update unsealer mode of vaultserver %s/%s", vs.Namespace, vs.Name)
+	}
+
+	fmt.Printf("vaultserver %s/%s unsealer mode switched to %s\n", vs.Namespace, vs.Name, o.toMode)
+	return nil
+}
+
+// modePatch returns a json merge patch that replaces the current unsealer mode with the new one.
+func modePatch(cur, mode vaultapi.ModeSpec) ([]byte, error) {
+	data, err := json.Marshal(mode)
+	if err != nil {
+		return nil, err
+	}
+
+	modeMap := map[string]any{}
+	if err = json.Unmarshal(data, &modeMap); err != nil {
+		return nil, err
+	}
+
+	for _, name := range modeNames(&cur) {
+		if _, ok := modeMap[name]; !ok {
+			modeMap[name] = nil
+		}
+	}
+
+	return json.Marshal(map[string]any{
+		"spec": map[string]any{
+			"unsealer": map[string]any{
+				"mode": modeMap,
+			},
+		},
+	})
+}
+
+func modeNames(mode *vaultapi.ModeSpec) []string {
+	var names []string
+	if mode.KubernetesSecret != nil {
+		names = append(names, modeKubernetesSecret)
+	}
+	if mode.AwsKmsSsm != nil {
+		names = append(names, modeAwsKmsSsm)
+	}
+	if mode.GoogleKmsGcs != nil {
+		names = append(names, modeGoogleKmsGcs)
+	}
+	if mode.AzureKeyVault != nil {
+		names = append(names, modeAzureKeyVault)
+	}
+	return names
+}
@@ -0,0 +1,152 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+)
+
+func TestReadModeSpec(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		toMode  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "matching mode",
+			spec:   "awsKmsSsm:\n  kmsKeyID: key\n  region: us-east-1\n",
+			toMode: modeAwsKmsSsm,
+			want:   modeAwsKmsSsm,
+		},
+		{
+			name:   "mode is case insensitive",
+			spec:   "kubernetesSecret:\n  secretName: vault-keys\n",
+			toMode: "kubernetessecret",
+			want:   modeKubernetesSecret,
+		},
+		{
+			name:    "other mode",
+			spec:    "kubernetesSecret:\n  secretName: vault-keys\n",
+			toMode:  modeAwsKmsSsm,
+			wantErr: true,
+		},
+		{
+			name:    "two modes",
+			spec:    "kubernetesSecret:\n  secretName: vault-keys\nawsKmsSsm:\n  kmsKeyID: key\n",
+			toMode:  modeKubernetesSecret,
+			wantErr: true,
+		},
+		{
+			name:    "no mode",
+			spec:    "{}\n",
+			toMode:  modeKubernetesSecret,
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			spec:    "kubernetesSecret:\n  secret: vault-keys\n",
+			toMode:  modeKubernetesSecret,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			specFile := filepath.Join(t.TempDir(), "mode.yaml")
+			if err := os.WriteFile(specFile, []byte(tt.spec), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			o := &migrateOptions{toMode: tt.toMode, specFile: specFile}
+			mode, err := o.readModeSpec()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readModeSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := modeNames(mode); len(got) != 1 || got[0] != tt.want {
+				t.Errorf("readModeSpec() modes = %v, want [%s]", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("missing spec file", func(t *testing.T) {
+		o := &migrateOptions{toMode: modeKubernetesSecret}
+		if _, err := o.readModeSpec(); err == nil {
+			t.Error("readModeSpec() error = nil, want an error")
+		}
+	})
+}
+
+func TestModePatch(t *testing.T) {
+	secretMode := vaultapi.ModeSpec{KubernetesSecret: &vaultapi.KubernetesSecretSpec{SecretName: "vault-keys"}}
+	awsMode := vaultapi.ModeSpec{AwsKmsSsm: &vaultapi.AwsKmsSsmSpec{KmsKeyID: "key"}}
+
+	tests := []struct {
+		name string
+		cur  vaultapi.ModeSpec
+		mode vaultapi.ModeSpec
+		want string
+	}{
+		{
+			name: "other mode is removed",
+			cur:  secretMode,
+			mode: awsMode,
+			want: `{"spec":{"unsealer":{"mode":{"awsKmsSsm":{"kmsKeyID":"key"},"kubernetesSecret":null}}}}`,
+		},
+		{
+			name: "same mode is replaced",
+			cur:  vaultapi.ModeSpec{KubernetesSecret: &vaultapi.KubernetesSecretSpec{SecretName: "old-keys"}},
+			mode: secretMode,
+			want: `{"spec":{"unsealer":{"mode":{"kubernetesSecret":{"secretName":"vault-keys"}}}}}`,
+		},
+		{
+			name: "no current mode",
+			mode: awsMode,
+			want: `{"spec":{"unsealer":{"mode":{"awsKmsSsm":{"kmsKeyID":"key"}}}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := modePatch(tt.cur, tt.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// compare the decoded patches, the key order of json objects doesn't matter
+			var got, want any
+			if err := json.Unmarshal(patch, &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(want)
+			if string(gotJSON) != string(wantJSON) {
+				t.Errorf("modePatch() = %s, want %s", patch, tt.want)
+			}
+		})
+	}
+}
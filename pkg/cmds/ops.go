@@ -0,0 +1,377 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+	opsapi "kubevault.dev/apimachinery/apis/ops/v1alpha1"
+	"kubevault.dev/apimachinery/client/clientset/versioned/scheme"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// The exit codes of the ops commands for the final phase of the VaultOpsRequest.
+// Any other error exits with 1.
+const (
+	opsExitFailed = 2
+	opsExitDenied = 3
+)
+
+type opsOptions struct {
+	timeout time.Duration
+	noWait  bool
+}
+
+type reconfigureTLSOptions struct {
+	*opsOptions
+	rotateCertificates bool
+	remove             bool
+}
+
+// opsPhaseError is returned when a VaultOpsRequest ends in a phase other than Successful.
+type opsPhaseError struct {
+	req *opsapi.VaultOpsRequest
+}
+
+func (e *opsPhaseError) Error() string {
+	return fmt.Sprintf("vaultopsrequest %s/%s %s", e.req.Namespace, e.req.Name, e.req.Status.Phase)
+}
+
+func (e *opsPhaseError) exitCode() int {
+	if e.req.Status.Phase == opsapi.OpsRequestDenied {
+		return opsExitDenied
+	}
+	return opsExitFailed
+}
+
+func newOpsOptions() *opsOptions {
+	return &opsOptions{}
+}
+
+func newReconfigureTLSOptions() *reconfigureTLSOptions {
+	return &reconfigureTLSOptions{
+		opsOptions: newOpsOptions(),
+	}
+}
+
+func (o *opsOptions) addOpsFlags(fs *pflag.FlagSet) {
+	fs.DurationVar(&o.timeout, "timeout", o.timeout, "timeout for each step of the ops request, e.g. 5m. the operator default is used otherwise")
+	fs.BoolVar(&o.noWait, "no-wait", o.noWait, "create the ops request without following it until it finishes")
+}
+
+func (o *reconfigureTLSOptions) addReconfigureTLSFlags(fs *pflag.FlagSet) {
+	o.addOpsFlags(fs)
+	fs.BoolVar(&o.rotateCertificates, "rotate-certificates", o.rotateCertificates, "rotate the tls certificates of the vaultserver")
+	fs.BoolVar(&o.remove, "remove", o.remove, "remove the tls configuration of the vaultserver")
+}
+
+func NewCmdOps(clientGetter genericclioptions.RESTClientGetter) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ops",
+		Short: "create and follow vault ops requests",
+		Long: `
+$ kubectl vault ops [command] [flags] to create a vaultopsrequest for a vaultserver and follow it until it finishes
+
+The progress of the vaultopsrequest is shown per condition. Exits with
+ 0 if the vaultopsrequest is Successful
+ 1 on any other error
+ 2 if the vaultopsrequest Failed
+ 3 if the vaultopsrequest is Denied
+
+Examples:
+ $ kubectl vault ops restart [flags]
+ $ kubectl vault ops reconfigure-tls [flags]
+`,
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			_ = cmd.Help()
+			os.Exit(1)
+		},
+	}
+
+	cmd.AddCommand(NewCmdOpsRestart(clientGetter))
+	cmd.AddCommand(NewCmdOpsReconfigureTLS(clientGetter))
+	return cmd
+}
+
+func NewCmdOpsRestart(clientGetter genericclioptions.RESTClientGetter) *cobra.Command {
+	o := newOpsOptions()
+	cmd := &cobra.Command{
+		Use:   "restart",
+		Short: "restart the vaultserver pods with a vaultopsrequest",
+		Long: `
+$ kubectl vault ops restart vaultserver <name> -n <namespace> [flags]
+
+Examples:
+ # restart the pods of the vaultserver and wait until they are restarted
+ $ kubectl vault ops restart vaultserver vault -n demo
+
+ # restart with a timeout of 10 minutes for each step
+ $ kubectl vault ops restart vaultserver vault -n demo --timeout=10m
+`,
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				ResourceName = args[0]
+				ObjectNames = args[1:]
+			}
+
+			runOps(cmd.Context(), clientGetter, o, func(spec *opsapi.VaultOpsRequestSpec) {
+				spec.Type = opsapi.OpsRequestTypeRestart
+				spec.Restart = &opsapi.RestartSpec{}
+			})
+		},
+	}
+
+	o.addOpsFlags(cmd.Flags())
+	return cmd
+}
+
+func NewCmdOpsReconfigureTLS(clientGetter genericclioptions.RESTClientGetter) *cobra.Command {
+	o := newReconfigureTLSOptions()
+	cmd := &cobra.Command{
+		Use:   "reconfigure-tls",
+		Short: "rotate the certificates or remove tls of the vaultserver with a vaultopsrequest",
+		Long: `
+$ kubectl vault ops reconfigure-tls vaultserver <name> -n <namespace> --rotate-certificates|--remove [flags]
+
+Examples:
+ # rotate the tls certificates of the vaultserver
+ $ kubectl vault ops reconfigure-tls vaultserver vault -n demo --rotate-certificates
+
+ # remove tls from the vaultserver, without waiting for the vaultopsrequest to finish
+ $ kubectl vault ops reconfigure-tls vaultserver vault -n demo --remove --no-wait
+`,
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				ResourceName = args[0]
+				ObjectNames = args[1:]
+			}
+
+			if o.rotateCertificates == o.remove {
+				Fatal(errors.New("exactly one of --rotate-certificates and --remove is required"))
+			}
+
+			runOps(cmd.Context(), clientGetter, o.opsOptions, func(spec *opsapi.VaultOpsRequestSpec) {
+				spec.Type = opsapi.OpsRequestTypeReconfigureTLSs
+				spec.TLS = &opsapi.TLSSpec{
+					RotateCertificates: o.rotateCertificates,
+					Remove:             o.remove,
+				}
+			})
+		},
+	}
+
+	o.addReconfigureTLSFlags(cmd.Flags())
+	return cmd
+}
+
+// runOps creates the vaultopsrequests and exits with the code of their final phase.
+func runOps(ctx context.Context, clientGetter genericclioptions.RESTClientGetter, o *opsOptions, setSpec func(spec *opsapi.VaultOpsRequestSpec)) {
+	err := o.createOpsRequests(ctx, clientGetter, setSpec)
+	var phaseErr *opsPhaseError
+	if errors.As(err, &phaseErr) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(phaseErr.exitCode())
+	}
+	if err != nil {
+		Fatal(err)
+	}
+	os.Exit(0)
+}
+
+func (o *opsOptions) createOpsRequests(ctx context.Context, clientGetter genericclioptions.RESTClientGetter, setSpec func(spec *opsapi.VaultOpsRequestSpec)) error {
+	cfg, err := clientGetter.ToRESTConfig()
+	if err != nil {
+		return errors.Wrap(err, "failed to read kubeconfig")
+	}
+
+	opsClient, err := newOpsClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	return visitVaultServers(clientGetter, func(vs *vaultapi.VaultServer, _ kubernetes.Interface) error {
+		req := &opsapi.VaultOpsRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: vs.Name + "-",
+				Namespace:    vs.Namespace,
+			},
+			Spec: opsapi.VaultOpsRequestSpec{
+				VaultRef: core.LocalObjectReference{Name: vs.Name},
+			},
+		}
+		setSpec(&req.Spec)
+		if o.timeout > 0 {
+			req.Spec.Timeout = &metav1.Duration{Duration: o.timeout}
+		}
+
+		result := &opsapi.VaultOpsRequest{}
+		err := opsClient.Post().
+			Namespace(vs.Namespace).
+			Resource(opsapi.ResourcePluralVaultOpsRequest).
+			Body(req).
+			Do(ctx).
+			Into(result)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create %s vaultopsrequest for vaultserver %s/%s", req.Spec.Type, vs.Namespace, vs.Name)
+		}
+		fmt.Printf("vaultopsrequest %s/%s created\n", result.Namespace, result.Name)
+
+		if o.noWait {
+			return nil
+		}
+		return followOpsRequest(ctx, opsClient, result)
+	})
+}
+
+// newOpsClient returns a rest client for the ops api group.
+func newOpsClient(cfg *rest.Config) (rest.Interface, error) {
+	config := rest.CopyConfig(cfg)
+	config.GroupVersion = &opsapi.SchemeGroupVersion
+	config.APIPath = "/apis"
+	config.NegotiatedSerializer = scheme.Codecs.WithoutConversion()
+	if config.UserAgent == "" {
+		config.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+	return rest.RESTClientFor(config)
+}
+
+// followOpsRequest watches the vaultopsrequest and prints its phase and condition changes
+// until it is Successful, Failed or Denied. The watch is started again from the last seen
+// resource version if the server closes it.
+func followOpsRequest(ctx context.Context, c rest.Interface, req *opsapi.VaultOpsRequest) error {
+	p := &opsProgress{conditions: map[string]string{}}
+	for {
+		if p.report(req) {
+			break
+		}
+		if ctx.Err() != nil {
+			return errors.Errorf("stopped following vaultopsrequest %s/%s, it continues in the cluster", req.Namespace, req.Name)
+		}
+
+		w, err := c.Get().
+			Namespace(req.Namespace).
+			Resource(opsapi.ResourcePluralVaultOpsRequest).
+			VersionedParams(&metav1.ListOptions{
+				FieldSelector:   fields.OneTermEqualSelector("metadata.name", req.Name).String(),
+				ResourceVersion: req.ResourceVersion,
+				Watch:           true,
+			}, scheme.ParameterCodec).
+			Watch(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			return err
+		}
+
+		done, err := p.follow(w, req)
+		w.Stop()
+		if err != nil {
+			if !kerr.IsResourceExpired(err) && !kerr.IsGone(err) {
+				return err
+			}
+			// the resource version is too old to watch from, the vaultopsrequest is read again
+			err = c.Get().Namespace(req.Namespace).Resource(opsapi.ResourcePluralVaultOpsRequest).Name(req.Name).Do(ctx).Into(req)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if done {
+			break
+		}
+	}
+
+	if req.Status.Phase != opsapi.OpsRequestPhaseSuccessful {
+		return &opsPhaseError{req: req}
+	}
+	return nil
+}
+
+// opsProgress remembers the printed phase and conditions of a vaultopsrequest.
+type opsProgress struct {
+	phase      opsapi.OpsRequestPhase
+	conditions map[string]string
+}
+
+// follow reads the watch events into req until the vaultopsrequest finishes or the watch is closed.
+func (p *opsProgress) follow(w watch.Interface, req *opsapi.VaultOpsRequest) (bool, error) {
+	for event := range w.ResultChan() {
+		switch event.Type {
+		case watch.Error:
+			return false, kerr.FromObject(event.Object)
+		case watch.Deleted:
+			return false, errors.Errorf("vaultopsrequest %s/%s was deleted", req.Namespace, req.Name)
+		case watch.Added, watch.Modified:
+			obj, ok := event.Object.(*opsapi.VaultOpsRequest)
+			if !ok {
+				return false, errors.Errorf("unexpected type %T", event.Object)
+			}
+			*req = *obj
+			if p.report(req) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// report prints the changed phase and conditions and reports whether the vaultopsrequest finished.
+func (p *opsProgress) report(req *opsapi.VaultOpsRequest) bool {
+	for _, cond := range req.Status.Conditions {
+		state := fmt.Sprintf("%s %s: %s", cond.Status, cond.Reason, cond.Message)
+		if p.conditions[string(cond.Type)] == state {
+			continue
+		}
+		p.conditions[string(cond.Type)] = state
+		fmt.Printf("  %s\t%s\t%s\n", cond.LastTransitionTime.Format(time.RFC3339), cond.Type, state)
+	}
+
+	if req.Status.Phase != p.phase {
+		p.phase = req.Status.Phase
+		if len(p.phase) > 0 {
+			fmt.Printf("vaultopsrequest %s/%s phase %s\n", req.Namespace, req.Name, p.phase)
+		}
+		if p.phase == opsapi.OpsRequestPhaseWaitingForApproval {
+			fmt.Printf("approve it with: kubectl vault approve vaultopsrequest %s -n %s\n", req.Name, req.Namespace)
+		}
+	}
+
+	switch req.Status.Phase {
+	case opsapi.OpsRequestPhaseSuccessful, opsapi.OpsRequestPhaseFailed, opsapi.OpsRequestDenied:
+		return true
+	}
+	return false
+}
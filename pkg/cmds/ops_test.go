@@ -0,0 +1,180 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	opsapi "kubevault.dev/apimachinery/apis/ops/v1alpha1"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+// captureStdout returns what fn prints to stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() {
+		os.Stdout = stdout
+	}()
+
+	done := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- string(data)
+	}()
+
+	fn()
+	_ = w.Close()
+	return <-done
+}
+
+func opsRequest(phase opsapi.OpsRequestPhase, conds ...kmapi.Condition) *opsapi.VaultOpsRequest {
+	return &opsapi.VaultOpsRequest{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "restart"},
+		Status: opsapi.VaultOpsRequestStatus{
+			Phase:      phase,
+			Conditions: conds,
+		},
+	}
+}
+
+func TestOpsProgressReport(t *testing.T) {
+	restarting := kmapi.Condition{Type: "Restart", Status: metav1.ConditionTrue, Reason: "Restarting", Message: "restarting pods"}
+	restarted := kmapi.Condition{Type: "Restart", Status: metav1.ConditionTrue, Reason: "Restarted", Message: "pods restarted"}
+
+	p := &opsProgress{conditions: map[string]string{}}
+	steps := []struct {
+		name         string
+		req          *opsapi.VaultOpsRequest
+		wantFinished bool
+		wantOutput   []string
+	}{
+		{name: "no phase", req: opsRequest("")},
+		{
+			name:       "waiting for approval",
+			req:        opsRequest(opsapi.OpsRequestPhaseWaitingForApproval),
+			wantOutput: []string{"phase WaitingForApproval", "kubectl vault approve vaultopsrequest restart -n demo"},
+		},
+		{
+			name:       "progressing",
+			req:        opsRequest(opsapi.OpsRequestPhaseProgressing, restarting),
+			wantOutput: []string{"Restarting: restarting pods", "phase Progressing"},
+		},
+		{name: "unchanged", req: opsRequest(opsapi.OpsRequestPhaseProgressing, restarting)},
+		{
+			name:       "changed condition",
+			req:        opsRequest(opsapi.OpsRequestPhaseProgressing, restarted),
+			wantOutput: []string{"Restarted: pods restarted"},
+		},
+		{
+			name:         "successful",
+			req:          opsRequest(opsapi.OpsRequestPhaseSuccessful, restarted),
+			wantFinished: true,
+			wantOutput:   []string{"phase Successful"},
+		},
+	}
+	for _, step := range steps {
+		var finished bool
+		out := captureStdout(t, func() {
+			finished = p.report(step.req)
+		})
+		if finished != step.wantFinished {
+			t.Errorf("%s: report() = %v, want %v", step.name, finished, step.wantFinished)
+		}
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		if len(out) == 0 {
+			lines = nil
+		}
+		if len(lines) != len(step.wantOutput) {
+			t.Errorf("%s: report() printed %q, want %d lines", step.name, out, len(step.wantOutput))
+			continue
+		}
+		for i, want := range step.wantOutput {
+			if !strings.Contains(lines[i], want) {
+				t.Errorf("%s: report() line %d = %q, want it to contain %q", step.name, i, lines[i], want)
+			}
+		}
+	}
+}
+
+func TestOpsProgressFollow(t *testing.T) {
+	tests := []struct {
+		name         string
+		events       []watch.Event
+		wantFinished bool
+		wantErr      bool
+	}{
+		{
+			name: "finished",
+			events: []watch.Event{
+				{Type: watch.Modified, Object: opsRequest(opsapi.OpsRequestPhaseProgressing)},
+				{Type: watch.Modified, Object: opsRequest(opsapi.OpsRequestPhaseFailed)},
+			},
+			wantFinished: true,
+		},
+		{
+			name:   "watch closed",
+			events: []watch.Event{{Type: watch.Added, Object: opsRequest(opsapi.OpsRequestPhaseProgressing)}},
+		},
+		{
+			name:    "deleted",
+			events:  []watch.Event{{Type: watch.Deleted, Object: opsRequest(opsapi.OpsRequestPhaseProgressing)}},
+			wantErr: true,
+		},
+		{
+			name:    "unexpected object",
+			events:  []watch.Event{{Type: watch.Modified, Object: &core.Pod{}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := watch.NewFakeWithChanSize(len(tt.events), false)
+			for _, event := range tt.events {
+				w.Action(event.Type, event.Object)
+			}
+			w.Stop()
+
+			p := &opsProgress{conditions: map[string]string{}}
+			req := opsRequest("")
+			var finished bool
+			var err error
+			captureStdout(t, func() {
+				finished, err = p.follow(w, req)
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("follow() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if finished != tt.wantFinished {
+				t.Errorf("follow() = %v, want %v", finished, tt.wantFinished)
+			}
+		})
+	}
+}
@@ -0,0 +1,377 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+	"kubevault.dev/cli/pkg/token-keys-store/api"
+
+	vaultclient "github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// rekeyStagingSuffix is appended to the unseal-key names to stage the new
+// unseal-keys until vault verifies them.
+const rekeyStagingSuffix = "-rekey"
+
+type rekeyOptions struct {
+	secretShares    int64
+	secretThreshold int64
+	updateSpec      bool
+}
+
+func newRekeyOptions() *rekeyOptions {
+	return &rekeyOptions{}
+}
+
+func (o *rekeyOptions) addRekeyFlags(fs *pflag.FlagSet) {
+	fs.Int64Var(&o.secretShares, "secret-shares", o.secretShares, "number of new unseal-keys. defaults to spec.unsealer.secretShares")
+	fs.Int64Var(&o.secretThreshold, "secret-threshold", o.secretThreshold, "number of new unseal-keys required to unseal. defaults to spec.unsealer.secretThreshold")
+	fs.BoolVar(&o.updateSpec, "update-spec", o.updateSpec, "update spec.unsealer.secretShares and spec.unsealer.secretThreshold of the vaultserver. required if they change")
+}
+
+func NewCmdRekey(clientGetter genericclioptions.RESTClientGetter) *cobra.Command {
+	o := newRekeyOptions()
+	cmd := &cobra.Command{
+		Use:   "rekey",
+		Short: "rekey vault unseal-keys",
+		Long: `
+# generate new unseal-keys using the current unseal-keys
+$ kubectl vault unseal-key rekey vaultserver <name> -n <namespace> [flags]
+
+The new unseal-keys are staged in the key store and verified by vault before they replace the current ones.
+Changing the number of shares or the threshold requires --update-spec, so that spec.unsealer keeps matching the key store.
+
+Examples:
+ # rekey the vaultserver unseal-keys keeping the number of shares and threshold
+ $ kubectl vault unseal-key rekey vaultserver vault -n demo
+
+ # rekey with 7 shares and a threshold of 4, and update the vaultserver unsealer spec accordingly
+ $ kubectl vault unseal-key rekey vaultserver vault -n demo --secret-shares 7 --secret-threshold 4 --update-spec
+`,
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				ResourceName = args[0]
+				ObjectNames = args[1:]
+			}
+
+			if err := o.rekey(cmd.Context(), clientGetter); err != nil {
+				Fatal(err)
+			}
+			os.Exit(0)
+		},
+	}
+
+	o.addRekeyFlags(cmd.Flags())
+	return cmd
+}
+
+func (o *rekeyOptions) rekey(ctx context.Context, clientGetter genericclioptions.RESTClientGetter) error {
+	cfg, err := clientGetter.ToRESTConfig()
+	if err != nil {
+		return errors.Wrap(err, "failed to read kubeconfig")
+	}
+
+	return visitVaultServerResources(clientGetter, vaultServerSelector{}, func(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface, vsHelper *resource.Helper) error {
+		return o.rekeyUnsealKeys(ctx, cfg, vs, kubeClient, vsHelper)
+	})
+}
+
+func (o *rekeyOptions) rekeyUnsealKeys(ctx context.Context, cfg *rest.Config, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface, vsHelper *resource.Helper) error {
+	// For rekey:
+	// - threshold number of current unseal-keys must be present
+	// - new unseal-keys must be staged in the key store and read back successfully
+	// - vault must verify the staged unseal-keys before they replace the current ones
+	// - current unseal-keys beyond the new number of shares are deleted last, after the unsealer spec is updated
+	if vs.Spec.Unsealer == nil {
+		return errors.New("vaultServer unsealer spec is empty")
+	}
+
+	shares, threshold := vs.Spec.Unsealer.SecretShares, vs.Spec.Unsealer.SecretThreshold
+	if o.secretShares > 0 {
+		shares = o.secretShares
+	}
+	if o.secretThreshold > 0 {
+		threshold = o.secretThreshold
+	}
+	if threshold > shares {
+		return errors.Errorf("secret-threshold %d can not be greater than secret-shares %d", threshold, shares)
+	}
+	// the unseal-keys are read with the counts of spec.unsealer, so they must not change without it
+	specChanged := shares != vs.Spec.Unsealer.SecretShares || threshold != vs.Spec.Unsealer.SecretThreshold
+	if specChanged && !o.updateSpec {
+		return errors.Errorf("secret-shares %d and secret-threshold %d don't match spec.unsealer of vaultserver %s/%s, use --update-spec to update it", shares, threshold, vs.Namespace, vs.Name)
+	}
+
+	keys, err := getKeys(ctx, vs, kubeClient)
+	if err != nil {
+		return err
+	}
+
+	// the new key names are derived from the new number of shares
+	newVS := vs.DeepCopy()
+	newVS.Spec.Unsealer.SecretShares = shares
+	newVS.Spec.Unsealer.SecretThreshold = threshold
+
+	ti, err := newTokenKeyInterface(newVS, kubeClient)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		ti.Clean()
+	}()
+
+	client, tunnel, err := NewVaultClient(cfg, kubeClient, vs)
+	if err != nil {
+		return err
+	}
+	defer tunnel.Close()
+
+	status, err := client.Sys().RekeyStatusWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	if status.Started {
+		return errors.New("a rekey operation is already in progress, cancel it before starting a new one")
+	}
+
+	status, err = client.Sys().RekeyInitWithContext(ctx, &vaultclient.RekeyInitRequest{
+		SecretShares:        int(shares),
+		SecretThreshold:     int(threshold),
+		RequireVerification: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	var resp *vaultclient.RekeyUpdateResponse
+	for idx, key := range keys {
+		if int64(idx) >= vs.Spec.Unsealer.SecretThreshold {
+			break
+		}
+
+		resp, err = client.Sys().RekeyUpdateWithContext(ctx, key, status.Nonce)
+		if err != nil {
+			_ = client.Sys().RekeyCancel()
+			return err
+		}
+	}
+
+	if resp == nil || !resp.Complete {
+		_ = client.Sys().RekeyCancel()
+		return errors.New("failed to complete rekey")
+	}
+
+	fmt.Println("new unseal-keys generated, waiting for verification")
+
+	staged, err := stageUnsealKeys(ctx, ti, resp.Keys)
+	if err != nil {
+		_ = client.Sys().RekeyVerificationCancel()
+		return err
+	}
+
+	// vault uses the new unseal-keys once the verification completes and the current ones are invalid.
+	// So the last unseal-key is submitted and the new unseal-keys are promoted without ctx, interrupts
+	// are held until the key store and the spec match them.
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	verifyNonce := resp.VerificationNonce
+	var verified bool
+	for idx, key := range staged {
+		if int64(idx) >= threshold {
+			break
+		}
+
+		keyCtx := ctx
+		if int64(idx) == threshold-1 {
+			keyCtx = context.Background()
+		}
+		vResp, err := client.Sys().RekeyVerificationUpdateWithContext(keyCtx, key, verifyNonce)
+		if err != nil {
+			_ = client.Sys().RekeyVerificationCancel()
+			return errors.Wrap(err, "failed to verify new unseal-keys, current unseal-keys are still valid")
+		}
+		verified = vResp.Complete
+	}
+
+	if !verified {
+		_ = client.Sys().RekeyVerificationCancel()
+		return errors.New("failed to verify new unseal-keys, current unseal-keys are still valid")
+	}
+
+	fmt.Println("new unseal-keys verified")
+
+	return finishRekey(context.Background(), vs, newVS, ti, staged, kubeClient, vsHelper)
+}
+
+// finishRekey replaces the current unseal-keys with the verified ones, updates the unsealer spec
+// and deletes the current unseal-keys beyond the new number of shares. The spec is updated before
+// the deletion, so that it never refers to deleted unseal-keys.
+func finishRekey(ctx context.Context, vs, newVS *vaultapi.VaultServer, ti api.TokenKeyInterface, staged []string, kubeClient kubernetes.Interface, vsHelper *resource.Helper) error {
+	if err := promoteUnsealKeys(ctx, ti, staged); err != nil {
+		return err
+	}
+
+	shares, threshold := newVS.Spec.Unsealer.SecretShares, newVS.Spec.Unsealer.SecretThreshold
+	if shares != vs.Spec.Unsealer.SecretShares || threshold != vs.Spec.Unsealer.SecretThreshold {
+		if err := patchUnsealerSpec(vsHelper, vs, shares, threshold); err != nil {
+			return err
+		}
+	}
+
+	// delete the current unseal-keys that are no longer part of the new shares
+	oldTi, err := newTokenKeyInterface(vs, kubeClient)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		oldTi.Clean()
+	}()
+
+	if err = deleteStaleUnsealKeys(ctx, oldTi, int(shares), int(vs.Spec.Unsealer.SecretShares)); err != nil {
+		return err
+	}
+
+	fmt.Println("unseal-key rekey successful")
+	return nil
+}
+
+// stageUnsealKeys stores the new unseal-keys under the staging names and reads them back,
+// so that the keys verified by vault are exactly the ones kept in the key store.
+func stageUnsealKeys(ctx context.Context, ti api.TokenKeyInterface, keys []string) ([]string, error) {
+	values := map[string]string{}
+	var names []string
+	for i, key := range keys {
+		name, err := ti.NewUnsealKeyName(ctx, i)
+		if err != nil {
+			return nil, err
+		}
+		name += rekeyStagingSuffix
+		values[name] = key
+		names = append(names, name)
+	}
+
+	if err := ti.SetMany(ctx, values); err != nil {
+		return nil, errors.Wrap(err, "failed to stage unseal-keys")
+	}
+
+	var staged []string
+	for i, key := range keys {
+		name := names[i]
+		value, err := ti.Get(ctx, name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read back staged unseal-key %s", name)
+		}
+		if value != key {
+			return nil, errors.Errorf("staged unseal-key %s doesn't match the generated one", name)
+		}
+
+		staged = append(staged, value)
+	}
+
+	return staged, nil
+}
+
+// promoteUnsealKeys replaces the current unseal-keys with the staged ones.
+func promoteUnsealKeys(ctx context.Context, ti api.TokenKeyInterface, keys []string) error {
+	values := map[string]string{}
+	var names, stagedNames []string
+	for i, key := range keys {
+		name, err := ti.NewUnsealKeyName(ctx, i)
+		if err != nil {
+			return err
+		}
+		values[name] = key
+		names = append(names, name)
+		stagedNames = append(stagedNames, name+rekeyStagingSuffix)
+	}
+
+	if err := ti.SetMany(ctx, values); err != nil {
+		return errors.Wrapf(err, "failed to set unseal-keys, the verified unseal-keys are kept with suffix %s", rekeyStagingSuffix)
+	}
+	if err := ti.DeleteMany(ctx, stagedNames); err != nil {
+		return err
+	}
+	for _, name := range names {
+		fmt.Printf("unseal-key with name %s successfully rekeyed\n", name)
+	}
+
+	return nil
+}
+
+// deleteStaleUnsealKeys deletes the unseal-keys with ids from shares up to the previous number of shares.
+func deleteStaleUnsealKeys(ctx context.Context, ti api.TokenKeyInterface, shares, previousShares int) error {
+	var stale []string
+	for i := shares; i < previousShares; i++ {
+		name, err := ti.NewUnsealKeyName(ctx, i)
+		if err != nil {
+			return err
+		}
+		stale = append(stale, name)
+	}
+	if err := ti.DeleteMany(ctx, stale); err != nil {
+		return err
+	}
+	for _, name := range stale {
+		fmt.Printf("unseal-key with name %s successfully deleted\n", name)
+	}
+	return nil
+}
+
+// patchUnsealerSpec patches the VaultServer with the api version served by the cluster,
+// the unsealer spec is the same in every api version.
+func patchUnsealerSpec(vsHelper *resource.Helper, vs *vaultapi.VaultServer, shares, threshold int64) error {
+	patch, err := json.Marshal(map[string]any{
+		"spec": map[string]any{
+			"unsealer": map[string]any{
+				"secretShares":    shares,
+				"secretThreshold": threshold,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = vsHelper.Patch(vs.Namespace, vs.Name, types.MergePatchType, patch, &metav1.PatchOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to update unsealer spec of vaultserver %s/%s", vs.Namespace, vs.Name)
+	}
+
+	fmt.Printf("vaultserver %s/%s unsealer spec updated\n", vs.Namespace, vs.Name)
+	return nil
+}
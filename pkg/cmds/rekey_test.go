@@ -0,0 +1,180 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"maps"
+	"reflect"
+	"testing"
+
+	"kubevault.dev/cli/pkg/token-keys-store/fake"
+)
+
+func TestStageUnsealKeys(t *testing.T) {
+	current := map[string]string{"vault-unseal-key-0": "old0", "vault-unseal-key-1": "old1"}
+	tests := []struct {
+		name    string
+		keys    []string
+		failing string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "staged",
+			keys: []string{"new0", "new1", "new2"},
+			want: map[string]string{
+				"vault-unseal-key-0": "old0", "vault-unseal-key-1": "old1",
+				"vault-unseal-key-0-rekey": "new0", "vault-unseal-key-1-rekey": "new1", "vault-unseal-key-2-rekey": "new2",
+			},
+		},
+		{
+			name:    "staging fails",
+			keys:    []string{"new0", "new1", "new2"},
+			failing: "vault-unseal-key-2-rekey",
+			want:    current,
+			wantErr: true,
+		},
+		{
+			name:    "more keys than shares",
+			keys:    []string{"new0", "new1", "new2", "new3"},
+			want:    current,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := fake.NewStore(maps.Clone(current))
+			store.Shares, store.Failing = 3, tt.failing
+
+			staged, err := stageUnsealKeys(context.Background(), store, tt.keys)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("stageUnsealKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(staged, tt.keys) {
+				t.Errorf("stageUnsealKeys() = %v, want %v", staged, tt.keys)
+			}
+			if !reflect.DeepEqual(store.Values, tt.want) {
+				t.Errorf("stageUnsealKeys() stored %v, want %v", store.Values, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromoteUnsealKeys(t *testing.T) {
+	stored := map[string]string{
+		"vault-unseal-key-0": "old0", "vault-unseal-key-1": "old1", "vault-unseal-key-2": "old2",
+		"vault-unseal-key-0-rekey": "new0", "vault-unseal-key-1-rekey": "new1",
+	}
+	tests := []struct {
+		name    string
+		failing string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "promoted",
+			want: map[string]string{"vault-unseal-key-0": "new0", "vault-unseal-key-1": "new1", "vault-unseal-key-2": "old2"},
+		},
+		{
+			// the verified unseal-keys are kept under the staging names
+			name:    "promotion fails",
+			failing: "vault-unseal-key-1",
+			want:    stored,
+			wantErr: true,
+		},
+		{
+			name:    "staged keys can't be deleted",
+			failing: "vault-unseal-key-1-rekey",
+			want: map[string]string{
+				"vault-unseal-key-0": "new0", "vault-unseal-key-1": "new1", "vault-unseal-key-2": "old2",
+				"vault-unseal-key-0-rekey": "new0", "vault-unseal-key-1-rekey": "new1",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := fake.NewStore(maps.Clone(stored))
+			store.Failing = tt.failing
+
+			err := promoteUnsealKeys(context.Background(), store, []string{"new0", "new1"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("promoteUnsealKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(store.Values, tt.want) {
+				t.Errorf("promoteUnsealKeys() stored %v, want %v", store.Values, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteStaleUnsealKeys(t *testing.T) {
+	stored := map[string]string{
+		"vault-unseal-key-0": "new0", "vault-unseal-key-1": "new1",
+		"vault-unseal-key-2": "old2", "vault-unseal-key-3": "old3",
+	}
+	tests := []struct {
+		name           string
+		shares         int
+		previousShares int
+		failing        string
+		want           map[string]string
+		wantErr        bool
+	}{
+		{
+			name:           "fewer shares",
+			shares:         2,
+			previousShares: 4,
+			want:           map[string]string{"vault-unseal-key-0": "new0", "vault-unseal-key-1": "new1"},
+		},
+		{
+			name:           "same shares",
+			shares:         4,
+			previousShares: 4,
+			want:           stored,
+		},
+		{
+			name:           "more shares",
+			shares:         5,
+			previousShares: 4,
+			want:           stored,
+		},
+		{
+			name:           "deletion fails",
+			shares:         2,
+			previousShares: 4,
+			failing:        "vault-unseal-key-3",
+			want:           stored,
+			wantErr:        true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := fake.NewStore(maps.Clone(stored))
+			store.Shares, store.Failing = tt.previousShares, tt.failing
+
+			err := deleteStaleUnsealKeys(context.Background(), store, tt.shares, tt.previousShares)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("deleteStaleUnsealKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(store.Values, tt.want) {
+				t.Errorf("deleteStaleUnsealKeys() stored %v, want %v", store.Values, tt.want)
+			}
+		})
+	}
+}
@@ -38,9 +38,21 @@ var secretAccessRevokeCond = kmapi.Condition{
 }
 
 func NewCmdRevoke(clientGetter genericclioptions.RESTClientGetter) *cobra.Command {
+	o := newDecisionOptions()
 	cmd := &cobra.Command{
-		Use:               "revoke",
-		Short:             "Revoke request",
+		Use:   "revoke",
+		Short: "Revoke request",
+		Long: `
+$ kubectl vault revoke secretaccessrequest <name> -n <namespace>
+
+The user of the current kubeconfig, the time and the --reason are recorded in the condition
+message and in an event on the request. The user is looked up with a selfsubjectreview, if that
+fails the user name of the kubeconfig is recorded with the prefix unverified:.
+
+Examples:
+ # revoke the secretaccessrequest
+ $ kubectl vault revoke secretaccessrequest my-request -n demo --reason="access no longer needed"
+`,
 		DisableAutoGenTag: true,
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) > 0 {
@@ -48,7 +60,7 @@ func NewCmdRevoke(clientGetter genericclioptions.RESTClientGetter) *cobra.Comman
 				ObjectNames = args[1:]
 			}
 
-			if err := modifyStatusCondition(clientGetter, secretAccessRevokeCond); err != nil {
+			if err := modifyStatusCondition(cmd.Context(), clientGetter, secretAccessRevokeCond, o); err != nil {
 				Fatal(err)
 			} else {
 				fmt.Printf("secretaccessrequests %s revoked\n", strings.Join(ObjectNames, ", "))
@@ -58,5 +70,6 @@ func NewCmdRevoke(clientGetter genericclioptions.RESTClientGetter) *cobra.Comman
 	}
 
 	cmdutil.AddFilenameOptionFlags(cmd, &FilenameOptions, "identifying the resource to update")
+	o.addDecisionFlags(cmd.Flags())
 	return cmd
 }
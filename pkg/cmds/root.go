@@ -17,8 +17,14 @@ limitations under the License.
 package cmds
 
 import (
+	"strconv"
+	"time"
+
 	"kubevault.dev/apimachinery/client/clientset/versioned/scheme"
+	token_key_store "kubevault.dev/cli/pkg/token-keys-store"
+	aws_kms_ssm "kubevault.dev/cli/pkg/token-keys-store/aws-kms-ssm"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	v "gomodules.xyz/x/version"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -29,6 +35,8 @@ import (
 )
 
 func NewRootCmd() *cobra.Command {
+	var keyStoreConfigFile string
+	kubeConfigFlags := genericclioptions.NewConfigFlags(true)
 	rootCmd := &cobra.Command{
 		Use:               "vault [command]",
 		Short:             `KubeVault cli by AppsCode`,
@@ -36,15 +44,31 @@ func NewRootCmd() *cobra.Command {
 		PersistentPreRun: func(c *cobra.Command, args []string) {
 			utilruntime.Must(scheme.AddToScheme(clientsetscheme.Scheme))
 			utilruntime.Must(appcatscheme.AddToScheme(clientsetscheme.Scheme))
+
+			if len(keyStoreConfigFile) > 0 {
+				cfg, err := token_key_store.ReadStoreConfig(keyStoreConfigFile)
+				if err != nil {
+					Fatal(err)
+				}
+				keyStoreConfig = cfg
+			}
+
+			timeout, err := requestTimeout(kubeConfigFlags.Timeout)
+			if err != nil {
+				Fatal(err)
+			}
+			token_key_store.SetRequestTimeout(timeout)
 		},
 	}
 
 	flags := rootCmd.PersistentFlags()
 
-	kubeConfigFlags := genericclioptions.NewConfigFlags(true)
 	kubeConfigFlags.AddFlags(flags)
+	insecureSkipTLSVerify = kubeConfigFlags.Insecure
 	matchVersionKubeConfigFlags := cmdutil.NewMatchVersionFlags(kubeConfigFlags)
 	matchVersionKubeConfigFlags.AddFlags(flags)
+	flags.StringVar(&keyStoreConfigFile, "key-store-config", keyStoreConfigFile, "yaml/json file describing the key store to use instead of the vaultserver unsealer mode")
+	aws_kms_ssm.DefaultOptions.AddFlags(flags)
 
 	rootCmd.AddCommand(NewCmdCompletion())
 	rootCmd.AddCommand(v.NewCmdVersion())
@@ -55,6 +79,28 @@ func NewRootCmd() *cobra.Command {
 	rootCmd.AddCommand(NewCmdGenerate(matchVersionKubeConfigFlags))
 	rootCmd.AddCommand(NewCmdRootToken(matchVersionKubeConfigFlags))
 	rootCmd.AddCommand(NewCmdUnsealKey(matchVersionKubeConfigFlags))
+	rootCmd.AddCommand(NewCmdKeys(matchVersionKubeConfigFlags))
 	rootCmd.AddCommand(NewCmdMergeSecrets(matchVersionKubeConfigFlags))
+	rootCmd.AddCommand(NewCmdStatus(matchVersionKubeConfigFlags))
+	rootCmd.AddCommand(NewCmdInit(matchVersionKubeConfigFlags))
+	rootCmd.AddCommand(NewCmdUnseal(matchVersionKubeConfigFlags))
+	rootCmd.AddCommand(NewCmdConvert(matchVersionKubeConfigFlags))
+	rootCmd.AddCommand(NewCmdOps(matchVersionKubeConfigFlags))
 	return rootCmd
 }
+
+// requestTimeout parses the --request-timeout flag the same way as kubectl,
+// a plain integer is a number of seconds and zero means no timeout.
+func requestTimeout(timeout *string) (time.Duration, error) {
+	if timeout == nil || len(*timeout) == 0 {
+		return 0, nil
+	}
+	if sec, err := strconv.Atoi(*timeout); err == nil {
+		return time.Duration(sec) * time.Second, nil
+	}
+	d, err := time.ParseDuration(*timeout)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid request timeout %s", *timeout)
+	}
+	return d, nil
+}
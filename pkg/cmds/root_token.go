@@ -17,14 +17,16 @@ limitations under the License.
 package cmds
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"os"
 	"strings"
 
 	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
-	token_key_store "kubevault.dev/cli/pkg/token-keys-store"
+	"kubevault.dev/cli/pkg/vaultserver"
 
+	vaultclient "github.com/hashicorp/vault/api"
 	"github.com/hashicorp/vault/sdk/helper/xor"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -33,6 +35,7 @@ import (
 	"k8s.io/cli-runtime/pkg/resource"
 	"k8s.io/client-go/kubernetes"
 	clientsetscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	cmdutil "k8s.io/kubectl/pkg/cmd/util"
 )
 
@@ -79,9 +82,9 @@ func (o *delTokenOptions) AddDelTokenFlag(fs *pflag.FlagSet) {
 func NewCmdRootToken(clientGetter genericclioptions.RESTClientGetter) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "root-token",
-		Short: "get, set, delete, sync, generate, and rotate root-token",
+		Short: "get, set, delete, sync, generate, rotate, and exec with root-token",
 		Long: `
-$ kubectl vault root-token [command] [flags] to get, set, delete, sync, generate, and rotate vault root-token
+$ kubectl vault root-token [command] [flags] to get, set, delete, sync, generate, rotate, and exec with vault root-token
 
 Examples:
  $ kubectl vault root-token get [flags]
@@ -90,6 +93,7 @@ Examples:
  $ kubectl vault root-token sync [flags]
  $ kubectl vault root-token generate [flags]
  $ kubectl vault root-token rotate [flags]
+ $ kubectl vault root-token exec [flags] -- <command>
 `,
 
 		DisableAutoGenTag: true,
@@ -105,6 +109,7 @@ Examples:
 	cmd.AddCommand(NewCmdSyncToken(clientGetter))
 	cmd.AddCommand(NewCmdGenerateToken(clientGetter))
 	cmd.AddCommand(NewCmdRotateToken(clientGetter))
+	cmd.AddCommand(NewCmdExecToken(clientGetter))
 	return cmd
 }
 
@@ -125,6 +130,19 @@ Examples:
 
  # pass the --token-name flag to get only the decrypted root-token value with a specific token name
  $ kubectl vault root-token get vaultserver vault -n demo --token-name <token-name> --value-only
+
+ # pass the global --key-store-config flag to read the root-token from a key store that is not an unsealer mode,
+ # the transit key must be created with derived=true, e.g. vault write -f transit/keys/vault-unseal derived=true
+ # store.yaml:
+ #  vaultTransit:
+ #    address: https://bootstrap-vault.example.com:8200
+ #    keyName: vault-unseal
+ #    secretName: vault-transit-keys
+ #    auth:
+ #      kubernetes:
+ #        role: vault-unsealer
+ #        serviceAccountName: vault
+ $ kubectl vault root-token get vaultserver vault -n demo --key-store-config=store.yaml
 `,
 		DisableAutoGenTag: true,
 		Run: func(cmd *cobra.Command, args []string) {
@@ -133,7 +151,7 @@ Examples:
 				ObjectNames = args[1:]
 			}
 
-			if err := o.get(clientGetter); err != nil {
+			if err := o.get(cmd.Context(), clientGetter); err != nil {
 				Fatal(err)
 			}
 			os.Exit(0)
@@ -167,7 +185,7 @@ Examples:
 				ObjectNames = args[1:]
 			}
 
-			if err := o.set(clientGetter); err != nil {
+			if err := o.set(cmd.Context(), clientGetter); err != nil {
 				Fatal(err)
 			}
 			os.Exit(0)
@@ -201,7 +219,7 @@ Examples:
 				ObjectNames = args[1:]
 			}
 
-			if err := o.del(clientGetter); err != nil {
+			if err := o.del(cmd.Context(), clientGetter); err != nil {
 				Fatal(err)
 			}
 			os.Exit(0)
@@ -212,7 +230,7 @@ Examples:
 	return cmd
 }
 
-func (o *getTokenOptions) get(clientGetter genericclioptions.RESTClientGetter) error {
+func (o *getTokenOptions) get(ctx context.Context, clientGetter genericclioptions.RESTClientGetter) error {
 	var resourceName string
 	switch ResourceName {
 	case strings.ToLower(vaultapi.ResourceVaultServer), strings.ToLower(vaultapi.ResourceVaultServers):
@@ -253,11 +271,15 @@ func (o *getTokenOptions) get(clientGetter genericclioptions.RESTClientGetter) e
 			return err
 		}
 
+		if info.Object, err = vaultserver.ToHub(info.Object); err != nil {
+			return err
+		}
+
 		var err2 error
 		switch info.Object.(type) {
 		case *vaultapi.VaultServer:
 			obj := info.Object.(*vaultapi.VaultServer)
-			err2 = o.getRootToken(obj, kubeClient)
+			err2 = o.getRootToken(ctx, obj, kubeClient)
 		default:
 			err2 = errors.New("unknown/unsupported type")
 		}
@@ -266,8 +288,8 @@ func (o *getTokenOptions) get(clientGetter genericclioptions.RESTClientGetter) e
 	return err
 }
 
-func (o *getTokenOptions) getRootToken(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
-	ti, err := token_key_store.NewTokenKeyInterface(vs, kubeClient)
+func (o *getTokenOptions) getRootToken(ctx context.Context, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
+	ti, err := newTokenKeyInterface(vs, kubeClient)
 	if err != nil {
 		return err
 	}
@@ -278,7 +300,7 @@ func (o *getTokenOptions) getRootToken(vs *vaultapi.VaultServer, kubeClient kube
 
 	// if --token-name if provided, get token with this name
 	if len(o.tokenName) > 0 {
-		rToken, err := ti.Get(o.tokenName)
+		rToken, err := ti.Get(ctx, o.tokenName)
 		if err != nil {
 			return err
 		}
@@ -287,8 +309,8 @@ func (o *getTokenOptions) getRootToken(vs *vaultapi.VaultServer, kubeClient kube
 	}
 
 	// --token-name isn't provided, look for the token with the latest naming format
-	name := ti.NewTokenName()
-	rToken, err := ti.Get(name)
+	name := ti.NewTokenName(ctx)
+	rToken, err := ti.Get(ctx, name)
 	if err != nil {
 		return err
 	}
@@ -298,7 +320,7 @@ func (o *getTokenOptions) getRootToken(vs *vaultapi.VaultServer, kubeClient kube
 	return nil
 }
 
-func (o *delTokenOptions) del(clientGetter genericclioptions.RESTClientGetter) error {
+func (o *delTokenOptions) del(ctx context.Context, clientGetter genericclioptions.RESTClientGetter) error {
 	var resourceName string
 	switch ResourceName {
 	case strings.ToLower(vaultapi.ResourceVaultServer), strings.ToLower(vaultapi.ResourceVaultServers):
@@ -339,11 +361,15 @@ func (o *delTokenOptions) del(clientGetter genericclioptions.RESTClientGetter) e
 			return err
 		}
 
+		if info.Object, err = vaultserver.ToHub(info.Object); err != nil {
+			return err
+		}
+
 		var err2 error
 		switch info.Object.(type) {
 		case *vaultapi.VaultServer:
 			obj := info.Object.(*vaultapi.VaultServer)
-			err2 = o.deleteRootToken(obj, kubeClient)
+			err2 = o.deleteRootToken(ctx, obj, kubeClient)
 		default:
 			err2 = errors.New("unknown/unsupported type")
 		}
@@ -352,8 +378,8 @@ func (o *delTokenOptions) del(clientGetter genericclioptions.RESTClientGetter) e
 	return err
 }
 
-func (o *delTokenOptions) deleteRootToken(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
-	ti, err := token_key_store.NewTokenKeyInterface(vs, kubeClient)
+func (o *delTokenOptions) deleteRootToken(ctx context.Context, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
+	ti, err := newTokenKeyInterface(vs, kubeClient)
 	if err != nil {
 		return err
 	}
@@ -362,12 +388,12 @@ func (o *delTokenOptions) deleteRootToken(vs *vaultapi.VaultServer, kubeClient k
 		ti.Clean()
 	}()
 
-	name := ti.NewTokenName()
+	name := ti.NewTokenName(ctx)
 	if len(o.tokenName) > 0 {
 		name = o.tokenName
 	}
 
-	err = ti.Delete(name)
+	err = ti.Delete(ctx, name)
 	if err != nil {
 		return err
 	}
@@ -377,7 +403,7 @@ func (o *delTokenOptions) deleteRootToken(vs *vaultapi.VaultServer, kubeClient k
 	return nil
 }
 
-func (o *setTokenOptions) set(clientGetter genericclioptions.RESTClientGetter) error {
+func (o *setTokenOptions) set(ctx context.Context, clientGetter genericclioptions.RESTClientGetter) error {
 	var resourceName string
 	switch ResourceName {
 	case strings.ToLower(vaultapi.ResourceVaultServer), strings.ToLower(vaultapi.ResourceVaultServers):
@@ -418,11 +444,15 @@ func (o *setTokenOptions) set(clientGetter genericclioptions.RESTClientGetter) e
 			return err
 		}
 
+		if info.Object, err = vaultserver.ToHub(info.Object); err != nil {
+			return err
+		}
+
 		var err2 error
 		switch info.Object.(type) {
 		case *vaultapi.VaultServer:
 			obj := info.Object.(*vaultapi.VaultServer)
-			err2 = o.setRootToken(obj, kubeClient)
+			err2 = o.setRootToken(ctx, obj, kubeClient)
 		default:
 			err2 = errors.New("unknown/unsupported type")
 		}
@@ -451,7 +481,7 @@ Examples:
 				ObjectNames = args[1:]
 			}
 
-			if err := syncRootToken(clientGetter); err != nil {
+			if err := syncRootToken(cmd.Context(), clientGetter); err != nil {
 				Fatal(err)
 			}
 			os.Exit(0)
@@ -461,7 +491,7 @@ Examples:
 	return cmd
 }
 
-func syncRootToken(clientGetter genericclioptions.RESTClientGetter) error {
+func syncRootToken(ctx context.Context, clientGetter genericclioptions.RESTClientGetter) error {
 	var resourceName string
 	switch ResourceName {
 	case strings.ToLower(vaultapi.ResourceVaultServer), strings.ToLower(vaultapi.ResourceVaultServers):
@@ -502,11 +532,15 @@ func syncRootToken(clientGetter genericclioptions.RESTClientGetter) error {
 			return err
 		}
 
+		if info.Object, err = vaultserver.ToHub(info.Object); err != nil {
+			return err
+		}
+
 		var err2 error
 		switch info.Object.(type) {
 		case *vaultapi.VaultServer:
 			obj := info.Object.(*vaultapi.VaultServer)
-			err2 = syncToken(obj, kubeClient)
+			err2 = syncToken(ctx, obj, kubeClient)
 		default:
 			err2 = errors.New("unknown/unsupported type")
 		}
@@ -515,8 +549,8 @@ func syncRootToken(clientGetter genericclioptions.RESTClientGetter) error {
 	return err
 }
 
-func syncToken(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
-	ti, err := token_key_store.NewTokenKeyInterface(vs, kubeClient)
+func syncToken(ctx context.Context, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
+	ti, err := newTokenKeyInterface(vs, kubeClient)
 	if err != nil {
 		return err
 	}
@@ -526,8 +560,8 @@ func syncToken(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error
 	}()
 
 	// if new key already exists just return
-	newKey := ti.NewTokenName()
-	if _, err = ti.Get(newKey); err == nil {
+	newKey := ti.NewTokenName(ctx)
+	if _, err = ti.Get(ctx, newKey); err == nil {
 		fmt.Printf("%s already up-to-date\n", newKey)
 		fmt.Println("successfully synced root-token")
 		return nil
@@ -535,14 +569,14 @@ func syncToken(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error
 
 	// new key doesn't exist, check for old key
 	oldKey := ti.OldTokenName()
-	value, err := ti.Get(oldKey)
+	value, err := ti.Get(ctx, oldKey)
 	if err != nil {
 		fmt.Println(err)
 		return err
 	}
 
 	// old key exist, set the value to new key
-	if err = ti.Set(newKey, value); err != nil {
+	if err = ti.Set(ctx, newKey, value); err != nil {
 		fmt.Println(err)
 		return err
 	}
@@ -552,8 +586,8 @@ func syncToken(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error
 	return nil
 }
 
-func (o *setTokenOptions) setRootToken(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
-	ti, err := token_key_store.NewTokenKeyInterface(vs, kubeClient)
+func (o *setTokenOptions) setRootToken(ctx context.Context, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
+	ti, err := newTokenKeyInterface(vs, kubeClient)
 	if err != nil {
 		return err
 	}
@@ -566,12 +600,12 @@ func (o *setTokenOptions) setRootToken(vs *vaultapi.VaultServer, kubeClient kube
 		return errors.New("token value is empty")
 	}
 
-	name := ti.NewTokenName()
+	name := ti.NewTokenName(ctx)
 	if len(o.tokenName) > 0 {
 		name = o.tokenName
 	}
 
-	if err = ti.Set(name, o.tokenValue); err != nil {
+	if err = ti.Set(ctx, name, o.tokenValue); err != nil {
 		return err
 	}
 
@@ -588,6 +622,7 @@ func (o *getTokenOptions) Print(key, value string) {
 }
 
 func NewCmdGenerateToken(clientGetter genericclioptions.RESTClientGetter) *cobra.Command {
+	o := newKeysFromOptions()
 	cmd := &cobra.Command{
 		Use:   "generate",
 		Short: "generate vault root-token",
@@ -595,9 +630,22 @@ func NewCmdGenerateToken(clientGetter genericclioptions.RESTClientGetter) *cobra
 # generate vault root token using the unseal keys
 $ kubectl vault root-token generate vaultserver <name> -n <namespace> [flags]
 
+The unseal-key shares are read from the configured key store by default. With --keys-from=prompt
+the key custodians enter their shares without echo, with --keys-from=stdin or --keys-from=files
+the shares are read one per line from stdin or one per file. The custodians may enter their shares
+in separate sessions, an empty share ends a session and leaves the generation in progress.
+An in-progress generation is resumed with the otp printed to stderr by the session that started it,
+no share is submitted without it. Use --cancel-in-progress to start over.
+
 Examples:
  # generate the vaultserver root-token
  $ kubectl vault root-token generate vaultserver vault -n demo
+
+ # generate the vaultserver root-token with the shares of the key custodians
+ $ kubectl vault root-token generate vaultserver vault -n demo --keys-from=prompt
+
+ # resume a generation started in another session
+ $ kubectl vault root-token generate vaultserver vault -n demo --keys-from=prompt --otp=<otp>
 `,
 		DisableAutoGenTag: true,
 		Run: func(cmd *cobra.Command, args []string) {
@@ -606,17 +654,19 @@ Examples:
 				ObjectNames = args[1:]
 			}
 
-			if err := generateRootToken(clientGetter); err != nil {
+			if err := generateRootToken(cmd.Context(), clientGetter, o); err != nil {
 				Fatal(err)
 			}
 			os.Exit(0)
 		},
 	}
 
+	o.addKeysFromFlags(cmd.Flags())
+	o.addGenerateRootFlags(cmd.Flags())
 	return cmd
 }
 
-func generateRootToken(clientGetter genericclioptions.RESTClientGetter) error {
+func generateRootToken(ctx context.Context, clientGetter genericclioptions.RESTClientGetter, o *keysFromOptions) error {
 	var resourceName string
 	switch ResourceName {
 	case strings.ToLower(vaultapi.ResourceVaultServer), strings.ToLower(vaultapi.ResourceVaultServers):
@@ -657,12 +707,20 @@ func generateRootToken(clientGetter genericclioptions.RESTClientGetter) error {
 			return err
 		}
 
+		if info.Object, err = vaultserver.ToHub(info.Object); err != nil {
+			return err
+		}
+
 		var token string
 		var err2 error
 		switch info.Object.(type) {
 		case *vaultapi.VaultServer:
 			obj := info.Object.(*vaultapi.VaultServer)
-			token, err2 = generateToken(obj, kubeClient)
+			token, err2 = generateToken(ctx, cfg, obj, kubeClient, o)
+			if errors.Is(err2, errCeremonyIncomplete) {
+				fmt.Println(err2)
+				err2 = nil
+			}
 			if err2 == nil && len(token) > 0 {
 				fmt.Println("generated root-token:", token)
 			}
@@ -675,6 +733,7 @@ func generateRootToken(clientGetter genericclioptions.RESTClientGetter) error {
 }
 
 func NewCmdRotateToken(clientGetter genericclioptions.RESTClientGetter) *cobra.Command {
+	o := newRotateTokenOptions()
 	cmd := &cobra.Command{
 		Use:   "rotate",
 		Short: "rotate vault root-token",
@@ -682,9 +741,26 @@ func NewCmdRotateToken(clientGetter genericclioptions.RESTClientGetter) *cobra.C
 # rotate vault root token using the unseal keys
 $ kubectl vault root-token rotate vaultserver <name> -n <namespace> [flags]
 
+The new root-token is stored under a staging name together with the journal as soon as it is generated,
+so that a rollback can always revoke it. Then it is verified with lookup-self,
+then it replaces the old root-token, which is kept under a backup name until it is revoked.
+Every step is journaled in the key store, an interrupted rotation is resumed with --resume
+or rolled back with --rollback as long as the old root-token is not revoked.
+The new root-token is generated with the unseal-key shares from the key store, or with the shares
+entered by the key custodians with --keys-from, see "kubectl vault root-token generate --help".
+
 Examples:
  # rotate the vaultserver root-token
  $ kubectl vault root-token rotate vaultserver vault -n demo
+
+ # finish an interrupted rotation, it is rolled back if the new root-token can't be verified
+ $ kubectl vault root-token rotate vaultserver vault -n demo --resume
+
+ # roll back an interrupted rotation to the old root-token
+ $ kubectl vault root-token rotate vaultserver vault -n demo --rollback
+
+ # rotate the vaultserver root-token with the shares of the key custodians
+ $ kubectl vault root-token rotate vaultserver vault -n demo --keys-from=prompt
 `,
 		DisableAutoGenTag: true,
 		Run: func(cmd *cobra.Command, args []string) {
@@ -693,30 +769,52 @@ Examples:
 				ObjectNames = args[1:]
 			}
 
-			if err := rotateRootToken(clientGetter); err != nil {
+			if err := o.rotate(cmd.Context(), clientGetter); err != nil {
 				Fatal(err)
 			}
 			os.Exit(0)
 		},
 	}
 
+	o.addRotateTokenFlags(cmd.Flags())
 	return cmd
 }
 
-func generateToken(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) (string, error) {
+func generateToken(ctx context.Context, cfg *rest.Config, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface, o *keysFromOptions) (string, error) {
 	// For root-token generation
 	// - threshold number of unseal-keys must be present
-	keys, err := getKeys(vs, kubeClient)
+	var keys []string
+	var err error
+	if o.fromStore() {
+		if keys, err = getKeys(ctx, vs, kubeClient); err != nil {
+			return "", err
+		}
+	}
+
+	client, tunnel, err := NewVaultClient(cfg, kubeClient, vs)
 	if err != nil {
 		return "", err
 	}
+	defer tunnel.Close()
 
-	client, err := NewVaultClient(vs)
+	var token string
+	if o.fromStore() {
+		token, err = generateTokenWithClient(ctx, client, vs, keys)
+	} else {
+		token, err = o.generateRootCeremony(ctx, client, vs, kubeClient)
+	}
 	if err != nil {
 		return "", err
 	}
 
-	status, err := client.Sys().GenerateRootInit("", "")
+	fmt.Println("root-token generation successful")
+	return token, nil
+}
+
+// generateTokenWithClient generates a root-token with threshold many of the unseal-keys
+// using an already connected vault client.
+func generateTokenWithClient(ctx context.Context, client *vaultclient.Client, vs *vaultapi.VaultServer, keys []string) (string, error) {
+	status, err := client.Sys().GenerateRootInitWithContext(ctx, "", "")
 	if err != nil {
 		return "", err
 	}
@@ -727,17 +825,25 @@ func generateToken(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) (s
 			break
 		}
 
-		status, err = client.Sys().GenerateRootUpdate(key, status.Nonce)
+		status, err = client.Sys().GenerateRootUpdateWithContext(ctx, key, status.Nonce)
 		if err != nil {
+			// the attempt is cancelled without ctx, so that it is also cleaned up on interrupt
+			_ = client.Sys().GenerateRootCancel()
 			return "", err
 		}
 	}
 
 	if !status.Complete {
+		_ = client.Sys().GenerateRootCancel()
 		return "", errors.New("failed to complete root token generation")
 	}
 
-	tokenBytes, err := base64.RawStdEncoding.DecodeString(status.EncodedToken)
+	return decodeRootToken(status.EncodedToken, otp)
+}
+
+// decodeRootToken decodes the encoded token of a completed root-token generation with its otp.
+func decodeRootToken(encodedToken, otp string) (string, error) {
+	tokenBytes, err := base64.RawStdEncoding.DecodeString(encodedToken)
 	if err != nil {
 		return "", err
 	}
@@ -747,11 +853,10 @@ func generateToken(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) (s
 		return "", err
 	}
 
-	fmt.Println("root-token generation successful")
 	return string(tokenBytes), nil
 }
 
-func rotateRootToken(clientGetter genericclioptions.RESTClientGetter) error {
+func (o *rotateTokenOptions) rotate(ctx context.Context, clientGetter genericclioptions.RESTClientGetter) error {
 	var resourceName string
 	switch ResourceName {
 	case strings.ToLower(vaultapi.ResourceVaultServer), strings.ToLower(vaultapi.ResourceVaultServers):
@@ -792,11 +897,15 @@ func rotateRootToken(clientGetter genericclioptions.RESTClientGetter) error {
 			return err
 		}
 
+		if info.Object, err = vaultserver.ToHub(info.Object); err != nil {
+			return err
+		}
+
 		var err2 error
 		switch info.Object.(type) {
 		case *vaultapi.VaultServer:
 			obj := info.Object.(*vaultapi.VaultServer)
-			err2 = rotateToken(obj, kubeClient)
+			err2 = o.rotateToken(ctx, cfg, obj, kubeClient)
 		default:
 			err2 = errors.New("unknown/unsupported type")
 		}
@@ -805,60 +914,8 @@ func rotateRootToken(clientGetter genericclioptions.RESTClientGetter) error {
 	return err
 }
 
-func rotateToken(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
-	// For root-token rotation:
-	// - new root-token generation must be successful
-	// - old root-token must be present
-	// - old root-token lease must be successfully revoked
-	// - new root-token must be successfully set
-	token, err := generateToken(vs, kubeClient)
-	if err != nil {
-		return err
-	}
-
-	ti, err := token_key_store.NewTokenKeyInterface(vs, kubeClient)
-	if err != nil {
-		return err
-	}
-
-	defer func() {
-		ti.Clean()
-	}()
-
-	client, err := NewVaultClient(vs)
-	if err != nil {
-		return err
-	}
-
-	name := ti.NewTokenName()
-	oldToken, err := ti.Get(name)
-	if err != nil {
-		return err
-	}
-
-	if err = ti.Delete(name); err != nil {
-		return err
-	}
-
-	client.SetToken(oldToken)
-	payload := map[string]any{
-		"token": oldToken,
-	}
-	_, err = client.Logical().Write("auth/token/revoke", payload)
-	if err != nil {
-		return err
-	}
-
-	if err = ti.Set(name, token); err != nil {
-		return err
-	}
-
-	fmt.Println("root-token rotation successful")
-	return nil
-}
-
-func getKeys(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) ([]string, error) {
-	ti, err := token_key_store.NewTokenKeyInterface(vs, kubeClient)
+func getKeys(ctx context.Context, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) ([]string, error) {
+	ti, err := newTokenKeyInterface(vs, kubeClient)
 	if err != nil {
 		return nil, err
 	}
@@ -870,12 +927,12 @@ func getKeys(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) ([]strin
 	var keys []string
 	shares := vs.Spec.Unsealer.SecretShares
 	for i := 0; int64(i) < shares; i++ {
-		name, err := ti.NewUnsealKeyName(i)
+		name, err := ti.NewUnsealKeyName(ctx, i)
 		if err != nil {
 			return nil, err
 		}
 
-		key, err := ti.Get(name)
+		key, err := ti.Get(ctx, name)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,407 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+	tokenapi "kubevault.dev/cli/pkg/token-keys-store/api"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// The suffixes are appended to the root-token name to store the new root-token until it
+// replaces the old one, the old root-token until it is revoked and the rotation journal.
+const (
+	rotateStagingSuffix = "-rotate"
+	rotateBackupSuffix  = "-rotate-old"
+	rotateJournalSuffix = "-rotate-journal"
+)
+
+// The rotation steps in order, each step is journaled after it is done.
+const (
+	rotationStepStarted  = "started"
+	rotationStepStaged   = "staged"
+	rotationStepVerified = "verified"
+	rotationStepBackedUp = "backed-up"
+	rotationStepSwapped  = "swapped"
+	rotationStepRevoked  = "revoked"
+)
+
+type rotateTokenOptions struct {
+	resume   bool
+	rollback bool
+	keys     *keysFromOptions
+}
+
+type rotationJournal struct {
+	Step      string    `json:"step"`
+	StartedAt time.Time `json:"startedAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// rotation is a root-token rotation of a VaultServer, journaled in its key store.
+type rotation struct {
+	ti     tokenapi.TokenKeyInterface
+	client *api.Client
+	name   string
+
+	journal *rotationJournal
+}
+
+func newRotateTokenOptions() *rotateTokenOptions {
+	return &rotateTokenOptions{
+		keys: newKeysFromOptions(),
+	}
+}
+
+func (o *rotateTokenOptions) addRotateTokenFlags(fs *pflag.FlagSet) {
+	fs.BoolVar(&o.resume, "resume", o.resume, "resume an interrupted root-token rotation")
+	fs.BoolVar(&o.rollback, "rollback", o.rollback, "roll back an interrupted root-token rotation")
+	o.keys.addKeysFromFlags(fs)
+	o.keys.addGenerateRootFlags(fs)
+}
+
+func (o *rotateTokenOptions) rotateToken(ctx context.Context, cfg *rest.Config, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
+	// For root-token rotation:
+	// - new root-token generation must be successful
+	// - new root-token must be stored under the staging name and verified
+	// - old root-token must be present, it is stored under the backup name
+	// - new root-token must be successfully set
+	// - old root-token must be successfully revoked
+	if o.resume && o.rollback {
+		return errors.New("--resume and --rollback are mutually exclusive")
+	}
+
+	ti, err := newTokenKeyInterface(vs, kubeClient)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		ti.Clean()
+	}()
+
+	client, tunnel, err := NewVaultClient(cfg, kubeClient, vs)
+	if err != nil {
+		return err
+	}
+	defer tunnel.Close()
+
+	r := &rotation{
+		ti:     ti,
+		client: client,
+		name:   ti.NewTokenName(ctx),
+	}
+	if len(r.name) == 0 {
+		return errors.New("failed to get root-token name")
+	}
+
+	if r.journal, err = r.readJournal(ctx); err != nil {
+		return err
+	}
+
+	if done, err := o.interrupted(ctx, r); done {
+		return err
+	}
+
+	r.journal = &rotationJournal{StartedAt: time.Now().UTC()}
+	if err = r.record(ctx, rotationStepStarted); err != nil {
+		return err
+	}
+
+	token, err := generateToken(ctx, cfg, vs, kubeClient, o.keys)
+	if err != nil {
+		return r.abort(ctx, err)
+	}
+
+	// the new root-token is live now. It is staged without ctx and interrupts are held until
+	// then, so that it is journaled and revoked by a rollback, or revoked right away.
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	err = r.stage(context.Background(), token)
+	signal.Stop(sigCh)
+	if err != nil {
+		if err2 := revokeToken(context.Background(), client, token); err2 != nil {
+			return r.abort(context.Background(), errors.Wrapf(err, "failed to stage the new root-token and to revoke it: %v", err2))
+		}
+		return r.abort(context.Background(), errors.Wrap(err, "failed to stage the new root-token, it is revoked"))
+	}
+
+	return r.run(ctx)
+}
+
+// interrupted resumes or rolls back the journaled rotation as requested by --resume or --rollback.
+// It reports false if there is no interrupted rotation and a new one can be started.
+func (o *rotateTokenOptions) interrupted(ctx context.Context, r *rotation) (bool, error) {
+	switch {
+	case o.rollback:
+		if r.journal == nil {
+			return true, errors.New("no interrupted root-token rotation found")
+		}
+		return true, r.rollback(ctx)
+	case o.resume:
+		if r.journal == nil {
+			return true, errors.New("no interrupted root-token rotation found")
+		}
+		return true, r.run(ctx)
+	case r.journal != nil:
+		return true, errors.Errorf("found a root-token rotation started at %s that was interrupted after step %s, run with --resume or --rollback",
+			r.journal.StartedAt.Format(time.RFC3339), r.journal.Step)
+	}
+	return false, nil
+}
+
+// run continues the rotation from the journaled step.
+func (r *rotation) run(ctx context.Context) error {
+	for {
+		switch r.journal.Step {
+		case rotationStepStarted:
+			// the rotation was interrupted before the new root-token was staged
+			staged, err := r.stored(ctx, rotateStagingSuffix)
+			if err != nil {
+				return err
+			}
+			if !staged {
+				fmt.Println("no new root-token was staged, rolling back")
+				return r.rollback(ctx)
+			}
+			if err = r.record(ctx, rotationStepStaged); err != nil {
+				return err
+			}
+
+		case rotationStepStaged:
+			token, err := r.ti.Get(ctx, r.name+rotateStagingSuffix)
+			if err != nil {
+				return err
+			}
+			c, err := r.client.Clone()
+			if err != nil {
+				return err
+			}
+			c.SetToken(token)
+			if _, err = c.Auth().Token().LookupSelfWithContext(ctx); err != nil {
+				fmt.Printf("failed to verify the new root-token, rolling back: %v\n", err)
+				if err2 := r.rollback(ctx); err2 != nil {
+					return err2
+				}
+				return errors.Wrap(err, "failed to verify the new root-token")
+			}
+			if err = r.record(ctx, rotationStepVerified); err != nil {
+				return err
+			}
+
+		case rotationStepVerified:
+			oldToken, err := r.ti.Get(ctx, r.name)
+			if err != nil {
+				return errors.Wrap(err, "failed to read the old root-token")
+			}
+			if err = r.ti.Set(ctx, r.name+rotateBackupSuffix, oldToken); err != nil {
+				return err
+			}
+			if err = r.record(ctx, rotationStepBackedUp); err != nil {
+				return err
+			}
+
+		case rotationStepBackedUp:
+			token, err := r.ti.Get(ctx, r.name+rotateStagingSuffix)
+			if err != nil {
+				return err
+			}
+			if err = r.ti.Set(ctx, r.name, token); err != nil {
+				return err
+			}
+			if err = r.record(ctx, rotationStepSwapped); err != nil {
+				return err
+			}
+
+		case rotationStepSwapped:
+			oldToken, err := r.ti.Get(ctx, r.name+rotateBackupSuffix)
+			if err != nil {
+				return err
+			}
+			if err = revokeToken(ctx, r.client, oldToken); err != nil {
+				return errors.Wrap(err, "failed to revoke the old root-token")
+			}
+			if err = r.record(ctx, rotationStepRevoked); err != nil {
+				return err
+			}
+
+		case rotationStepRevoked:
+			if err := r.cleanup(ctx); err != nil {
+				return err
+			}
+			fmt.Println("root-token rotation successful")
+			return nil
+
+		default:
+			return errors.Errorf("unknown root-token rotation step %s", r.journal.Step)
+		}
+	}
+}
+
+// rollback restores the old root-token and revokes the new one, which is only possible
+// until the old root-token is revoked.
+func (r *rotation) rollback(ctx context.Context) error {
+	switch r.journal.Step {
+	case rotationStepRevoked:
+		return errors.New("the old root-token is already revoked, run with --resume to finish the rotation")
+	case rotationStepBackedUp, rotationStepSwapped:
+		oldToken, err := r.ti.Get(ctx, r.name+rotateBackupSuffix)
+		if err != nil {
+			return errors.Wrap(err, "failed to read the old root-token backup")
+		}
+		if err = r.ti.Set(ctx, r.name, oldToken); err != nil {
+			return err
+		}
+	}
+
+	// the staged root-token is deleted by cleanup, so it must be revoked first
+	token, err := r.ti.Get(ctx, r.name+rotateStagingSuffix)
+	if err == nil {
+		if err = revokeToken(ctx, r.client, token); err != nil {
+			return errors.Wrap(err, "failed to revoke the new root-token")
+		}
+	} else if !tokenapi.IsNotFound(err) {
+		return errors.Wrap(err, "failed to read the new root-token")
+	}
+
+	if err = r.cleanup(ctx); err != nil {
+		return err
+	}
+	fmt.Println("root-token rotation rolled back")
+	return nil
+}
+
+// abort ends a rotation that failed before the new root-token was staged.
+func (r *rotation) abort(ctx context.Context, err error) error {
+	if err2 := r.ti.Delete(ctx, r.name+rotateJournalSuffix); err2 != nil {
+		return errors.Wrapf(err, "failed to delete the root-token rotation journal: %v", err2)
+	}
+	return err
+}
+
+// cleanup deletes the staged and backed up root-tokens and the journal, the journal last.
+// Only stored keys are deleted, since some key stores fail to delete a missing key.
+func (r *rotation) cleanup(ctx context.Context) error {
+	for _, suffix := range []string{rotateStagingSuffix, rotateBackupSuffix, rotateJournalSuffix} {
+		found, err := r.stored(ctx, suffix)
+		if err != nil {
+			return err
+		}
+		if found {
+			if err = r.ti.Delete(ctx, r.name+suffix); err != nil {
+				return err
+			}
+		}
+	}
+	r.journal = nil
+	return nil
+}
+
+// stored reports whether the root-token name with the suffix is stored.
+func (r *rotation) stored(ctx context.Context, suffix string) (bool, error) {
+	keys, err := r.ti.List(ctx, r.name+suffix)
+	if err != nil {
+		return false, err
+	}
+	for _, key := range keys {
+		if sameKeyName(key.Name, r.name+suffix) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *rotation) readJournal(ctx context.Context) (*rotationJournal, error) {
+	found, err := r.stored(ctx, rotateJournalSuffix)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	data, err := r.ti.Get(ctx, r.name+rotateJournalSuffix)
+	if err != nil {
+		return nil, err
+	}
+	var journal rotationJournal
+	if err = json.Unmarshal([]byte(data), &journal); err != nil {
+		return nil, errors.Wrap(err, "failed to parse the root-token rotation journal")
+	}
+	return &journal, nil
+}
+
+func (r *rotation) record(ctx context.Context, step string) error {
+	data, err := r.journalStep(step)
+	if err != nil {
+		return err
+	}
+	if err = r.ti.Set(ctx, r.name+rotateJournalSuffix, data); err != nil {
+		return errors.Wrapf(err, "failed to journal root-token rotation step %s", step)
+	}
+	return nil
+}
+
+// stage stores the new root-token under the staging name and journals the staged step
+// in the same write, so that a journaled rotation never misses a generated root-token.
+func (r *rotation) stage(ctx context.Context, token string) error {
+	data, err := r.journalStep(rotationStepStaged)
+	if err != nil {
+		return err
+	}
+	return r.ti.SetMany(ctx, map[string]string{
+		r.name + rotateStagingSuffix: token,
+		r.name + rotateJournalSuffix: data,
+	})
+}
+
+func (r *rotation) journalStep(step string) (string, error) {
+	r.journal.Step = step
+	r.journal.UpdatedAt = time.Now().UTC()
+	data, err := json.Marshal(r.journal)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// revokeToken revokes the token with itself, a token that is already invalid counts as revoked.
+func revokeToken(ctx context.Context, client *api.Client, token string) error {
+	c, err := client.Clone()
+	if err != nil {
+		return err
+	}
+	c.SetToken(token)
+
+	err = c.Auth().Token().RevokeSelfWithContext(ctx, "")
+	var respErr *api.ResponseError
+	if errors.As(err, &respErr) && respErr.StatusCode == http.StatusForbidden {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,382 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"kubevault.dev/cli/pkg/token-keys-store/fake"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// fakeTokens serves auth/token/lookup-self and auth/token/revoke-self for the live tokens.
+type fakeTokens struct {
+	mu   sync.Mutex
+	live map[string]bool
+}
+
+func (f *fakeTokens) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	token := r.Header.Get("X-Vault-Token")
+	if !f.live[token] {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v1/auth/token/lookup-self":
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"id": token}})
+	case "/v1/auth/token/revoke-self":
+		delete(f.live, token)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakeTokenClient(t *testing.T, live ...string) (*api.Client, *fakeTokens) {
+	t.Helper()
+
+	tokens := &fakeTokens{live: map[string]bool{}}
+	for _, token := range live {
+		tokens.live[token] = true
+	}
+	srv := httptest.NewServer(tokens)
+	t.Cleanup(srv.Close)
+
+	cfg := api.DefaultConfig()
+	cfg.Address = srv.URL
+	client, err := api.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, tokens
+}
+
+const (
+	rootTokenName = "vault-root-token"
+	stagedName    = rootTokenName + rotateStagingSuffix
+	backupName    = rootTokenName + rotateBackupSuffix
+	journalName   = rootTokenName + rotateJournalSuffix
+)
+
+// journaled returns the stored keys of a rotation interrupted after the step.
+func journaled(t *testing.T, step string, keys map[string]string) map[string]string {
+	t.Helper()
+
+	data, err := json.Marshal(rotationJournal{Step: step, StartedAt: time.Now().UTC()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys = maps.Clone(keys)
+	keys[journalName] = string(data)
+	return keys
+}
+
+func newTestRotation(t *testing.T, store *fake.Store, client *api.Client) *rotation {
+	t.Helper()
+
+	r := &rotation{ti: store, client: client, name: rootTokenName}
+	var err error
+	if r.journal, err = r.readJournal(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRotationResume(t *testing.T) {
+	rotated := map[string]string{rootTokenName: "new"}
+	tests := []struct {
+		name     string
+		stored   map[string]string
+		live     []string
+		want     map[string]string
+		wantLive []string
+		wantErr  bool
+	}{
+		{
+			name:     "started without a staged root-token",
+			stored:   journaled(t, rotationStepStarted, map[string]string{rootTokenName: "old"}),
+			live:     []string{"old"},
+			want:     map[string]string{rootTokenName: "old"},
+			wantLive: []string{"old"},
+		},
+		{
+			name:     "started with a staged root-token",
+			stored:   journaled(t, rotationStepStarted, map[string]string{rootTokenName: "old", stagedName: "new"}),
+			live:     []string{"old", "new"},
+			want:     rotated,
+			wantLive: []string{"new"},
+		},
+		{
+			name:     "staged",
+			stored:   journaled(t, rotationStepStaged, map[string]string{rootTokenName: "old", stagedName: "new"}),
+			live:     []string{"old", "new"},
+			want:     rotated,
+			wantLive: []string{"new"},
+		},
+		{
+			name:     "staged root-token not live",
+			stored:   journaled(t, rotationStepStaged, map[string]string{rootTokenName: "old", stagedName: "new"}),
+			live:     []string{"old"},
+			want:     map[string]string{rootTokenName: "old"},
+			wantLive: []string{"old"},
+			wantErr:  true,
+		},
+		{
+			name:     "verified",
+			stored:   journaled(t, rotationStepVerified, map[string]string{rootTokenName: "old", stagedName: "new"}),
+			live:     []string{"old", "new"},
+			want:     rotated,
+			wantLive: []string{"new"},
+		},
+		{
+			name:     "backed up",
+			stored:   journaled(t, rotationStepBackedUp, map[string]string{rootTokenName: "old", stagedName: "new", backupName: "old"}),
+			live:     []string{"old", "new"},
+			want:     rotated,
+			wantLive: []string{"new"},
+		},
+		{
+			name:     "swapped",
+			stored:   journaled(t, rotationStepSwapped, map[string]string{rootTokenName: "new", stagedName: "new", backupName: "old"}),
+			live:     []string{"old", "new"},
+			want:     rotated,
+			wantLive: []string{"new"},
+		},
+		{
+			name:     "revoked",
+			stored:   journaled(t, rotationStepRevoked, map[string]string{rootTokenName: "new", stagedName: "new", backupName: "old"}),
+			live:     []string{"new"},
+			want:     rotated,
+			wantLive: []string{"new"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, tokens := newFakeTokenClient(t, tt.live...)
+			store := fake.NewStore(maps.Clone(tt.stored))
+			o := &rotateTokenOptions{resume: true}
+
+			done, err := o.interrupted(context.Background(), newTestRotation(t, store, client))
+			if !done {
+				t.Fatal("interrupted() didn't resume the rotation")
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("interrupted() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(store.Values, tt.want) {
+				t.Errorf("interrupted() stored %v, want %v", store.Values, tt.want)
+			}
+			if !reflect.DeepEqual(liveTokens(tokens), tt.wantLive) {
+				t.Errorf("interrupted() left live tokens %v, want %v", liveTokens(tokens), tt.wantLive)
+			}
+		})
+	}
+}
+
+func TestRotationRollback(t *testing.T) {
+	restored := map[string]string{rootTokenName: "old"}
+	tests := []struct {
+		name     string
+		stored   map[string]string
+		getErr   error
+		live     []string
+		want     map[string]string
+		wantLive []string
+		wantErr  bool
+	}{
+		{
+			name:     "started",
+			stored:   journaled(t, rotationStepStarted, map[string]string{rootTokenName: "old"}),
+			live:     []string{"old"},
+			want:     restored,
+			wantLive: []string{"old"},
+		},
+		{
+			name:     "staged",
+			stored:   journaled(t, rotationStepStaged, map[string]string{rootTokenName: "old", stagedName: "new"}),
+			live:     []string{"old", "new"},
+			want:     restored,
+			wantLive: []string{"old"},
+		},
+		{
+			name:     "swapped",
+			stored:   journaled(t, rotationStepSwapped, map[string]string{rootTokenName: "new", stagedName: "new", backupName: "old"}),
+			live:     []string{"old", "new"},
+			want:     restored,
+			wantLive: []string{"old"},
+		},
+		{
+			name:     "revoked",
+			stored:   journaled(t, rotationStepRevoked, map[string]string{rootTokenName: "new", stagedName: "new", backupName: "old"}),
+			live:     []string{"new"},
+			want:     journaled(t, rotationStepRevoked, map[string]string{rootTokenName: "new", stagedName: "new", backupName: "old"}),
+			wantLive: []string{"new"},
+			wantErr:  true,
+		},
+		{
+			// the staged root-token must not be deleted unless it is revoked
+			name:     "staged root-token can't be read",
+			stored:   journaled(t, rotationStepStaged, map[string]string{rootTokenName: "old", stagedName: "new"}),
+			getErr:   errors.New("store unavailable"),
+			live:     []string{"old", "new"},
+			want:     journaled(t, rotationStepStaged, map[string]string{rootTokenName: "old", stagedName: "new"}),
+			wantLive: []string{"new", "old"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, tokens := newFakeTokenClient(t, tt.live...)
+			store := fake.NewStore(maps.Clone(tt.stored))
+			r := newTestRotation(t, store, client)
+			store.GetErr = tt.getErr
+
+			done, err := (&rotateTokenOptions{rollback: true}).interrupted(context.Background(), r)
+			if !done {
+				t.Fatal("interrupted() didn't roll back the rotation")
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("interrupted() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !sameKeys(store.Values, tt.want) {
+				t.Errorf("interrupted() stored %v, want %v", store.Values, tt.want)
+			}
+			if !reflect.DeepEqual(liveTokens(tokens), tt.wantLive) {
+				t.Errorf("interrupted() left live tokens %v, want %v", liveTokens(tokens), tt.wantLive)
+			}
+		})
+	}
+}
+
+func TestRotationInterrupted(t *testing.T) {
+	stored := journaled(t, rotationStepStaged, map[string]string{rootTokenName: "old", stagedName: "new"})
+	tests := []struct {
+		name     string
+		opts     rotateTokenOptions
+		stored   map[string]string
+		wantDone bool
+		wantErr  bool
+	}{
+		{name: "no rotation", stored: map[string]string{rootTokenName: "old"}},
+		{name: "interrupted rotation", stored: stored, wantDone: true, wantErr: true},
+		{name: "resume without a rotation", opts: rotateTokenOptions{resume: true}, stored: map[string]string{rootTokenName: "old"}, wantDone: true, wantErr: true},
+		{name: "rollback without a rotation", opts: rotateTokenOptions{rollback: true}, stored: map[string]string{rootTokenName: "old"}, wantDone: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := newFakeTokenClient(t, "old", "new")
+			store := fake.NewStore(maps.Clone(tt.stored))
+
+			done, err := tt.opts.interrupted(context.Background(), newTestRotation(t, store, client))
+			if done != tt.wantDone {
+				t.Errorf("interrupted() = %v, want %v", done, tt.wantDone)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("interrupted() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(store.Values, tt.stored) {
+				t.Errorf("interrupted() stored %v, want %v", store.Values, tt.stored)
+			}
+		})
+	}
+}
+
+func TestRotationStage(t *testing.T) {
+	tests := []struct {
+		name    string
+		failing string
+		want    []string
+		wantErr bool
+	}{
+		{name: "staged and journaled", want: []string{rootTokenName, stagedName, journalName}},
+		{name: "journal fails", failing: journalName, want: []string{rootTokenName}, wantErr: true},
+		{name: "staging fails", failing: stagedName, want: []string{rootTokenName}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := fake.NewStore(map[string]string{rootTokenName: "old"})
+			store.Failing = tt.failing
+			r := &rotation{ti: store, name: rootTokenName, journal: &rotationJournal{StartedAt: time.Now().UTC()}}
+
+			err := r.stage(context.Background(), "new")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("stage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := storedNames(store); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stage() stored %v, want %v", got, tt.want)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			journal, err := r.readJournal(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if journal == nil || journal.Step != rotationStepStaged {
+				t.Errorf("stage() journaled %+v, want step %s", journal, rotationStepStaged)
+			}
+		})
+	}
+}
+
+func liveTokens(tokens *fakeTokens) []string {
+	tokens.mu.Lock()
+	defer tokens.mu.Unlock()
+
+	var live []string
+	for token := range tokens.live {
+		live = append(live, token)
+	}
+	slices.Sort(live)
+	return live
+}
+
+func storedNames(store *fake.Store) []string {
+	names := slices.Collect(maps.Keys(store.Values))
+	slices.Sort(names)
+	return names
+}
+
+// sameKeys compares the stored keys, ignoring the timestamps of the journal.
+func sameKeys(got, want map[string]string) bool {
+	if !reflect.DeepEqual(slices.Sorted(maps.Keys(got)), slices.Sorted(maps.Keys(want))) {
+		return false
+	}
+	for key, value := range want {
+		if key != journalName && got[key] != value {
+			return false
+		}
+	}
+	return true
+}
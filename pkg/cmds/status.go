@@ -0,0 +1,292 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/yaml"
+)
+
+type statusOptions struct {
+	output        string
+	allNamespaces bool
+}
+
+type vaultServerStatus struct {
+	Namespace        string                      `json:"namespace"`
+	Name             string                      `json:"name"`
+	Phase            vaultapi.VaultServerPhase   `json:"phase,omitempty"`
+	Initialized      bool                        `json:"initialized"`
+	VaultStatus      vaultapi.VaultStatus        `json:"vaultStatus"`
+	AuthMethodStatus []vaultapi.AuthMethodStatus `json:"authMethodStatus,omitempty"`
+	Pods             []vaultPodStatus            `json:"pods,omitempty"`
+}
+
+type vaultPodStatus struct {
+	Name       string                  `json:"name"`
+	SealStatus *api.SealStatusResponse `json:"sealStatus,omitempty"`
+	Leader     *api.LeaderResponse     `json:"leader,omitempty"`
+	HAStatus   *api.HAStatusResponse   `json:"haStatus,omitempty"`
+	Errors     []string                `json:"errors,omitempty"`
+}
+
+func newStatusOptions() *statusOptions {
+	return &statusOptions{}
+}
+
+func (o *statusOptions) addStatusFlags(fs *pflag.FlagSet) {
+	fs.StringVarP(&o.output, "output", "o", o.output, "output format json/yaml. prints a table otherwise")
+	fs.BoolVarP(&o.allNamespaces, "all-namespaces", "A", o.allNamespaces, "show the status of vaultservers across all namespaces")
+}
+
+func NewCmdStatus(clientGetter genericclioptions.RESTClientGetter) *cobra.Command {
+	o := newStatusOptions()
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "show vaultserver status",
+		Long: `
+$ kubectl vault status vaultserver <name> -n <namespace> [flags]
+
+Shows the phase, initialization, active/standby/sealed pods and auth method status of a vaultserver
+together with the live sys/seal-status, sys/leader and sys/ha-status of each vault pod.
+sys/ha-status requires a token, which is read from the VAULT_TOKEN env variable.
+
+Examples:
+ # show the status of a vaultserver with name vault in demo namespace
+ $ kubectl vault status vaultserver vault -n demo
+
+ # show the status of all vaultservers in json format
+ $ kubectl vault status vaultserver --all-namespaces -o json
+`,
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				ResourceName = args[0]
+				ObjectNames = args[1:]
+			}
+
+			if err := o.status(clientGetter); err != nil {
+				Fatal(err)
+			}
+			os.Exit(0)
+		},
+	}
+
+	o.addStatusFlags(cmd.Flags())
+	return cmd
+}
+
+func (o *statusOptions) status(clientGetter genericclioptions.RESTClientGetter) error {
+	switch o.output {
+	case "", "json", "yaml":
+	default:
+		return errors.Errorf("unknown/unsupported output format %s", o.output)
+	}
+
+	cfg, err := clientGetter.ToRESTConfig()
+	if err != nil {
+		return errors.Wrap(err, "failed to read kubeconfig")
+	}
+
+	var statuses []vaultServerStatus
+	sel := vaultServerSelector{
+		selectAll:     true,
+		allNamespaces: o.allNamespaces,
+	}
+	err = visitVaultServerResources(clientGetter, sel, func(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface, _ *resource.Helper) error {
+		st, err := getVaultServerStatus(cfg, vs, kubeClient)
+		if err != nil {
+			return err
+		}
+		statuses = append(statuses, *st)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return o.Print(statuses)
+}
+
+func getVaultServerStatus(cfg *rest.Config, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) (*vaultServerStatus, error) {
+	st := &vaultServerStatus{
+		Namespace:        vs.Namespace,
+		Name:             vs.Name,
+		Phase:            vs.Status.Phase,
+		Initialized:      vs.Status.Initialized,
+		VaultStatus:      vs.Status.VaultStatus,
+		AuthMethodStatus: vs.Status.AuthMethodStatus,
+	}
+
+	pods, err := kubeClient.CoreV1().Pods(vs.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(vs.OffshootSelectors()).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pod := range pods.Items {
+		st.Pods = append(st.Pods, getVaultPodStatus(cfg, vs, kubeClient, pod.Name))
+	}
+
+	return st, nil
+}
+
+// getVaultPodStatus never fails, errors are recorded in the returned status
+// so that one unreachable pod does not hide the state of the others.
+func getVaultPodStatus(cfg *rest.Config, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface, podName string) vaultPodStatus {
+	ps := vaultPodStatus{
+		Name: podName,
+	}
+
+	client, tunnel, err := NewVaultClientForPod(cfg, kubeClient, vs, podName)
+	if err != nil {
+		ps.Errors = append(ps.Errors, err.Error())
+		return ps
+	}
+	defer tunnel.Close()
+
+	if ps.SealStatus, err = client.Sys().SealStatus(); err != nil {
+		ps.Errors = append(ps.Errors, errors.Wrap(err, "sys/seal-status").Error())
+	}
+
+	if ps.Leader, err = client.Sys().Leader(); err != nil {
+		ps.Errors = append(ps.Errors, errors.Wrap(err, "sys/leader").Error())
+	}
+
+	if len(client.Token()) > 0 {
+		if ps.HAStatus, err = client.Sys().HAStatus(); err != nil {
+			ps.Errors = append(ps.Errors, errors.Wrap(err, "sys/ha-status").Error())
+		}
+	}
+
+	return ps
+}
+
+func (o *statusOptions) Print(statuses []vaultServerStatus) error {
+	switch o.output {
+	case "json":
+		data, err := json.MarshalIndent(statuses, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	case "yaml":
+		data, err := yaml.Marshal(statuses)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+		return nil
+	}
+
+	w := printers.GetNewTabWriter(os.Stdout)
+	for idx, st := range statuses {
+		if idx > 0 {
+			_, _ = fmt.Fprintln(w)
+		}
+
+		_, _ = fmt.Fprintln(w, "NAMESPACE\tNAME\tPHASE\tINITIALIZED\tACTIVE\tSTANDBY\tSEALED\tUNSEALED")
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\t%s\t%s\t%s\n", st.Namespace, st.Name, st.Phase, st.Initialized,
+			orNone(st.VaultStatus.Active), orNone(strings.Join(st.VaultStatus.Standby, ",")),
+			orNone(strings.Join(st.VaultStatus.Sealed, ",")), orNone(strings.Join(st.VaultStatus.Unsealed, ",")))
+
+		_, _ = fmt.Fprintln(w)
+		_, _ = fmt.Fprintln(w, "POD\tINITIALIZED\tSEALED\tPROGRESS\tHA-MODE\tLEADER\tVERSION\tERROR")
+		for _, ps := range st.Pods {
+			initialized, sealed, progress, version := "<unknown>", "<unknown>", "<unknown>", "<unknown>"
+			if ps.SealStatus != nil {
+				initialized = fmt.Sprintf("%t", ps.SealStatus.Initialized)
+				sealed = fmt.Sprintf("%t", ps.SealStatus.Sealed)
+				progress = fmt.Sprintf("%d/%d", ps.SealStatus.Progress, ps.SealStatus.T)
+				version = ps.SealStatus.Version
+			}
+
+			haMode, leader := "<unknown>", "<unknown>"
+			if ps.Leader != nil {
+				leader = orNone(ps.Leader.LeaderAddress)
+				switch {
+				case !ps.Leader.HAEnabled:
+					haMode = "disabled"
+				case ps.Leader.IsSelf:
+					haMode = "active"
+				default:
+					haMode = "standby"
+				}
+			}
+
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", ps.Name, initialized, sealed, progress, haMode, leader, version,
+				orNone(strings.Join(ps.Errors, "; ")))
+		}
+
+		// every pod reports the same sys/ha-status, it is shown once for the vaultserver
+		for _, ps := range st.Pods {
+			if ps.HAStatus == nil {
+				continue
+			}
+
+			_, _ = fmt.Fprintln(w)
+			_, _ = fmt.Fprintln(w, "HA-NODE\tACTIVE\tAPI-ADDRESS\tCLUSTER-ADDRESS\tLAST-ECHO\tVERSION")
+			for _, node := range ps.HAStatus.Nodes {
+				lastEcho := "<none>"
+				if node.LastEcho != nil {
+					lastEcho = node.LastEcho.UTC().Format(time.RFC3339)
+				}
+				_, _ = fmt.Fprintf(w, "%s\t%t\t%s\t%s\t%s\t%s\n", node.Hostname, node.ActiveNode, orNone(node.APIAddress),
+					orNone(node.ClusterAddress), lastEcho, orNone(node.Version))
+			}
+			break
+		}
+
+		if len(st.AuthMethodStatus) > 0 {
+			_, _ = fmt.Fprintln(w)
+			_, _ = fmt.Fprintln(w, "AUTH-METHOD\tPATH\tSTATUS\tREASON")
+			for _, am := range st.AuthMethodStatus {
+				_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", am.Type, am.Path, am.Status, orNone(am.Reason))
+			}
+		}
+	}
+
+	return w.Flush()
+}
+
+func orNone(s string) string {
+	if len(s) == 0 {
+		return "<none>"
+	}
+	return s
+}
@@ -0,0 +1,209 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func NewCmdUnseal(clientGetter genericclioptions.RESTClientGetter) *cobra.Command {
+	o := newKeysFromOptions()
+	cmd := &cobra.Command{
+		Use:   "unseal",
+		Short: "unseal vault pods",
+		Long: `
+# unseal the sealed vault pods using the unseal keys from the configured key store
+$ kubectl vault unseal vaultserver <name> -n <namespace> [flags]
+
+With --keys-from=prompt the key custodians enter their unseal-key shares without echo, with
+--keys-from=stdin or --keys-from=files the shares are read one per line from stdin or one per file.
+The shares are entered once and submitted to every sealed pod. An empty share ends the session,
+the unseal progress of the pods is kept and resumed by the next session unless --cancel-in-progress
+is set. With the key store the unseal progress is always started over.
+
+Examples:
+ # unseal the sealed pods of a vaultserver with name vault in demo namespace
+ $ kubectl vault unseal vaultserver vault -n demo
+
+ # unseal the sealed pods with the shares of the key custodians
+ $ kubectl vault unseal vaultserver vault -n demo --keys-from=prompt
+`,
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 {
+				ResourceName = args[0]
+				ObjectNames = args[1:]
+			}
+
+			if err := unsealVaultServer(cmd.Context(), clientGetter, o); err != nil {
+				Fatal(err)
+			}
+			os.Exit(0)
+		},
+	}
+
+	o.addKeysFromFlags(cmd.Flags())
+	return cmd
+}
+
+func unsealVaultServer(ctx context.Context, clientGetter genericclioptions.RESTClientGetter, o *keysFromOptions) error {
+	cfg, err := clientGetter.ToRESTConfig()
+	if err != nil {
+		return errors.Wrap(err, "failed to read kubeconfig")
+	}
+
+	return visitVaultServers(clientGetter, func(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
+		return unseal(ctx, cfg, vs, kubeClient, o)
+	})
+}
+
+func unseal(ctx context.Context, cfg *rest.Config, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface, o *keysFromOptions) error {
+	// For unsealing:
+	// - threshold number of unseal-keys must be present
+	src, err := o.keySource(ctx, vs, kubeClient)
+	if err != nil {
+		return err
+	}
+
+	if o.fromStore() && int64(len(src.keys)) < vs.Spec.Unsealer.SecretThreshold {
+		return errors.Errorf("found %d unseal-keys, %d required", len(src.keys), vs.Spec.Unsealer.SecretThreshold)
+	}
+
+	podNames, err := getVaultPodNames(vs, kubeClient)
+	if err != nil {
+		return err
+	}
+
+	// the unseal progress of an earlier attempt is resumed only with shares entered by the custodians
+	reset := o.fromStore() || o.cancelInProgress
+
+	var failed []string
+	for _, podName := range podNames {
+		src.rewind()
+		if err = unsealPod(ctx, cfg, vs, kubeClient, podName, src, reset); err != nil {
+			fmt.Printf("%s: %s\n", podName, err)
+			failed = append(failed, podName)
+		}
+	}
+
+	if len(failed) > 0 {
+		return errors.Errorf("failed to unseal pods %s", strings.Join(failed, ", "))
+	}
+
+	fmt.Printf("vaultserver %s/%s successfully unsealed\n", vs.Namespace, vs.Name)
+	return nil
+}
+
+// getVaultPodNames returns the existing vault pods. Pods that are reported as sealed in the
+// VaultServer status but do not exist are stale entries of the status and are only reported.
+func getVaultPodNames(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) ([]string, error) {
+	pods, err := kubeClient.CoreV1().Pods(vs.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(vs.OffshootSelectors()).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var podNames []string
+	found := map[string]bool{}
+	for _, pod := range pods.Items {
+		podNames = append(podNames, pod.Name)
+		found[pod.Name] = true
+	}
+
+	for _, podName := range vs.Status.VaultStatus.Sealed {
+		if !found[podName] {
+			fmt.Printf("%s: reported as sealed in the status of vaultserver %s/%s, but the pod does not exist\n", podName, vs.Namespace, vs.Name)
+		}
+	}
+
+	return podNames, nil
+}
+
+func unsealPod(ctx context.Context, cfg *rest.Config, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface, podName string, src *keySource, reset bool) error {
+	client, tunnel, err := NewVaultClientForPod(cfg, kubeClient, vs, podName)
+	if err != nil {
+		return err
+	}
+	defer tunnel.Close()
+
+	status, err := client.Sys().SealStatus()
+	if err != nil {
+		return err
+	}
+
+	if !status.Initialized {
+		return errors.New("vault is not initialized")
+	}
+
+	if !status.Sealed {
+		fmt.Printf("%s: already unsealed\n", podName)
+		return nil
+	}
+
+	// discard the progress of any earlier unseal attempt
+	if status.Progress > 0 && reset {
+		if status, err = client.Sys().ResetUnsealProcess(); err != nil {
+			return err
+		}
+	} else if status.Progress > 0 {
+		fmt.Printf("%s: resuming unseal progress %d/%d\n", podName, status.Progress, status.T)
+	}
+
+	for idx := 0; status.Sealed; idx++ {
+		key, err := src.next(ctx, fmt.Sprintf("Enter unseal-key share for %s (progress %d/%d, empty to stop): ", podName, status.Progress, status.T))
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		status, err = client.Sys().UnsealWithOptions(&api.UnsealOpts{
+			Key: key,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to submit unseal-key %d", idx)
+		}
+
+		if status.Sealed {
+			fmt.Printf("%s: unseal progress %d/%d\n", podName, status.Progress, status.T)
+		}
+	}
+
+	if status.Sealed {
+		return errors.Errorf("still sealed, unseal progress %d/%d", status.Progress, status.T)
+	}
+
+	fmt.Printf("%s: unsealed\n", podName)
+	return nil
+}
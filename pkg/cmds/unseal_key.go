@@ -17,13 +17,17 @@ limitations under the License.
 package cmds
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
-	token_key_store "kubevault.dev/cli/pkg/token-keys-store"
+	"kubevault.dev/cli/pkg/encryption"
 	"kubevault.dev/cli/pkg/token-keys-store/api"
+	"kubevault.dev/cli/pkg/vaultserver"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -36,8 +40,13 @@ import (
 )
 
 type getKeyOptions struct {
-	keyId   int
-	keyName string
+	keyId     int
+	keyName   string
+	pgpKeys   []string
+	outputDir string
+
+	// pgpKey is the public key file of the custodian of the current unseal-key
+	pgpKey string
 }
 
 type setKeyOptions struct {
@@ -52,7 +61,9 @@ type delKeyOptions struct {
 }
 
 func newGetKeyOptions() *getKeyOptions {
-	return &getKeyOptions{}
+	return &getKeyOptions{
+		outputDir: ".",
+	}
 }
 
 func newSetKeyOptions() *setKeyOptions {
@@ -66,6 +77,12 @@ func newDelKeyOptions() *delKeyOptions {
 func (o *getKeyOptions) addGetKeyFlags(fs *pflag.FlagSet) {
 	fs.IntVar(&o.keyId, "key-id", o.keyId, "get the latest unseal key with id")
 	fs.StringVar(&o.keyName, "key-name", o.keyName, "get unseal key with key-name")
+	o.addPGPFlags(fs)
+}
+
+func (o *getKeyOptions) addPGPFlags(fs *pflag.FlagSet) {
+	fs.StringSliceVar(&o.pgpKeys, "pgp-keys", o.pgpKeys, "comma separated OpenPGP public key files, the n-th unseal-key is encrypted to the n-th key and written to a separate armored file")
+	fs.StringVar(&o.outputDir, "output-dir", o.outputDir, "directory to write the OpenPGP encrypted unseal-keys to")
 }
 
 func (o *setKeyOptions) addSetKeyFlags(fs *pflag.FlagSet) {
@@ -82,16 +99,21 @@ func (o *delKeyOptions) addDelKeyFlags(fs *pflag.FlagSet) {
 func NewCmdUnsealKey(clientGetter genericclioptions.RESTClientGetter) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "unseal-key",
-		Short: "get, set, delete, list and sync unseal-key",
+		Short: "get, set, delete, list, inventory, sync, rekey, migrate, export and import unseal-key",
 		Long: `
-$ kubectl vault unseal-key [command] [flags] to get, set, delete, list or sync vault unseal-keys
+$ kubectl vault unseal-key [command] [flags] to get, set, delete, list, inventory, sync, rekey, migrate, export or import vault unseal-keys
 
 Examples:
  $ kubectl vault unseal-key get [flags]
  $ kubectl vault unseal-key set [flags]
  $ kubectl vault unseal-key delete [flags]
  $ kubectl vault unseal-key list [flags]
+ $ kubectl vault unseal-key inventory [flags]
  $ kubectl vault unseal-key sync [flags]
+ $ kubectl vault unseal-key rekey [flags]
+ $ kubectl vault unseal-key migrate [flags]
+ $ kubectl vault unseal-key export [flags]
+ $ kubectl vault unseal-key import [flags]
 `,
 		DisableAutoGenTag: true,
 		Run: func(cmd *cobra.Command, args []string) {
@@ -104,7 +126,12 @@ Examples:
 	cmd.AddCommand(NewCmdSetKey(clientGetter))
 	cmd.AddCommand(NewCmdDeleteKey(clientGetter))
 	cmd.AddCommand(NewCmdListKey(clientGetter))
+	cmd.AddCommand(NewCmdInventory(clientGetter))
 	cmd.AddCommand(NewCmdSyncKeys(clientGetter))
+	cmd.AddCommand(NewCmdRekey(clientGetter))
+	cmd.AddCommand(NewCmdMigrateKeys(clientGetter))
+	cmd.AddCommand(NewCmdExportKeys(clientGetter))
+	cmd.AddCommand(NewCmdImportKeys(clientGetter))
 	return cmd
 }
 
@@ -123,6 +150,10 @@ Examples:
 
  # pass the --key-name flag to get only the decrypted unseal-key value with a specific key name
  $ kubectl vault unseal-key get vaultserver vault -n demo --key-name <name>
+
+ # pass the --pgp-keys flag to encrypt the unseal-key to its custodian instead of printing it
+ # the armored unseal-key is written to {output-dir}/{key-name}.asc, with / in the key name replaced by _
+ $ kubectl vault unseal-key get vaultserver vault -n demo --key-id 0 --pgp-keys=alice.asc --output-dir=shares
 `,
 		DisableAutoGenTag: true,
 		Run: func(cmd *cobra.Command, args []string) {
@@ -131,7 +162,7 @@ Examples:
 				ObjectNames = args[1:]
 			}
 
-			if err := o.get(clientGetter); err != nil {
+			if err := o.get(cmd.Context(), clientGetter); err != nil {
 				Fatal(err)
 			}
 			os.Exit(0)
@@ -168,7 +199,7 @@ Examples:
 				ObjectNames = args[1:]
 			}
 
-			if err := o.set(clientGetter); err != nil {
+			if err := o.set(cmd.Context(), clientGetter); err != nil {
 				Fatal(err)
 			}
 			os.Exit(0)
@@ -201,7 +232,7 @@ Examples:
 				ObjectNames = args[1:]
 			}
 
-			if err := o.del(clientGetter); err != nil {
+			if err := o.del(cmd.Context(), clientGetter); err != nil {
 				Fatal(err)
 			}
 			os.Exit(0)
@@ -223,6 +254,10 @@ $ kubectl vault unseal-key list vaultserver <name> -n <namespace>
 Examples:
  # list the vault unseal-keys
  $ kubectl vault unseal-key list vaultserver vault -n demo
+
+ # encrypt every unseal-key to a different custodian, one key file per unseal-key in the order of the key ids
+ # the armored unseal-keys are written to {output-dir}/{key-name}.asc, with / in the key name replaced by _
+ $ kubectl vault unseal-key list vaultserver vault -n demo --pgp-keys=alice.asc,bob.asc,carol.asc,dave.asc,erin.asc --output-dir=shares
 `,
 		DisableAutoGenTag: true,
 		Run: func(cmd *cobra.Command, args []string) {
@@ -231,13 +266,14 @@ Examples:
 				ObjectNames = args[1:]
 			}
 
-			if err := o.list(clientGetter); err != nil {
+			if err := o.list(cmd.Context(), clientGetter); err != nil {
 				Fatal(err)
 			}
 			os.Exit(0)
 		},
 	}
 
+	o.addPGPFlags(cmd.Flags())
 	return cmd
 }
 
@@ -261,7 +297,7 @@ Examples:
 				ObjectNames = args[1:]
 			}
 
-			if err := syncUnsealKeys(clientGetter); err != nil {
+			if err := syncUnsealKeys(cmd.Context(), clientGetter); err != nil {
 				Fatal(err)
 			}
 			os.Exit(0)
@@ -271,7 +307,7 @@ Examples:
 	return cmd
 }
 
-func syncUnsealKeys(clientGetter genericclioptions.RESTClientGetter) error {
+func syncUnsealKeys(ctx context.Context, clientGetter genericclioptions.RESTClientGetter) error {
 	var resourceName string
 	switch ResourceName {
 	case strings.ToLower(vaultapi.ResourceVaultServer), strings.ToLower(vaultapi.ResourceVaultServers):
@@ -312,11 +348,15 @@ func syncUnsealKeys(clientGetter genericclioptions.RESTClientGetter) error {
 			return err
 		}
 
+		if info.Object, err = vaultserver.ToHub(info.Object); err != nil {
+			return err
+		}
+
 		var err2 error
 		switch info.Object.(type) {
 		case *vaultapi.VaultServer:
 			obj := info.Object.(*vaultapi.VaultServer)
-			err2 = syncKeys(obj, kubeClient)
+			err2 = syncKeys(ctx, obj, kubeClient)
 		default:
 			err2 = errors.New("unknown/unsupported type")
 		}
@@ -325,8 +365,8 @@ func syncUnsealKeys(clientGetter genericclioptions.RESTClientGetter) error {
 	return err
 }
 
-func syncKeys(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
-	ti, err := token_key_store.NewTokenKeyInterface(vs, kubeClient)
+func syncKeys(ctx context.Context, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
+	ti, err := newTokenKeyInterface(vs, kubeClient)
 	if err != nil {
 		return err
 	}
@@ -336,7 +376,7 @@ func syncKeys(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
 	}()
 
 	for i := 0; int64(i) < vs.Spec.Unsealer.SecretShares; i++ {
-		err = syncKey(i, ti)
+		err = syncKey(ctx, i, ti)
 		if err != nil {
 			fmt.Println(err)
 			return err
@@ -347,14 +387,14 @@ func syncKeys(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
 	return nil
 }
 
-func syncKey(id int, ti api.TokenKeyInterface) error {
-	newKey, err := ti.NewUnsealKeyName(id)
+func syncKey(ctx context.Context, id int, ti api.TokenKeyInterface) error {
+	newKey, err := ti.NewUnsealKeyName(ctx, id)
 	if err != nil {
 		return err
 	}
 
 	// if new key already exists just return
-	if _, err = ti.Get(newKey); err == nil {
+	if _, err = ti.Get(ctx, newKey); err == nil {
 		fmt.Printf("%s already up-to-date\n", newKey)
 		return nil
 	}
@@ -366,14 +406,14 @@ func syncKey(id int, ti api.TokenKeyInterface) error {
 		return err
 	}
 
-	value, err := ti.Get(oldKey)
+	value, err := ti.Get(ctx, oldKey)
 	if err != nil {
 		fmt.Println(err)
 		return err
 	}
 
 	// old key exist, set the value to new key
-	if err = ti.Set(newKey, value); err != nil {
+	if err = ti.Set(ctx, newKey, value); err != nil {
 		fmt.Println(err)
 		return err
 	}
@@ -382,7 +422,7 @@ func syncKey(id int, ti api.TokenKeyInterface) error {
 	return nil
 }
 
-func (o *getKeyOptions) list(clientGetter genericclioptions.RESTClientGetter) error {
+func (o *getKeyOptions) list(ctx context.Context, clientGetter genericclioptions.RESTClientGetter) error {
 	var resourceName string
 	switch ResourceName {
 	case strings.ToLower(vaultapi.ResourceVaultServer), strings.ToLower(vaultapi.ResourceVaultServers):
@@ -423,11 +463,15 @@ func (o *getKeyOptions) list(clientGetter genericclioptions.RESTClientGetter) er
 			return err
 		}
 
+		if info.Object, err = vaultserver.ToHub(info.Object); err != nil {
+			return err
+		}
+
 		var err2 error
 		switch info.Object.(type) {
 		case *vaultapi.VaultServer:
 			obj := info.Object.(*vaultapi.VaultServer)
-			o.listUnsealKey(obj, kubeClient)
+			err2 = o.listUnsealKey(ctx, obj, kubeClient)
 		default:
 			err2 = errors.New("unknown/unsupported type")
 		}
@@ -436,18 +480,39 @@ func (o *getKeyOptions) list(clientGetter genericclioptions.RESTClientGetter) er
 	return err
 }
 
-func (o *getKeyOptions) listUnsealKey(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) {
+func (o *getKeyOptions) listUnsealKey(ctx context.Context, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
 	cnt := vs.Spec.Unsealer.SecretShares
+	if len(o.pgpKeys) > 0 && int64(len(o.pgpKeys)) != cnt {
+		return errors.Errorf("found %d pgp keys, one for each of the %d unseal-keys required", len(o.pgpKeys), cnt)
+	}
+
+	// the remaining unseal-keys are still listed if one fails, but the list is reported as failed
+	var failed int
 	for i := 0; int64(i) < cnt; i++ {
 		o.keyId = i
-		err := o.getUnsealKey(vs, kubeClient)
+		if len(o.pgpKeys) > 0 {
+			o.pgpKey = o.pgpKeys[i]
+		}
+		err := o.getUnsealKey(ctx, vs, kubeClient)
 		if err != nil {
-			fmt.Println(err)
+			fmt.Fprintf(os.Stderr, "unseal-key %d: %v\n", i, err)
+			failed++
 		}
 	}
+	if failed > 0 {
+		return errors.Errorf("failed to get %d of %d unseal-keys of vaultserver %s/%s", failed, cnt, vs.Namespace, vs.Name)
+	}
+	return nil
 }
 
-func (o *getKeyOptions) get(clientGetter genericclioptions.RESTClientGetter) error {
+func (o *getKeyOptions) get(ctx context.Context, clientGetter genericclioptions.RESTClientGetter) error {
+	if len(o.pgpKeys) > 1 {
+		return errors.Errorf("found %d pgp keys, exactly one required to get a single unseal-key", len(o.pgpKeys))
+	}
+	if len(o.pgpKeys) == 1 {
+		o.pgpKey = o.pgpKeys[0]
+	}
+
 	var resourceName string
 	switch ResourceName {
 	case strings.ToLower(vaultapi.ResourceVaultServer), strings.ToLower(vaultapi.ResourceVaultServers):
@@ -488,11 +553,15 @@ func (o *getKeyOptions) get(clientGetter genericclioptions.RESTClientGetter) err
 			return err
 		}
 
+		if info.Object, err = vaultserver.ToHub(info.Object); err != nil {
+			return err
+		}
+
 		var err2 error
 		switch info.Object.(type) {
 		case *vaultapi.VaultServer:
 			obj := info.Object.(*vaultapi.VaultServer)
-			err2 = o.getUnsealKey(obj, kubeClient)
+			err2 = o.getUnsealKey(ctx, obj, kubeClient)
 		default:
 			err2 = errors.New("unknown/unsupported type")
 		}
@@ -501,8 +570,8 @@ func (o *getKeyOptions) get(clientGetter genericclioptions.RESTClientGetter) err
 	return err
 }
 
-func (o *getKeyOptions) getUnsealKey(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
-	ti, err := token_key_store.NewTokenKeyInterface(vs, kubeClient)
+func (o *getKeyOptions) getUnsealKey(ctx context.Context, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
+	ti, err := newTokenKeyInterface(vs, kubeClient)
 	if err != nil {
 		return err
 	}
@@ -511,7 +580,7 @@ func (o *getKeyOptions) getUnsealKey(vs *vaultapi.VaultServer, kubeClient kubern
 		ti.Clean()
 	}()
 
-	name, err := ti.NewUnsealKeyName(o.keyId)
+	name, err := ti.NewUnsealKeyName(ctx, o.keyId)
 	if err != nil {
 		return err
 	}
@@ -520,17 +589,76 @@ func (o *getKeyOptions) getUnsealKey(vs *vaultapi.VaultServer, kubeClient kubern
 		name = o.keyName
 	}
 
-	rToken, err := ti.Get(name)
+	rToken, err := ti.Get(ctx, name)
 	if err != nil {
 		return err
 	}
 
+	if len(o.pgpKey) > 0 {
+		return o.writeEncrypted(name, rToken)
+	}
+
 	o.Print(name, rToken)
 
 	return nil
 }
 
-func (o *delKeyOptions) del(clientGetter genericclioptions.RESTClientGetter) error {
+// outputFile returns the file in the output directory for the unseal-key. Key names of some key
+// stores contain path separators, they are replaced, so that the file is always in the directory.
+func (o *getKeyOptions) outputFile(name string) (string, error) {
+	if strings.Contains(name, "..") {
+		return "", errors.Errorf("unseal-key name %s must not contain ..", name)
+	}
+	name = strings.NewReplacer("/", "_", `\`, "_").Replace(strings.TrimLeft(name, `/\`))
+	if len(name) == 0 {
+		return "", errors.New("unseal-key name is empty")
+	}
+	return filepath.Join(o.outputDir, name+".asc"), nil
+}
+
+// writeEncrypted encrypts the unseal-key to the custodian's OpenPGP key and
+// writes it to {output-dir}/{name}.asc, so the key never shows up on the terminal.
+func (o *getKeyOptions) writeEncrypted(name, value string) error {
+	entities, err := encryption.ReadPGPKeys([]string{o.pgpKey})
+	if err != nil {
+		return err
+	}
+	if len(entities) != 1 {
+		return errors.Errorf("pgp key file %s must contain exactly one key, found %d", o.pgpKey, len(entities))
+	}
+
+	data, err := encryption.EncryptPGP([]byte(value), entities)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encrypt unseal-key %s", name)
+	}
+
+	file, err := o.outputFile(name)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(o.outputDir, 0o700); err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(file, data, 0o600); err != nil {
+		return err
+	}
+
+	custodian := entities[0].PrimaryKey.KeyIdString()
+	var ids []string
+	for id := range entities[0].Identities {
+		ids = append(ids, id)
+	}
+	if len(ids) > 0 {
+		sort.Strings(ids)
+		custodian = ids[0]
+	}
+
+	fmt.Printf("unseal-key %s encrypted to %s written to %s\n", name, custodian, file)
+	return nil
+}
+
+func (o *delKeyOptions) del(ctx context.Context, clientGetter genericclioptions.RESTClientGetter) error {
 	var resourceName string
 	switch ResourceName {
 	case strings.ToLower(vaultapi.ResourceVaultServer), strings.ToLower(vaultapi.ResourceVaultServers):
@@ -571,11 +699,15 @@ func (o *delKeyOptions) del(clientGetter genericclioptions.RESTClientGetter) err
 			return err
 		}
 
+		if info.Object, err = vaultserver.ToHub(info.Object); err != nil {
+			return err
+		}
+
 		var err2 error
 		switch info.Object.(type) {
 		case *vaultapi.VaultServer:
 			obj := info.Object.(*vaultapi.VaultServer)
-			err2 = o.deleteUnsealKey(obj, kubeClient)
+			err2 = o.deleteUnsealKey(ctx, obj, kubeClient)
 		default:
 			err2 = errors.New("unknown/unsupported type")
 		}
@@ -584,8 +716,8 @@ func (o *delKeyOptions) del(clientGetter genericclioptions.RESTClientGetter) err
 	return err
 }
 
-func (o *delKeyOptions) deleteUnsealKey(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
-	ti, err := token_key_store.NewTokenKeyInterface(vs, kubeClient)
+func (o *delKeyOptions) deleteUnsealKey(ctx context.Context, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
+	ti, err := newTokenKeyInterface(vs, kubeClient)
 	if err != nil {
 		return err
 	}
@@ -594,7 +726,7 @@ func (o *delKeyOptions) deleteUnsealKey(vs *vaultapi.VaultServer, kubeClient kub
 		ti.Clean()
 	}()
 
-	name, err := ti.NewUnsealKeyName(o.keyId)
+	name, err := ti.NewUnsealKeyName(ctx, o.keyId)
 	if err != nil {
 		return err
 	}
@@ -603,7 +735,7 @@ func (o *delKeyOptions) deleteUnsealKey(vs *vaultapi.VaultServer, kubeClient kub
 		name = o.keyName
 	}
 
-	err = ti.Delete(name)
+	err = ti.Delete(ctx, name)
 	if err != nil {
 		return err
 	}
@@ -613,7 +745,7 @@ func (o *delKeyOptions) deleteUnsealKey(vs *vaultapi.VaultServer, kubeClient kub
 	return nil
 }
 
-func (o *setKeyOptions) set(clientGetter genericclioptions.RESTClientGetter) error {
+func (o *setKeyOptions) set(ctx context.Context, clientGetter genericclioptions.RESTClientGetter) error {
 	var resourceName string
 	switch ResourceName {
 	case strings.ToLower(vaultapi.ResourceVaultServer), strings.ToLower(vaultapi.ResourceVaultServers):
@@ -654,11 +786,15 @@ func (o *setKeyOptions) set(clientGetter genericclioptions.RESTClientGetter) err
 			return err
 		}
 
+		if info.Object, err = vaultserver.ToHub(info.Object); err != nil {
+			return err
+		}
+
 		var err2 error
 		switch info.Object.(type) {
 		case *vaultapi.VaultServer:
 			obj := info.Object.(*vaultapi.VaultServer)
-			err2 = o.setUnsealKey(obj, kubeClient)
+			err2 = o.setUnsealKey(ctx, obj, kubeClient)
 		default:
 			err2 = errors.New("unknown/unsupported type")
 		}
@@ -667,8 +803,8 @@ func (o *setKeyOptions) set(clientGetter genericclioptions.RESTClientGetter) err
 	return err
 }
 
-func (o *setKeyOptions) setUnsealKey(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
-	ti, err := token_key_store.NewTokenKeyInterface(vs, kubeClient)
+func (o *setKeyOptions) setUnsealKey(ctx context.Context, vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error {
+	ti, err := newTokenKeyInterface(vs, kubeClient)
 	if err != nil {
 		return err
 	}
@@ -681,7 +817,7 @@ func (o *setKeyOptions) setUnsealKey(vs *vaultapi.VaultServer, kubeClient kubern
 		return errors.New("unseal key value is empty")
 	}
 
-	name, err := ti.NewUnsealKeyName(o.keyId)
+	name, err := ti.NewUnsealKeyName(ctx, o.keyId)
 	if err != nil {
 		return err
 	}
@@ -690,7 +826,7 @@ func (o *setKeyOptions) setUnsealKey(vs *vaultapi.VaultServer, kubeClient kubern
 		name = o.keyName
 	}
 
-	err = ti.Set(name, o.keyValue)
+	err = ti.Set(ctx, name, o.keyValue)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,138 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kubevault.dev/cli/pkg/encryption"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgparmor "github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func TestOutputFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain name", key: "vault-unseal-key-0", want: "vault-unseal-key-0.asc"},
+		{name: "ssm parameter", key: "/vault/demo/vault-unseal-key-0", want: "vault_demo_vault-unseal-key-0.asc"},
+		{name: "prefixed name", key: "k8s.demo/vault-unseal-key-0", want: "k8s.demo_vault-unseal-key-0.asc"},
+		{name: "parent directory", key: "../vault-unseal-key-0", wantErr: true},
+		{name: "only separators", key: "//", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &getKeyOptions{outputDir: "shares"}
+			got, err := o.outputFile(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("outputFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != filepath.Join("shares", tt.want) {
+				t.Errorf("outputFile() = %s, want %s", got, filepath.Join("shares", tt.want))
+			}
+		})
+	}
+}
+
+// writePGPKey writes the armored public key of a new custodian key to a file.
+func writePGPKey(t *testing.T, name string) (string, *openpgp.Entity) {
+	t.Helper()
+
+	entity, err := openpgp.NewEntity(name, "", name+"@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA, Curve: packet.Curve25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w, err := pgparmor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), name+".asc")
+	if err = os.WriteFile(file, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file, entity
+}
+
+func TestWriteEncrypted(t *testing.T) {
+	aliceKey, alice := writePGPKey(t, "alice")
+	bobKey, bob := writePGPKey(t, "bob")
+	o := &getKeyOptions{outputDir: filepath.Join(t.TempDir(), "shares")}
+
+	shares := []struct {
+		pgpKey string
+		name   string
+		value  string
+	}{
+		{pgpKey: aliceKey, name: "/vault/vault-unseal-key-0", value: "share0"},
+		{pgpKey: bobKey, name: "/vault/vault-unseal-key-1", value: "share1"},
+	}
+	for _, share := range shares {
+		o.pgpKey = share.pgpKey
+		if err := o.writeEncrypted(share.name, share.value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// every share is readable by its custodian only
+	custodians := []*openpgp.Entity{alice, bob}
+	for i, custodian := range custodians {
+		file, err := o.outputFile(shares[i].name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := encryption.DecryptPGP(data, openpgp.EntityList{custodian}, nil)
+		if err != nil {
+			t.Fatalf("share %d can't be decrypted by its custodian: %v", i, err)
+		}
+		if string(got) != shares[i].value {
+			t.Errorf("share %d = %q, want %q", i, got, shares[i].value)
+		}
+		other := custodians[len(custodians)-1-i]
+		if _, err = encryption.DecryptPGP(data, openpgp.EntityList{other}, nil); err == nil {
+			t.Errorf("share %d can be decrypted by another custodian", i)
+		}
+	}
+
+	entries, err := os.ReadDir(o.outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(shares) {
+		t.Errorf("output directory contains %d files, want %d", len(entries), len(shares))
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestGetVaultPodNames(t *testing.T) {
+	tests := []struct {
+		name   string
+		pods   []string
+		sealed []string
+		want   []string
+	}{
+		{
+			name:   "sealed pods exist",
+			pods:   []string{"vault-0", "vault-1", "vault-2"},
+			sealed: []string{"vault-1"},
+			want:   []string{"vault-0", "vault-1", "vault-2"},
+		},
+		{
+			name:   "stale sealed entries are skipped",
+			pods:   []string{"vault-0"},
+			sealed: []string{"vault-0", "vault-1", "vault-2"},
+			want:   []string{"vault-0"},
+		},
+		{
+			name:   "no pods",
+			sealed: []string{"vault-0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				list := core.PodList{}
+				for _, name := range tt.pods {
+					list.Items = append(list.Items, core.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: name}})
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(&list)
+			}))
+			defer srv.Close()
+
+			kubeClient, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			vs := &vaultapi.VaultServer{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "vault"}}
+			vs.Status.VaultStatus.Sealed = tt.sealed
+
+			got, err := getVaultPodNames(vs, kubeClient)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("getVaultPodNames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
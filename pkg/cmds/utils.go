@@ -18,39 +18,142 @@ package cmds
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
 
+	"kubevault.dev/apimachinery/apis"
 	engineapi "kubevault.dev/apimachinery/apis/engine/v1alpha1"
 	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+	opsapi "kubevault.dev/apimachinery/apis/ops/v1alpha1"
 	enginecs "kubevault.dev/apimachinery/client/clientset/versioned/typed/engine/v1alpha1"
 	engineutil "kubevault.dev/apimachinery/client/clientset/versioned/typed/engine/v1alpha1/util"
+	token_key_store "kubevault.dev/cli/pkg/token-keys-store"
+	tokenapi "kubevault.dev/cli/pkg/token-keys-store/api"
+	"kubevault.dev/cli/pkg/vaultserver"
 
 	"github.com/hashicorp/vault/api"
 	"github.com/pkg/errors"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/kubernetes"
 	clientsetscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
 	cmdutil "k8s.io/kubectl/pkg/cmd/util"
 	kmapi "kmodules.xyz/client-go/api/v1"
 	condutil "kmodules.xyz/client-go/conditions"
+	"kmodules.xyz/client-go/tools/portforward"
 )
 
-const (
-	VAULT_ADDR = "127.0.0.1:8200"
-)
+// insecureSkipTLSVerify points to the value of the --insecure-skip-tls-verify flag.
+// If true, the vault server certificate is not verified either.
+var insecureSkipTLSVerify *bool
+
+// keyStoreConfig is read from the --key-store-config flag. If set, it is used
+// instead of the key store of the vaultserver unsealer mode.
+var keyStoreConfig *token_key_store.StoreConfig
 
 func Fatal(err error) {
 	fmt.Fprintln(os.Stderr, err)
 	os.Exit(1)
 }
 
-func modifyStatusCondition(clientGetter genericclioptions.RESTClientGetter, cond kmapi.Condition) error {
+// newTokenKeyInterface returns the key store of the vaultserver, or the one given by --key-store-config.
+func newTokenKeyInterface(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) (tokenapi.TokenKeyInterface, error) {
+	return token_key_store.NewTokenKeyInterfaceForConfig(vs, kubeClient, keyStoreConfig)
+}
+
+// vaultServerSelector selects the VaultServers that are visited if no name is given.
+type vaultServerSelector struct {
+	// selectAll visits every VaultServer of the namespace if no name is given.
+	selectAll     bool
+	allNamespaces bool
+}
+
+// visitVaultServers calls fn for every VaultServer selected by ResourceName and ObjectNames.
+func visitVaultServers(clientGetter genericclioptions.RESTClientGetter, fn func(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) error) error {
+	return visitVaultServerResources(clientGetter, vaultServerSelector{}, func(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface, _ *resource.Helper) error {
+		return fn(vs, kubeClient)
+	})
+}
+
+// visitVaultServerResources calls fn for every selected VaultServer converted to the hub version,
+// together with a helper that patches the VaultServer in the api version served by the cluster.
+func visitVaultServerResources(clientGetter genericclioptions.RESTClientGetter, sel vaultServerSelector, fn func(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface, vsHelper *resource.Helper) error) error {
+	var resourceName string
+	switch ResourceName {
+	case strings.ToLower(vaultapi.ResourceVaultServer), strings.ToLower(vaultapi.ResourceVaultServers):
+		resourceName = vaultapi.ResourceVaultServer
+	default:
+		return errors.New(fmt.Sprintf("unknown/unsupported resource %s", ResourceName))
+	}
+
+	namespace, _, err := clientGetter.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := clientGetter.ToRESTConfig()
+	if err != nil {
+		return errors.Wrap(err, "failed to read kubeconfig")
+	}
+
+	kubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	builder := cmdutil.NewFactory(clientGetter).NewBuilder().
+		WithScheme(clientsetscheme.Scheme, clientsetscheme.Scheme.PrioritizedVersionsAllGroups()...).
+		ContinueOnError().
+		NamespaceParam(namespace).DefaultNamespace().AllNamespaces(sel.allNamespaces).
+		FilenameParam(false, &FilenameOptions)
+	if len(ObjectNames) == 0 && sel.selectAll {
+		builder = builder.ResourceTypes(resourceName).SelectAllParam(true)
+	} else {
+		builder = builder.ResourceNames(resourceName, ObjectNames...)
+	}
+	r := builder.
+		RequireObject(true).
+		Flatten().
+		Latest().
+		Do()
+
+	return r.Visit(func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.Object, err = vaultserver.ToHub(info.Object); err != nil {
+			return err
+		}
+
+		var err2 error
+		switch info.Object.(type) {
+		case *vaultapi.VaultServer:
+			obj := info.Object.(*vaultapi.VaultServer)
+			err2 = fn(obj, kubeClient, resource.NewHelper(info.Client, info.Mapping))
+		default:
+			err2 = errors.New("unknown/unsupported type")
+		}
+		return err2
+	})
+}
+
+func modifyStatusCondition(ctx context.Context, clientGetter genericclioptions.RESTClientGetter, cond kmapi.Condition, o *decisionOptions) error {
 	var resourceName string
 	switch ResourceName {
 	case engineapi.ResourceSecretAccessRequest, engineapi.ResourceSecretAccessRequests:
 		resourceName = engineapi.ResourceSecretAccessRequest
+	case opsapi.ResourceSingularVaultOpsRequest, opsapi.ResourcePluralVaultOpsRequest, opsapi.ResourceCodeVaultOpsRequest:
+		resourceName = opsapi.ResourceSingularVaultOpsRequest
 	case "":
 		resourceName = ""
 	default:
@@ -74,6 +177,16 @@ func modifyStatusCondition(clientGetter genericclioptions.RESTClientGetter, cond
 		return err
 	}
 
+	kubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	d, err := newDecision(ctx, clientGetter, kubeClient, o.reason)
+	if err != nil {
+		return err
+	}
+
 	r := builder.
 		WithScheme(clientsetscheme.Scheme, clientsetscheme.Scheme.PrioritizedVersionsAllGroups()...).
 		ContinueOnError().
@@ -99,8 +212,18 @@ func modifyStatusCondition(clientGetter genericclioptions.RESTClientGetter, cond
 				return err
 			}
 
-			cond.ObservedGeneration = obj.Generation
-			err2 = UpdateSecretAccessRequestCondition(engineClient, obj.ObjectMeta, cond)
+			c := cond
+			c.ObservedGeneration = obj.Generation
+			c.Message = d.message(c.Message)
+			if err2 = UpdateSecretAccessRequestCondition(engineClient, obj.ObjectMeta, c); err2 == nil {
+				d.recordEvent(ctx, kubeClient, info.Mapping.GroupVersionKind, obj.ObjectMeta, c)
+			}
+		case *opsapi.VaultOpsRequest:
+			obj := info.Object.(*opsapi.VaultOpsRequest)
+			var c kmapi.Condition
+			if c, err2 = updateVaultOpsRequestDecision(resource.NewHelper(info.Client, info.Mapping), obj, cond, d); err2 == nil {
+				d.recordEvent(ctx, kubeClient, info.Mapping.GroupVersionKind, obj.ObjectMeta, c)
+			}
 		default:
 			err2 = errors.New("unknown/unsupported type")
 		}
@@ -160,18 +283,191 @@ func isApplicable(engineClient *enginecs.EngineV1alpha1Client, req *engineapi.Se
 	return nil
 }
 
-func NewVaultClient(vs *vaultapi.VaultServer) (*api.Client, error) {
-	cfg := api.DefaultConfig()
+// requestResourceName returns the plural resource name of the requests that are approved, denied or revoked.
+func requestResourceName() string {
+	switch ResourceName {
+	case opsapi.ResourceSingularVaultOpsRequest, opsapi.ResourcePluralVaultOpsRequest, opsapi.ResourceCodeVaultOpsRequest:
+		return opsapi.ResourcePluralVaultOpsRequest
+	}
+	return engineapi.ResourceSecretAccessRequests
+}
+
+// updateVaultOpsRequestDecision sets the approved or denied condition and phase of the VaultOpsRequest
+// and returns the condition. The VaultOpsRequest is read again if its status changed in the meantime.
+func updateVaultOpsRequestDecision(helper *resource.Helper, req *opsapi.VaultOpsRequest, cond kmapi.Condition, d *decision) (kmapi.Condition, error) {
+	var phase opsapi.OpsRequestPhase
+	switch cond.Type {
+	case condutil.ConditionRequestApproved:
+		cond, phase = vaultOpsApprovedCond, opsapi.OpsRequestApproved
+	case condutil.ConditionRequestDenied:
+		cond, phase = vaultOpsDeniedCond, opsapi.OpsRequestDenied
+	default:
+		return cond, errors.Errorf("%s can only be approved or denied", opsapi.ResourcePluralVaultOpsRequest)
+	}
+	cond.Message = d.message(cond.Message)
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := isVaultOpsRequestDecidable(req, phase); err != nil {
+			return err
+		}
+
+		status := req.Status.DeepCopy()
+		cond.ObservedGeneration = req.Generation
+		status.Conditions = condutil.SetCondition(status.Conditions, cond)
+		status.Phase = phase
+		status.ObservedGeneration = req.Generation
+
+		// the resource version makes the patch fail with a conflict if the status changed
+		patch, err := json.Marshal(map[string]any{
+			"metadata": map[string]any{
+				"resourceVersion": req.ResourceVersion,
+			},
+			"status": status,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = helper.WithSubresource("status").Patch(req.Namespace, req.Name, types.MergePatchType, patch, nil)
+		if kerr.IsConflict(err) {
+			obj, err2 := helper.Get(req.Namespace, req.Name)
+			if err2 != nil {
+				return err2
+			}
+			var ok bool
+			if req, ok = obj.(*opsapi.VaultOpsRequest); !ok {
+				return errors.Errorf("unexpected type %T", obj)
+			}
+		}
+		return err
+	})
+	return cond, err
+}
+
+// isVaultOpsRequestDecidable returns an error unless the VaultOpsRequest is waiting for approval.
+// A request without a phase or with phase Pending is not yet processed by the operator and is
+// waiting for approval as well.
+func isVaultOpsRequestDecidable(req *opsapi.VaultOpsRequest, phase opsapi.OpsRequestPhase) error {
+	action := "approve"
+	if phase == opsapi.OpsRequestDenied {
+		action = "deny"
+	}
+
+	conditions := req.Status.Conditions
+	switch {
+	case req.Status.Phase == opsapi.OpsRequestApproved || condutil.IsConditionTrue(conditions, opsapi.AccessApproved):
+		if phase == opsapi.OpsRequestApproved {
+			return errors.Errorf("request %s/%s already approved", req.Namespace, req.Name)
+		}
+		return errors.Errorf("failed to %s, request %s/%s already approved", action, req.Namespace, req.Name)
+	case req.Status.Phase == opsapi.OpsRequestDenied || condutil.IsConditionTrue(conditions, opsapi.AccessDenied):
+		if phase == opsapi.OpsRequestDenied {
+			return errors.Errorf("request %s/%s already denied", req.Namespace, req.Name)
+		}
+		return errors.Errorf("failed to %s, request %s/%s already denied", action, req.Namespace, req.Name)
+	}
+
+	switch req.Status.Phase {
+	case "", opsapi.OpsRequestPhasePending, opsapi.OpsRequestPhaseWaitingForApproval:
+		return nil
+	}
+	return errors.Errorf("failed to %s, request %s/%s is %s, only a request waiting for approval can be decided", action, req.Namespace, req.Name, req.Status.Phase)
+}
+
+// NewVaultClient opens a port-forward to the active pod of the VaultServer and returns
+// a vault client for the forwarded local port. The caller must close the returned tunnel.
+func NewVaultClient(cfg *rest.Config, kubeClient kubernetes.Interface, vs *vaultapi.VaultServer) (*api.Client, *portforward.Tunnel, error) {
+	if len(vs.Status.VaultStatus.Active) == 0 {
+		return nil, nil, errors.Errorf("no active pod found for vaultserver %s/%s", vs.Namespace, vs.Name)
+	}
+
+	return NewVaultClientForPod(cfg, kubeClient, vs, vs.Status.VaultStatus.Active)
+}
+
+// NewVaultClientForPod opens a port-forward to the given pod of the VaultServer and returns
+// a vault client for the forwarded local port. The caller must close the returned tunnel.
+func NewVaultClientForPod(cfg *rest.Config, kubeClient kubernetes.Interface, vs *vaultapi.VaultServer, podName string) (*api.Client, *portforward.Tunnel, error) {
+	tunnel := portforward.NewTunnel(portforward.TunnelOptions{
+		Client:    kubeClient.CoreV1().RESTClient(),
+		Config:    cfg,
+		Resource:  "pods",
+		Name:      podName,
+		Namespace: vs.Namespace,
+		Remote:    apis.VaultAPIPort,
+	})
+	if err := tunnel.ForwardPort(); err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to port-forward to pod %s/%s", vs.Namespace, podName)
+	}
+
+	vaultCfg := api.DefaultConfig()
+	vaultCfg.Address = fmt.Sprintf("%s://127.0.0.1:%d", vs.Scheme(), tunnel.Local)
+
+	if vs.Spec.TLS != nil {
+		tlsConfig, err := newVaultTLSConfig(kubeClient, vs)
+		if err != nil {
+			tunnel.Close()
+			return nil, nil, err
+		}
+
+		if err = vaultCfg.ConfigureTLS(tlsConfig); err != nil {
+			tunnel.Close()
+			return nil, nil, err
+		}
+
+		if !tlsConfig.Insecure {
+			transport := vaultCfg.HttpClient.Transport.(*http.Transport)
+			transport.TLSClientConfig.VerifyConnection = verifyCommonName(vs.GetCertificateCN(vaultapi.VaultServerCert))
+		}
+	}
+
+	client, err := api.NewClient(vaultCfg)
+	if err != nil {
+		tunnel.Close()
+		return nil, nil, err
+	}
+
+	return client, tunnel, nil
+}
 
-	tlsConfig := &api.TLSConfig{
-		Insecure: true,
+// newVaultTLSConfig loads the CA of the VaultServer from its server certificate secret,
+// falling back to the legacy tls secret.
+func newVaultTLSConfig(kubeClient kubernetes.Interface, vs *vaultapi.VaultServer) (*api.TLSConfig, error) {
+	if insecureSkipTLSVerify != nil && *insecureSkipTLSVerify {
+		return &api.TLSConfig{
+			Insecure: true,
+		}, nil
 	}
 
-	cfg.Address = fmt.Sprintf("%s://%s", vs.Scheme(), VAULT_ADDR)
-	err := cfg.ConfigureTLS(tlsConfig)
+	secretName := vs.GetCertSecretName(string(vaultapi.VaultServerCert))
+	secret, err := kubeClient.CoreV1().Secrets(vs.Namespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+	if kerr.IsNotFound(err) {
+		secretName = vs.TLSSecretName()
+		secret, err = kubeClient.CoreV1().Secrets(vs.Namespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+	}
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrapf(err, "failed to get tls secret of vaultserver %s/%s", vs.Namespace, vs.Name)
 	}
 
-	return api.NewClient(cfg)
+	caCert, ok := secret.Data[apis.TLSCACertKey]
+	if !ok || len(caCert) == 0 {
+		return nil, errors.Errorf("%s not found in secret %s/%s, use --insecure-skip-tls-verify to skip verification", apis.TLSCACertKey, vs.Namespace, secretName)
+	}
+
+	return &api.TLSConfig{
+		CACertBytes:   caCert,
+		TLSServerName: fmt.Sprintf("%s.%s.svc", vs.ServiceName(vaultapi.VaultServerServiceVault), vs.Namespace),
+	}, nil
+}
+
+// verifyCommonName ensures that the vault server presents the certificate issued for it.
+func verifyCommonName(cn string) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("vault server did not present any certificate")
+		}
+		if cs.PeerCertificates[0].Subject.CommonName != cn {
+			return errors.Errorf("vault server certificate common name %q does not match expected %q", cs.PeerCertificates[0].Subject.CommonName, cn)
+		}
+		return nil
+	}
 }
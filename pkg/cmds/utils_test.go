@@ -0,0 +1,202 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"strings"
+	"testing"
+
+	"kubevault.dev/apimachinery/apis"
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+	opsapi "kubevault.dev/apimachinery/apis/ops/v1alpha1"
+	"kubevault.dev/cli/pkg/token-keys-store/fake"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+func TestIsVaultOpsRequestDecidable(t *testing.T) {
+	approved := kmapi.Condition{Type: opsapi.AccessApproved, Status: metav1.ConditionTrue}
+	denied := kmapi.Condition{Type: opsapi.AccessDenied, Status: metav1.ConditionTrue}
+
+	tests := []struct {
+		name    string
+		req     *opsapi.VaultOpsRequest
+		phase   opsapi.OpsRequestPhase
+		wantErr string
+	}{
+		{name: "no phase", req: opsRequest(""), phase: opsapi.OpsRequestApproved},
+		{name: "pending", req: opsRequest(opsapi.OpsRequestPhasePending), phase: opsapi.OpsRequestDenied},
+		{name: "waiting for approval", req: opsRequest(opsapi.OpsRequestPhaseWaitingForApproval), phase: opsapi.OpsRequestApproved},
+		{
+			name:    "approve approved",
+			req:     opsRequest(opsapi.OpsRequestApproved),
+			phase:   opsapi.OpsRequestApproved,
+			wantErr: "request demo/restart already approved",
+		},
+		{
+			name:    "deny approved condition",
+			req:     opsRequest(opsapi.OpsRequestPhaseProgressing, approved),
+			phase:   opsapi.OpsRequestDenied,
+			wantErr: "failed to deny, request demo/restart already approved",
+		},
+		{
+			name:    "deny denied",
+			req:     opsRequest(opsapi.OpsRequestDenied),
+			phase:   opsapi.OpsRequestDenied,
+			wantErr: "request demo/restart already denied",
+		},
+		{
+			name:    "approve denied condition",
+			req:     opsRequest(opsapi.OpsRequestPhaseWaitingForApproval, denied),
+			phase:   opsapi.OpsRequestApproved,
+			wantErr: "failed to approve, request demo/restart already denied",
+		},
+		{
+			name:    "progressing",
+			req:     opsRequest(opsapi.OpsRequestPhaseProgressing),
+			phase:   opsapi.OpsRequestApproved,
+			wantErr: "failed to approve, request demo/restart is Progressing",
+		},
+		{
+			name:    "successful",
+			req:     opsRequest(opsapi.OpsRequestPhaseSuccessful),
+			phase:   opsapi.OpsRequestDenied,
+			wantErr: "failed to deny, request demo/restart is Successful",
+		},
+		{
+			name:    "failed",
+			req:     opsRequest(opsapi.OpsRequestPhaseFailed),
+			phase:   opsapi.OpsRequestApproved,
+			wantErr: "failed to approve, request demo/restart is Failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := isVaultOpsRequestDecidable(tt.req, tt.phase)
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("isVaultOpsRequestDecidable() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Fatalf("isVaultOpsRequestDecidable() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewVaultTLSConfig(t *testing.T) {
+	vs := &vaultapi.VaultServer{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "vault"},
+		Spec:       vaultapi.VaultServerSpec{TLS: &kmapi.TLSConfig{}},
+	}
+	secret := func(name, ca string) *core.Secret {
+		return &core.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: vs.Namespace, Name: name},
+			Data:       map[string][]byte{apis.TLSCACertKey: []byte(ca)},
+		}
+	}
+	certSecret := vs.GetCertSecretName(string(vaultapi.VaultServerCert))
+
+	tests := []struct {
+		name     string
+		secrets  []*core.Secret
+		insecure bool
+		wantCA   string
+		wantErr  bool
+	}{
+		{
+			name:    "server certificate secret",
+			secrets: []*core.Secret{secret(certSecret, "server-ca"), secret(vs.TLSSecretName(), "legacy-ca")},
+			wantCA:  "server-ca",
+		},
+		{
+			name:    "legacy tls secret",
+			secrets: []*core.Secret{secret(vs.TLSSecretName(), "legacy-ca")},
+			wantCA:  "legacy-ca",
+		},
+		{
+			name:    "no ca in the secret",
+			secrets: []*core.Secret{secret(certSecret, "")},
+			wantErr: true,
+		},
+		{
+			name:    "no secret",
+			wantErr: true,
+		},
+		{
+			name:     "insecure",
+			insecure: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			insecure := tt.insecure
+			insecureSkipTLSVerify = &insecure
+			defer func() {
+				insecureSkipTLSVerify = nil
+			}()
+
+			tlsConfig, err := newVaultTLSConfig(fake.SecretClient(t, tt.secrets...), vs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newVaultTLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tlsConfig.Insecure != tt.insecure {
+				t.Errorf("newVaultTLSConfig() insecure = %v, want %v", tlsConfig.Insecure, tt.insecure)
+			}
+			if string(tlsConfig.CACertBytes) != tt.wantCA {
+				t.Errorf("newVaultTLSConfig() ca = %q, want %q", tlsConfig.CACertBytes, tt.wantCA)
+			}
+			if !tt.insecure && tlsConfig.TLSServerName != "vault.demo.svc" {
+				t.Errorf("newVaultTLSConfig() server name = %q, want %q", tlsConfig.TLSServerName, "vault.demo.svc")
+			}
+		})
+	}
+}
+
+func TestVerifyCommonName(t *testing.T) {
+	cert := func(cn string) *x509.Certificate {
+		return &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+	}
+	tests := []struct {
+		name    string
+		certs   []*x509.Certificate
+		wantErr bool
+	}{
+		{name: "matching common name", certs: []*x509.Certificate{cert("vault-server"), cert("ca")}},
+		{name: "other common name", certs: []*x509.Certificate{cert("other-server")}, wantErr: true},
+		{name: "common name of the ca", certs: []*x509.Certificate{cert("ca"), cert("vault-server")}, wantErr: true},
+		{name: "no certificate", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyCommonName("vault-server")(tls.ConnectionState{PeerCertificates: tt.certs})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyCommonName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package encryption
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	agearmor "filippo.io/age/armor"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgparmor "github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/pkg/errors"
+)
+
+const (
+	pgpMessageType   = "PGP MESSAGE"
+	pgpMessageHeader = "-----BEGIN " + pgpMessageType + "-----"
+)
+
+// PassphraseFunc returns the passphrase of an encrypted private key.
+type PassphraseFunc func(keyID string) ([]byte, error)
+
+// ParseAgeRecipients parses age public keys of the form age1...
+func ParseAgeRecipients(keys []string) ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	for _, key := range keys {
+		r, err := age.ParseX25519Recipient(strings.TrimSpace(key))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse age recipient %s", key)
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, nil
+}
+
+// ReadAgeIdentities reads the age identities from an identity file, as generated by age-keygen.
+func ReadAgeIdentities(file string) ([]age.Identity, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	identities, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse age identity file %s", file)
+	}
+	return identities, nil
+}
+
+// ReadPGPKeys reads an armored or binary OpenPGP key ring from every file.
+func ReadPGPKeys(files []string) (openpgp.EntityList, error) {
+	var entities openpgp.EntityList
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		el, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+		if err != nil {
+			el, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse pgp key file %s", file)
+		}
+		entities = append(entities, el...)
+	}
+	return entities, nil
+}
+
+// EncryptAge encrypts the data to every age recipient and returns the armored ciphertext.
+func EncryptAge(data []byte, recipients ...age.Recipient) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no age recipient provided")
+	}
+
+	var buf bytes.Buffer
+	aw := agearmor.NewWriter(&buf)
+	w, err := age.Encrypt(aw, recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	if err = aw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// EncryptPGP encrypts the data to every OpenPGP entity and returns the armored ciphertext.
+func EncryptPGP(data []byte, entities openpgp.EntityList) ([]byte, error) {
+	if len(entities) == 0 {
+		return nil, errors.New("no pgp key provided")
+	}
+
+	var buf bytes.Buffer
+	aw, err := pgparmor.Encode(&buf, pgpMessageType, nil)
+	if err != nil {
+		return nil, err
+	}
+	w, err := openpgp.Encrypt(aw, entities, nil, &openpgp.FileHints{IsBinary: true}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	if err = aw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecryptAge decrypts armored or binary age ciphertext with any of the identities.
+func DecryptAge(data []byte, identities ...age.Identity) ([]byte, error) {
+	var src io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(agearmor.Header)) {
+		src = agearmor.NewReader(bytes.NewReader(bytes.TrimSpace(data)))
+	}
+
+	r, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// DecryptPGP decrypts armored OpenPGP ciphertext with the private keys of the key ring.
+// Encrypted private keys are unlocked with the passphrase returned by fn.
+func DecryptPGP(data []byte, keyring openpgp.EntityList, fn PassphraseFunc) ([]byte, error) {
+	block, err := pgparmor.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != pgpMessageType {
+		return nil, errors.Errorf("unexpected pgp armor type %s", block.Type)
+	}
+
+	tried := false
+	prompt := func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		if tried || fn == nil || symmetric {
+			return nil, errors.New("unable to decrypt the pgp private key")
+		}
+		tried = true
+
+		for _, key := range keys {
+			passphrase, err := fn(key.PrivateKey.KeyIdString())
+			if err != nil {
+				return nil, err
+			}
+			if err = key.PrivateKey.Decrypt(passphrase); err == nil {
+				return nil, nil
+			}
+		}
+		return nil, errors.New("invalid pgp passphrase")
+	}
+
+	md, err := openpgp.ReadMessage(block.Body, keyring, prompt, nil)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(md.UnverifiedBody)
+}
+
+// IsAgeEncrypted reports whether the data is armored age ciphertext.
+func IsAgeEncrypted(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte(agearmor.Header))
+}
+
+// IsPGPEncrypted reports whether the data is armored OpenPGP ciphertext.
+func IsPGPEncrypted(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte(pgpMessageHeader))
+}
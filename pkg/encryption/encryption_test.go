@@ -0,0 +1,220 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package encryption
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgparmor "github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func TestAgeRoundTrip(t *testing.T) {
+	id1, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id2, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recipients, err := ParseAgeRecipients([]string{id1.Recipient().String(), " " + id2.Recipient().String() + "\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("unseal-key")
+	ciphertext, err := EncryptAge(data, recipients...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsAgeEncrypted(ciphertext) {
+		t.Fatal("age ciphertext is not armored")
+	}
+
+	tests := []struct {
+		name     string
+		identity age.Identity
+		wantErr  bool
+	}{
+		{name: "first recipient", identity: id1},
+		{name: "second recipient", identity: id2},
+		{name: "no recipient", identity: other, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecryptAge(ciphertext, tt.identity)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecryptAge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(got, data) {
+				t.Errorf("DecryptAge() = %q, want %q", got, data)
+			}
+		})
+	}
+}
+
+func TestAgeErrors(t *testing.T) {
+	if _, err := ParseAgeRecipients([]string{"age1invalid"}); err == nil {
+		t.Error("ParseAgeRecipients() accepted an invalid recipient")
+	}
+	if _, err := EncryptAge([]byte("unseal-key")); err == nil {
+		t.Error("EncryptAge() accepted no recipient")
+	}
+}
+
+func TestReadAgeIdentities(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "key.txt")
+	if err = os.WriteFile(file, []byte("# created by age-keygen\n"+id.String()+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	identities, err := ReadAgeIdentities(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := EncryptAge([]byte("unseal-key"), id.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = DecryptAge(ciphertext, identities...); err != nil {
+		t.Errorf("DecryptAge() with the identity file error = %v", err)
+	}
+}
+
+func TestPGPRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *packet.Config
+		passphrase []byte
+	}{
+		{
+			name:   "rsa",
+			config: &packet.Config{Algorithm: packet.PubKeyAlgoRSA, RSABits: 2048},
+		},
+		{
+			name:   "curve25519",
+			config: &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA, Curve: packet.Curve25519},
+		},
+		{
+			name:       "curve25519 with passphrase",
+			config:     &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA, Curve: packet.Curve25519},
+			passphrase: []byte("secret"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entity, err := openpgp.NewEntity("custodian", "", "custodian@example.com", tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the ciphertext is encrypted to the public key read from an armored key file
+			file := filepath.Join(t.TempDir(), "key.asc")
+			var buf bytes.Buffer
+			w, err := pgparmor.Encode(&buf, openpgp.PublicKeyType, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = entity.Serialize(w); err != nil {
+				t.Fatal(err)
+			}
+			if err = w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err = os.WriteFile(file, buf.Bytes(), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			public, err := ReadPGPKeys([]string{file})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data := []byte("unseal-key")
+			ciphertext, err := EncryptPGP(data, public)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !IsPGPEncrypted(ciphertext) {
+				t.Fatal("pgp ciphertext is not armored")
+			}
+
+			var fn PassphraseFunc
+			if len(tt.passphrase) > 0 {
+				if err = entity.EncryptPrivateKeys(tt.passphrase, nil); err != nil {
+					t.Fatal(err)
+				}
+				fn = func(string) ([]byte, error) {
+					return tt.passphrase, nil
+				}
+
+				wrong := func(string) ([]byte, error) {
+					return []byte("wrong"), nil
+				}
+				if _, err = DecryptPGP(ciphertext, openpgp.EntityList{entity}, wrong); err == nil {
+					t.Error("DecryptPGP() accepted a wrong passphrase")
+				}
+			}
+
+			got, err := DecryptPGP(ciphertext, openpgp.EntityList{entity}, fn)
+			if err != nil {
+				t.Fatalf("DecryptPGP() error = %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("DecryptPGP() = %q, want %q", got, data)
+			}
+		})
+	}
+}
+
+func TestIsEncrypted(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantAge bool
+		wantPGP bool
+	}{
+		{name: "age", data: "\n-----BEGIN AGE ENCRYPTED FILE-----\n", wantAge: true},
+		{name: "pgp", data: "-----BEGIN PGP MESSAGE-----\n", wantPGP: true},
+		{name: "pgp public key", data: "-----BEGIN PGP PUBLIC KEY BLOCK-----\n"},
+		{name: "plain", data: "unseal-key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsAgeEncrypted([]byte(tt.data)); got != tt.wantAge {
+				t.Errorf("IsAgeEncrypted() = %v, want %v", got, tt.wantAge)
+			}
+			if got := IsPGPEncrypted([]byte(tt.data)); got != tt.wantPGP {
+				t.Errorf("IsPGPEncrypted() = %v, want %v", got, tt.wantPGP)
+			}
+		})
+	}
+}
@@ -16,8 +16,10 @@ limitations under the License.
 
 package api
 
+import "context"
+
 type GeneratorInterface interface {
-	Generate() (string, error)
-	GetVaultServerURL() (string, error)
-	GetVaultRoleName() (string, error)
+	Generate(ctx context.Context) (string, error)
+	GetVaultServerURL(ctx context.Context) (string, error)
+	GetVaultRoleName(ctx context.Context) (string, error)
 }
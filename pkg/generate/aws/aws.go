@@ -27,6 +27,7 @@ import (
 	vaultcs "kubevault.dev/apimachinery/client/clientset/versioned/typed/kubevault/v1alpha2"
 	policycs "kubevault.dev/apimachinery/client/clientset/versioned/typed/policy/v1alpha1"
 	"kubevault.dev/cli/pkg/generate/api"
+	"kubevault.dev/cli/pkg/vaultserver"
 
 	"github.com/go-errors/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -61,18 +62,18 @@ type AWSGenerator struct {
 
 var _ api.GeneratorInterface = &AWSGenerator{}
 
-func NewAWSGenerator(role []string, srb *engineapi.SecretRoleBinding, keys map[string]string, engineClient *enginecs.EngineV1alpha1Client, vaultClient *vaultcs.KubevaultV1alpha2Client, policyClient *policycs.PolicyV1alpha1Client, kubeClient *kubernetes.Clientset) (*AWSGenerator, error) {
-	awsRole, err := engineClient.AWSRoles(srb.Namespace).Get(context.TODO(), role[1], metav1.GetOptions{})
+func NewAWSGenerator(ctx context.Context, role []string, srb *engineapi.SecretRoleBinding, keys map[string]string, engineClient *enginecs.EngineV1alpha1Client, vaultClient *vaultcs.KubevaultV1alpha2Client, policyClient *policycs.PolicyV1alpha1Client, kubeClient *kubernetes.Clientset) (*AWSGenerator, error) {
+	awsRole, err := engineClient.AWSRoles(srb.Namespace).Get(ctx, role[1], metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	se, err := engineClient.SecretEngines(srb.Namespace).Get(context.TODO(), awsRole.Spec.SecretEngineRef.Name, metav1.GetOptions{})
+	se, err := engineClient.SecretEngines(srb.Namespace).Get(ctx, awsRole.Spec.SecretEngineRef.Name, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	sts, err := kubeClient.AppsV1().StatefulSets(se.Spec.VaultRef.Namespace).Get(context.TODO(), se.Spec.VaultRef.Name, metav1.GetOptions{})
+	sts, err := kubeClient.AppsV1().StatefulSets(se.Spec.VaultRef.Namespace).Get(ctx, se.Spec.VaultRef.Name, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -101,8 +102,8 @@ func NewAWSGenerator(role []string, srb *engineapi.SecretRoleBinding, keys map[s
 	}, nil
 }
 
-func (g *AWSGenerator) Generate() (string, error) {
-	awsRole, err := g.engineClient.AWSRoles(g.srb.Namespace).Get(context.TODO(), g.role[1], metav1.GetOptions{})
+func (g *AWSGenerator) Generate(ctx context.Context) (string, error) {
+	awsRole, err := g.engineClient.AWSRoles(g.srb.Namespace).Get(ctx, g.role[1], metav1.GetOptions{})
 	if err != nil {
 		return "", err
 	}
@@ -131,8 +132,8 @@ func (g *AWSGenerator) Generate() (string, error) {
 	return string(data), nil
 }
 
-func (g *AWSGenerator) GetVaultServerURL() (string, error) {
-	vs, err := g.vaultClient.VaultServers(g.se.Spec.VaultRef.Namespace).Get(context.TODO(), g.se.Spec.VaultRef.Name, metav1.GetOptions{})
+func (g *AWSGenerator) GetVaultServerURL(ctx context.Context) (string, error) {
+	vs, err := vaultserver.Get(ctx, g.vaultClient, g.se.Spec.VaultRef.Namespace, g.se.Spec.VaultRef.Name)
 	if err != nil {
 		return "", err
 	}
@@ -141,8 +142,8 @@ func (g *AWSGenerator) GetVaultServerURL() (string, error) {
 	return address, nil
 }
 
-func (g *AWSGenerator) GetVaultRoleName() (string, error) {
-	vpb, err := g.policyClient.VaultPolicyBindings(g.se.Spec.VaultRef.Namespace).Get(context.TODO(), g.srb.VaultPolicyBindingName(), metav1.GetOptions{})
+func (g *AWSGenerator) GetVaultRoleName(ctx context.Context) (string, error) {
+	vpb, err := g.policyClient.VaultPolicyBindings(g.se.Spec.VaultRef.Namespace).Get(ctx, g.srb.VaultPolicyBindingName(), metav1.GetOptions{})
 	if err != nil {
 		return "", err
 	}
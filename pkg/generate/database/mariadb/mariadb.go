@@ -27,6 +27,7 @@ import (
 	vaultcs "kubevault.dev/apimachinery/client/clientset/versioned/typed/kubevault/v1alpha2"
 	policycs "kubevault.dev/apimachinery/client/clientset/versioned/typed/policy/v1alpha1"
 	"kubevault.dev/cli/pkg/generate/api"
+	"kubevault.dev/cli/pkg/vaultserver"
 
 	"github.com/go-errors/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -60,18 +61,18 @@ type MariaDBGenerator struct {
 
 var _ api.GeneratorInterface = &MariaDBGenerator{}
 
-func NewMariaDBGenerator(role []string, srb *engineapi.SecretRoleBinding, keys map[string]string, engineClient *enginecs.EngineV1alpha1Client, vaultClient *vaultcs.KubevaultV1alpha2Client, policyClient *policycs.PolicyV1alpha1Client, kubeClient *kubernetes.Clientset) (*MariaDBGenerator, error) {
-	mariaRole, err := engineClient.MariaDBRoles(srb.Namespace).Get(context.TODO(), role[1], metav1.GetOptions{})
+func NewMariaDBGenerator(ctx context.Context, role []string, srb *engineapi.SecretRoleBinding, keys map[string]string, engineClient *enginecs.EngineV1alpha1Client, vaultClient *vaultcs.KubevaultV1alpha2Client, policyClient *policycs.PolicyV1alpha1Client, kubeClient *kubernetes.Clientset) (*MariaDBGenerator, error) {
+	mariaRole, err := engineClient.MariaDBRoles(srb.Namespace).Get(ctx, role[1], metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	se, err := engineClient.SecretEngines(srb.Namespace).Get(context.TODO(), mariaRole.Spec.SecretEngineRef.Name, metav1.GetOptions{})
+	se, err := engineClient.SecretEngines(srb.Namespace).Get(ctx, mariaRole.Spec.SecretEngineRef.Name, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	sts, err := kubeClient.AppsV1().StatefulSets(se.Spec.VaultRef.Namespace).Get(context.TODO(), se.Spec.VaultRef.Name, metav1.GetOptions{})
+	sts, err := kubeClient.AppsV1().StatefulSets(se.Spec.VaultRef.Namespace).Get(ctx, se.Spec.VaultRef.Name, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -100,8 +101,8 @@ func NewMariaDBGenerator(role []string, srb *engineapi.SecretRoleBinding, keys m
 	}, nil
 }
 
-func (g *MariaDBGenerator) Generate() (string, error) {
-	mariaRole, err := g.engineClient.MariaDBRoles(g.srb.Namespace).Get(context.TODO(), g.role[1], metav1.GetOptions{})
+func (g *MariaDBGenerator) Generate(ctx context.Context) (string, error) {
+	mariaRole, err := g.engineClient.MariaDBRoles(g.srb.Namespace).Get(ctx, g.role[1], metav1.GetOptions{})
 	if err != nil {
 		return "", err
 	}
@@ -130,8 +131,8 @@ func (g *MariaDBGenerator) Generate() (string, error) {
 	return string(data), nil
 }
 
-func (g *MariaDBGenerator) GetVaultServerURL() (string, error) {
-	vs, err := g.vaultClient.VaultServers(g.se.Spec.VaultRef.Namespace).Get(context.TODO(), g.se.Spec.VaultRef.Name, metav1.GetOptions{})
+func (g *MariaDBGenerator) GetVaultServerURL(ctx context.Context) (string, error) {
+	vs, err := vaultserver.Get(ctx, g.vaultClient, g.se.Spec.VaultRef.Namespace, g.se.Spec.VaultRef.Name)
 	if err != nil {
 		return "", err
 	}
@@ -140,8 +141,8 @@ func (g *MariaDBGenerator) GetVaultServerURL() (string, error) {
 	return address, nil
 }
 
-func (g *MariaDBGenerator) GetVaultRoleName() (string, error) {
-	vpb, err := g.policyClient.VaultPolicyBindings(g.se.Spec.VaultRef.Namespace).Get(context.TODO(), g.srb.VaultPolicyBindingName(), metav1.GetOptions{})
+func (g *MariaDBGenerator) GetVaultRoleName(ctx context.Context) (string, error) {
+	vpb, err := g.policyClient.VaultPolicyBindings(g.se.Spec.VaultRef.Namespace).Get(ctx, g.srb.VaultPolicyBindingName(), metav1.GetOptions{})
 	if err != nil {
 		return "", err
 	}
@@ -27,6 +27,7 @@ import (
 	vaultcs "kubevault.dev/apimachinery/client/clientset/versioned/typed/kubevault/v1alpha2"
 	policycs "kubevault.dev/apimachinery/client/clientset/versioned/typed/policy/v1alpha1"
 	"kubevault.dev/cli/pkg/generate/api"
+	"kubevault.dev/cli/pkg/vaultserver"
 
 	"github.com/go-errors/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -60,18 +61,18 @@ type MongoGenerator struct {
 
 var _ api.GeneratorInterface = &MongoGenerator{}
 
-func NewMongoGenerator(role []string, srb *engineapi.SecretRoleBinding, keys map[string]string, engineClient *enginecs.EngineV1alpha1Client, vaultClient *vaultcs.KubevaultV1alpha2Client, policyClient *policycs.PolicyV1alpha1Client, kubeClient *kubernetes.Clientset) (*MongoGenerator, error) {
-	mongoRole, err := engineClient.MongoDBRoles(srb.Namespace).Get(context.TODO(), role[1], metav1.GetOptions{})
+func NewMongoGenerator(ctx context.Context, role []string, srb *engineapi.SecretRoleBinding, keys map[string]string, engineClient *enginecs.EngineV1alpha1Client, vaultClient *vaultcs.KubevaultV1alpha2Client, policyClient *policycs.PolicyV1alpha1Client, kubeClient *kubernetes.Clientset) (*MongoGenerator, error) {
+	mongoRole, err := engineClient.MongoDBRoles(srb.Namespace).Get(ctx, role[1], metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	se, err := engineClient.SecretEngines(srb.Namespace).Get(context.TODO(), mongoRole.Spec.SecretEngineRef.Name, metav1.GetOptions{})
+	se, err := engineClient.SecretEngines(srb.Namespace).Get(ctx, mongoRole.Spec.SecretEngineRef.Name, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	sts, err := kubeClient.AppsV1().StatefulSets(se.Spec.VaultRef.Namespace).Get(context.TODO(), se.Spec.VaultRef.Name, metav1.GetOptions{})
+	sts, err := kubeClient.AppsV1().StatefulSets(se.Spec.VaultRef.Namespace).Get(ctx, se.Spec.VaultRef.Name, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -100,8 +101,8 @@ func NewMongoGenerator(role []string, srb *engineapi.SecretRoleBinding, keys map
 	}, nil
 }
 
-func (g *MongoGenerator) Generate() (string, error) {
-	mongoRole, err := g.engineClient.MongoDBRoles(g.srb.Namespace).Get(context.TODO(), g.role[1], metav1.GetOptions{})
+func (g *MongoGenerator) Generate(ctx context.Context) (string, error) {
+	mongoRole, err := g.engineClient.MongoDBRoles(g.srb.Namespace).Get(ctx, g.role[1], metav1.GetOptions{})
 	if err != nil {
 		return "", err
 	}
@@ -130,8 +131,8 @@ func (g *MongoGenerator) Generate() (string, error) {
 	return string(data), nil
 }
 
-func (g *MongoGenerator) GetVaultServerURL() (string, error) {
-	vs, err := g.vaultClient.VaultServers(g.se.Spec.VaultRef.Namespace).Get(context.TODO(), g.se.Spec.VaultRef.Name, metav1.GetOptions{})
+func (g *MongoGenerator) GetVaultServerURL(ctx context.Context) (string, error) {
+	vs, err := vaultserver.Get(ctx, g.vaultClient, g.se.Spec.VaultRef.Namespace, g.se.Spec.VaultRef.Name)
 	if err != nil {
 		return "", err
 	}
@@ -140,8 +141,8 @@ func (g *MongoGenerator) GetVaultServerURL() (string, error) {
 	return address, nil
 }
 
-func (g *MongoGenerator) GetVaultRoleName() (string, error) {
-	vpb, err := g.policyClient.VaultPolicyBindings(g.se.Spec.VaultRef.Namespace).Get(context.TODO(), g.srb.VaultPolicyBindingName(), metav1.GetOptions{})
+func (g *MongoGenerator) GetVaultRoleName(ctx context.Context) (string, error) {
+	vpb, err := g.policyClient.VaultPolicyBindings(g.se.Spec.VaultRef.Namespace).Get(ctx, g.srb.VaultPolicyBindingName(), metav1.GetOptions{})
 	if err != nil {
 		return "", err
 	}
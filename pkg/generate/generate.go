@@ -17,6 +17,8 @@ limitations under the License.
 package generate
 
 import (
+	"context"
+
 	engineapi "kubevault.dev/apimachinery/apis/engine/v1alpha1"
 	enginecs "kubevault.dev/apimachinery/client/clientset/versioned/typed/engine/v1alpha1"
 	vaultcs "kubevault.dev/apimachinery/client/clientset/versioned/typed/kubevault/v1alpha2"
@@ -36,26 +38,26 @@ import (
 	"k8s.io/client-go/kubernetes"
 )
 
-func NewGenerator(role []string, srb *engineapi.SecretRoleBinding, keys map[string]string, engineClient *enginecs.EngineV1alpha1Client, vaultClient *vaultcs.KubevaultV1alpha2Client, policyClient *policycs.PolicyV1alpha1Client, kubeClient *kubernetes.Clientset) (api.GeneratorInterface, error) {
+func NewGenerator(ctx context.Context, role []string, srb *engineapi.SecretRoleBinding, keys map[string]string, engineClient *enginecs.EngineV1alpha1Client, vaultClient *vaultcs.KubevaultV1alpha2Client, policyClient *policycs.PolicyV1alpha1Client, kubeClient *kubernetes.Clientset) (api.GeneratorInterface, error) {
 	switch role[0] {
 	case engineapi.ResourceKindGCPRole:
-		return gcp.NewGCPGenerator(role, srb, keys, engineClient, vaultClient, policyClient, kubeClient)
+		return gcp.NewGCPGenerator(ctx, role, srb, keys, engineClient, vaultClient, policyClient, kubeClient)
 	case engineapi.ResourceKindAWSRole:
-		return aws.NewAWSGenerator(role, srb, keys, engineClient, vaultClient, policyClient, kubeClient)
+		return aws.NewAWSGenerator(ctx, role, srb, keys, engineClient, vaultClient, policyClient, kubeClient)
 	case engineapi.ResourceKindAzureRole:
-		return azure.NewAzureGenerator(role, srb, keys, engineClient, vaultClient, policyClient, kubeClient)
+		return azure.NewAzureGenerator(ctx, role, srb, keys, engineClient, vaultClient, policyClient, kubeClient)
 	case engineapi.ResourceKindMongoDBRole:
-		return mongo.NewMongoGenerator(role, srb, keys, engineClient, vaultClient, policyClient, kubeClient)
+		return mongo.NewMongoGenerator(ctx, role, srb, keys, engineClient, vaultClient, policyClient, kubeClient)
 	case engineapi.ResourceKindElasticsearchRole:
-		return es.NewElasticsearchGenerator(role, srb, keys, engineClient, vaultClient, policyClient, kubeClient)
+		return es.NewElasticsearchGenerator(ctx, role, srb, keys, engineClient, vaultClient, policyClient, kubeClient)
 	case engineapi.ResourceKindMySQLRole:
-		return sql.NewMySQLGenerator(role, srb, keys, engineClient, vaultClient, policyClient, kubeClient)
+		return sql.NewMySQLGenerator(ctx, role, srb, keys, engineClient, vaultClient, policyClient, kubeClient)
 	case engineapi.ResourceKindMariaDBRole:
-		return maria.NewMariaDBGenerator(role, srb, keys, engineClient, vaultClient, policyClient, kubeClient)
+		return maria.NewMariaDBGenerator(ctx, role, srb, keys, engineClient, vaultClient, policyClient, kubeClient)
 	case engineapi.ResourceKindRedisRole:
-		return rd.NewRedisGenerator(role, srb, keys, engineClient, vaultClient, policyClient, kubeClient)
+		return rd.NewRedisGenerator(ctx, role, srb, keys, engineClient, vaultClient, policyClient, kubeClient)
 	case engineapi.ResourceKindPostgresRole:
-		return pg.NewPostgresGenerator(role, srb, keys, engineClient, vaultClient, policyClient, kubeClient)
+		return pg.NewPostgresGenerator(ctx, role, srb, keys, engineClient, vaultClient, policyClient, kubeClient)
 	default:
 		return nil, errors.New("unknown role")
 	}
@@ -0,0 +1,109 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// SetManyWithRollback implements SetMany for key stores that write one key at a time.
+// The previous values are read first, if a write fails the keys written so far are
+// restored to their previous values or deleted.
+func SetManyWithRollback(ctx context.Context, ti TokenKeyInterface, values map[string]string) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	previous, err := storedValues(ctx, ti, keys)
+	if err != nil {
+		return err
+	}
+
+	for idx, key := range keys {
+		if err = ti.Set(ctx, key, values[key]); err != nil {
+			if err2 := restore(ti, keys[:idx], previous); err2 != nil {
+				return errors.Wrapf(err, "failed to set %s, rollback failed: %v", key, err2)
+			}
+			return errors.Wrapf(err, "failed to set %s, rolled back", key)
+		}
+	}
+	return nil
+}
+
+// DeleteManyWithRollback implements DeleteMany for key stores that delete one key at a time.
+// The values are read first, if a delete fails the keys deleted so far are restored.
+func DeleteManyWithRollback(ctx context.Context, ti TokenKeyInterface, keys []string) error {
+	previous, err := storedValues(ctx, ti, keys)
+	if err != nil {
+		return err
+	}
+
+	var deleted []string
+	for _, key := range keys {
+		if _, ok := previous[key]; !ok {
+			continue
+		}
+		if err = ti.Delete(ctx, key); err != nil {
+			if err2 := restore(ti, deleted, previous); err2 != nil {
+				return errors.Wrapf(err, "failed to delete %s, rollback failed: %v", key, err2)
+			}
+			return errors.Wrapf(err, "failed to delete %s, rolled back", key)
+		}
+		deleted = append(deleted, key)
+	}
+	return nil
+}
+
+// storedValues returns the values of the stored keys. Keys that are not stored are left out,
+// any other error of Get is returned.
+func storedValues(ctx context.Context, ti TokenKeyInterface, keys []string) (map[string]string, error) {
+	values := map[string]string{}
+	for _, key := range keys {
+		value, err := ti.Get(ctx, key)
+		if IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", key)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// restore sets the keys back to their previous values and deletes the keys that did not exist.
+// It does not use the context of the failed operation, so that it also runs on interrupt.
+func restore(ti TokenKeyInterface, keys []string, previous map[string]string) error {
+	ctx := context.Background()
+	for _, key := range keys {
+		var err error
+		if value, ok := previous[key]; ok {
+			err = ti.Set(ctx, key, value)
+		} else {
+			err = ti.Delete(ctx, key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
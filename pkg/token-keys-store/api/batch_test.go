@@ -0,0 +1,124 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api_test
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"reflect"
+	"testing"
+
+	"kubevault.dev/cli/pkg/token-keys-store/api"
+	"kubevault.dev/cli/pkg/token-keys-store/fake"
+)
+
+var errWrite = fake.ErrWrite
+
+func TestSetManyWithRollback(t *testing.T) {
+	stored := map[string]string{"a": "old-a", "c": "old-c"}
+	tests := []struct {
+		name    string
+		values  map[string]string
+		failing string
+		getErr  error
+		want    map[string]string
+		wantErr error
+	}{
+		{
+			name:   "all set",
+			values: map[string]string{"a": "new-a", "b": "new-b"},
+			want:   map[string]string{"a": "new-a", "b": "new-b", "c": "old-c"},
+		},
+		{
+			name:    "previous values restored",
+			values:  map[string]string{"a": "new-a", "b": "new-b", "c": "new-c"},
+			failing: "c",
+			want:    stored,
+			wantErr: errWrite,
+		},
+		{
+			name:    "new keys deleted",
+			values:  map[string]string{"b": "new-b", "d": "new-d"},
+			failing: "d",
+			want:    stored,
+			wantErr: errWrite,
+		},
+		{
+			name:    "read error",
+			values:  map[string]string{"a": "new-a"},
+			getErr:  errWrite,
+			want:    stored,
+			wantErr: errWrite,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := fake.NewStore(maps.Clone(stored))
+			s.Failing, s.GetErr = tt.failing, tt.getErr
+			err := api.SetManyWithRollback(context.Background(), s, tt.values)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SetManyWithRollback() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(s.Values, tt.want) {
+				t.Errorf("SetManyWithRollback() stored %v, want %v", s.Values, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteManyWithRollback(t *testing.T) {
+	stored := map[string]string{"a": "old-a", "b": "old-b", "c": "old-c"}
+	tests := []struct {
+		name    string
+		keys    []string
+		failing string
+		want    map[string]string
+		wantErr error
+	}{
+		{
+			name: "all deleted",
+			keys: []string{"a", "b"},
+			want: map[string]string{"c": "old-c"},
+		},
+		{
+			name: "missing keys ignored",
+			keys: []string{"a", "d"},
+			want: map[string]string{"b": "old-b", "c": "old-c"},
+		},
+		{
+			name:    "deleted keys restored",
+			keys:    []string{"a", "b", "c"},
+			failing: "c",
+			want:    stored,
+			wantErr: errWrite,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := fake.NewStore(maps.Clone(stored))
+			s.Failing = tt.failing
+			err := api.DeleteManyWithRollback(context.Background(), s, tt.keys)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DeleteManyWithRollback() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(s.Values, tt.want) {
+				t.Errorf("DeleteManyWithRollback() stored %v, want %v", s.Values, tt.want)
+			}
+		})
+	}
+}
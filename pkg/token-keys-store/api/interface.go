@@ -16,13 +16,31 @@ limitations under the License.
 
 package api
 
+import (
+	"context"
+	"time"
+)
+
+// KeyInfo describes a key stored in a key store.
+type KeyInfo struct {
+	Name string
+	// LastModified is zero if the key store does not record it
+	LastModified time.Time
+}
+
 type TokenKeyInterface interface {
-	Get(string) (string, error)
-	Set(string, string) error
-	Delete(string) error
+	Get(context.Context, string) (string, error)
+	Set(context.Context, string, string) error
+	Delete(context.Context, string) error
+	// SetMany sets all keys or none of them
+	SetMany(context.Context, map[string]string) error
+	// DeleteMany deletes all keys or none of them, keys that are not stored are ignored
+	DeleteMany(context.Context, []string) error
+	// List returns the stored keys whose name starts with the given prefix
+	List(context.Context, string) ([]KeyInfo, error)
 	Clean()
-	NewTokenName() string
+	NewTokenName(context.Context) string
 	OldTokenName() string
-	NewUnsealKeyName(int) (string, error)
+	NewUnsealKeyName(context.Context, int) (string, error)
 	OldUnsealKeyName(int) (string, error)
 }
@@ -0,0 +1,87 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// OldTokenName is the name of the root-token stored by older versions of the vault unsealer.
+const OldTokenName = "vault-root-token"
+
+// KeyPrefix returns the --key-prefix argument of the vault unsealer container of the VaultServer.
+func KeyPrefix(ctx context.Context, kubeClient kubernetes.Interface, vs *vaultapi.VaultServer) (string, error) {
+	sts, err := kubeClient.AppsV1().StatefulSets(vs.Namespace).Get(ctx, vs.Name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	var keyPrefix string
+	for _, cont := range sts.Spec.Template.Spec.Containers {
+		if cont.Name != vaultapi.VaultUnsealerContainerName {
+			continue
+		}
+		for _, arg := range cont.Args {
+			if strings.HasPrefix(arg, "--key-prefix=") {
+				keyPrefix = arg[1+strings.Index(arg, "="):]
+			}
+		}
+	}
+
+	return keyPrefix, nil
+}
+
+// NewTokenName returns the name of the root-token, or an empty name if the key prefix can't be read.
+func NewTokenName(ctx context.Context, kubeClient kubernetes.Interface, vs *vaultapi.VaultServer) string {
+	keyPrefix, err := KeyPrefix(ctx, kubeClient, vs)
+	if err != nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%s-root-token", keyPrefix)
+}
+
+// NewUnsealKeyName returns the name of the unseal-key with the given id.
+func NewUnsealKeyName(ctx context.Context, kubeClient kubernetes.Interface, vs *vaultapi.VaultServer, id int) (string, error) {
+	keyPrefix, err := KeyPrefix(ctx, kubeClient, vs)
+	if err != nil {
+		return "", err
+	}
+
+	if int64(id) >= vs.Spec.Unsealer.SecretShares {
+		return "", errors.Errorf("unseal-key-%d not available, available id range 0 to %d", id, vs.Spec.Unsealer.SecretShares-1)
+	}
+
+	return fmt.Sprintf("%s-unseal-key-%d", keyPrefix, id), nil
+}
+
+// OldUnsealKeyName returns the name of the unseal-key with the given id stored by older versions of the vault unsealer.
+func OldUnsealKeyName(vs *vaultapi.VaultServer, id int) (string, error) {
+	if int64(id) >= vs.Spec.Unsealer.SecretShares {
+		return "", errors.Errorf("unseal-key-%d not available, available id range 0 to %d", id, vs.Spec.Unsealer.SecretShares-1)
+	}
+
+	return fmt.Sprintf("vault-unseal-key-%d", id), nil
+}
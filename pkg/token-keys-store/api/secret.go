@@ -0,0 +1,91 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"context"
+
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// SetSecretData stores the values with a single update of the secret, which is created
+// if it does not exist. The update is retried on resourceVersion conflicts.
+func SetSecretData(ctx context.Context, kubeClient kubernetes.Interface, namespace, name string, data map[string][]byte) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := kubeClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if kerr.IsNotFound(err) {
+			_, err = kubeClient.CoreV1().Secrets(namespace).Create(ctx, &core.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: namespace,
+				},
+				Type: core.SecretTypeOpaque,
+				Data: data,
+			}, metav1.CreateOptions{})
+			if kerr.IsAlreadyExists(err) {
+				// created concurrently, retry as an update
+				return kerr.NewConflict(core.Resource("secrets"), name, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		for key, value := range data {
+			secret.Data[key] = value
+		}
+
+		_, err = kubeClient.CoreV1().Secrets(namespace).Update(ctx, secret, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// DeleteSecretData deletes the keys with a single update of the secret, retried on resourceVersion
+// conflicts. Keys that are not in the secret are ignored.
+func DeleteSecretData(ctx context.Context, kubeClient kubernetes.Interface, namespace, name string, keys []string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := kubeClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			if kerr.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+
+		var changed bool
+		for _, key := range keys {
+			if _, ok := secret.Data[key]; ok {
+				delete(secret.Data, key)
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+
+		_, err = kubeClient.CoreV1().Secrets(namespace).Update(ctx, secret, metav1.UpdateOptions{})
+		return err
+	})
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package aws_kms_ssm
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"fmt"
@@ -27,19 +28,46 @@ import (
 	"kubevault.dev/cli/pkg/token-keys-store/api"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/kms"
 	"github.com/aws/aws-sdk-go/service/ssm"
 	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
 const (
-	AccessKey = "AWS_ACCESS_KEY_ID"
-	SecretKey = "AWS_SECRET_ACCESS_KEY"
+	// RoleARN and WebIdentityTokenFile are set by EKS for IAM roles for service accounts (IRSA)
+	RoleARN              = "AWS_ROLE_ARN"
+	WebIdentityTokenFile = "AWS_WEB_IDENTITY_TOKEN_FILE"
 )
 
+// Options overrides the AWS settings that are not part of the AwsKmsSsmSpec.
+type Options struct {
+	// KmsEndpoint overrides spec.unsealer.mode.awsKmsSsm.endpoint
+	KmsEndpoint string
+	SsmEndpoint string
+	// CABundle is a PEM encoded CA bundle file used to verify the KMS and SSM endpoints
+	CABundle string
+	// RoleARN and WebIdentityTokenFile assume the role using web identity (IRSA) credentials
+	RoleARN              string
+	WebIdentityTokenFile string
+}
+
+// DefaultOptions is used by New, it is set from the command line flags.
+var DefaultOptions = &Options{}
+
+func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.KmsEndpoint, "aws-kms-endpoint", o.KmsEndpoint, "custom AWS KMS endpoint, overrides spec.unsealer.mode.awsKmsSsm.endpoint")
+	fs.StringVar(&o.SsmEndpoint, "aws-ssm-endpoint", o.SsmEndpoint, "custom AWS SSM endpoint")
+	fs.StringVar(&o.CABundle, "aws-ca-bundle", o.CABundle, "PEM encoded CA bundle file used to verify the AWS KMS and SSM endpoints")
+	fs.StringVar(&o.RoleARN, "aws-role-arn", o.RoleARN, "AWS role to assume using the web identity token, defaults to "+RoleARN)
+	fs.StringVar(&o.WebIdentityTokenFile, "aws-web-identity-token-file", o.WebIdentityTokenFile, "web identity token file used to assume --aws-role-arn, defaults to "+WebIdentityTokenFile)
+}
+
 type TokenKeyInfo struct {
 	ssmService *ssm.SSM
 	kmsService *kms.KMS
@@ -50,6 +78,10 @@ type TokenKeyInfo struct {
 var _ api.TokenKeyInterface = &TokenKeyInfo{}
 
 func New(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) (*TokenKeyInfo, error) {
+	return NewWithOptions(vs, kubeClient, DefaultOptions)
+}
+
+func NewWithOptions(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface, opts *Options) (*TokenKeyInfo, error) {
 	if vs == nil {
 		return nil, errors.New("vs spec is empty")
 	}
@@ -62,67 +94,113 @@ func New(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) (*TokenKeyIn
 		return nil, errors.New("kubeClient is nil")
 	}
 
-	if vs.Spec.Unsealer.Mode.AwsKmsSsm.CredentialSecretRef != nil {
-		secret, err := kubeClient.CoreV1().Secrets(vs.Namespace).Get(context.TODO(), vs.Spec.Unsealer.Mode.AwsKmsSsm.CredentialSecretRef.Name, metav1.GetOptions{})
+	if opts == nil {
+		opts = &Options{}
+	}
+	awsKmsSsmSpec := vs.Spec.Unsealer.Mode.AwsKmsSsm
+
+	cfg := aws.Config{
+		CredentialsChainVerboseErrors: func() *bool {
+			f := true
+			return &f
+		}(),
+		Region: aws.String(awsKmsSsmSpec.Region),
+	}
+
+	if awsKmsSsmSpec.CredentialSecretRef != nil {
+		secret, err := kubeClient.CoreV1().Secrets(vs.Namespace).Get(context.TODO(), awsKmsSsmSpec.CredentialSecretRef.Name, metav1.GetOptions{})
 		if err != nil {
 			return nil, err
 		}
 
-		accessKey, ok := secret.Data["access_key"]
-		if ok {
-			if err = os.Setenv(AccessKey, string(accessKey)); err != nil {
-				return nil, err
-			}
+		creds, err := staticCredentials(secret.Data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid credential secret %s/%s", vs.Namespace, secret.Name)
 		}
+		cfg.Credentials = creds
+	}
 
-		secretKey, ok := secret.Data["secret_key"]
-		if ok {
-			if err = os.Setenv(SecretKey, string(secretKey)); err != nil {
-				return nil, err
-			}
-		}
-	} else {
-		if _, ok := os.LookupEnv(AccessKey); !ok {
-			_, _ = fmt.Fprintf(os.Stderr, "WARNING!!! missing env variable %s", AccessKey)
-		}
-		if _, ok := os.LookupEnv(SecretKey); !ok {
-			_, _ = fmt.Fprintf(os.Stderr, "WARNING!!! missing env variable %s", SecretKey)
+	sessOpts := session.Options{
+		Config:            cfg,
+		SharedConfigState: session.SharedConfigEnable,
+	}
+	if len(opts.CABundle) > 0 {
+		caBundle, err := os.ReadFile(opts.CABundle)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read aws ca bundle")
 		}
+		sessOpts.CustomCABundle = bytes.NewReader(caBundle)
 	}
 
-	sess, err := session.NewSession(&aws.Config{
-		CredentialsChainVerboseErrors: func() *bool {
-			f := true
-			return &f
-		}(),
-		Region: aws.String(vs.Spec.Unsealer.Mode.AwsKmsSsm.Region),
-	},
-	)
+	sess, err := session.NewSessionWithOptions(sessOpts)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create session")
 	}
 
+	// web identity credentials given by flags take precedence over the default credential chain,
+	// the default chain already picks up AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE.
+	if awsKmsSsmSpec.CredentialSecretRef == nil && len(opts.RoleARN) > 0 {
+		tokenFile := opts.WebIdentityTokenFile
+		if len(tokenFile) == 0 {
+			tokenFile = os.Getenv(WebIdentityTokenFile)
+		}
+		if len(tokenFile) == 0 {
+			return nil, errors.New("web identity token file is required to assume --aws-role-arn")
+		}
+		sess.Config.Credentials = stscreds.NewWebIdentityCredentials(sess, opts.RoleARN, "kubectl-vault", tokenFile)
+	}
+
+	kmsEndpoint := awsKmsSsmSpec.Endpoint
+	if len(opts.KmsEndpoint) > 0 {
+		kmsEndpoint = opts.KmsEndpoint
+	}
+
+	kmsConfig := aws.NewConfig()
+	if len(kmsEndpoint) > 0 {
+		kmsConfig = kmsConfig.WithEndpoint(kmsEndpoint)
+	}
+	ssmConfig := aws.NewConfig()
+	if len(opts.SsmEndpoint) > 0 {
+		ssmConfig = ssmConfig.WithEndpoint(opts.SsmEndpoint)
+	}
+
 	return &TokenKeyInfo{
-		kmsService: kms.New(sess),
-		ssmService: ssm.New(sess),
+		kmsService: kms.New(sess, kmsConfig),
+		ssmService: ssm.New(sess, ssmConfig),
 		kubeClient: kubeClient,
 		vs:         vs,
 	}, nil
 }
 
-func (ti *TokenKeyInfo) Get(key string) (string, error) {
+// staticCredentials returns the credentials of the access_key and secret_key of the credential secret.
+// It returns nil without both keys, so that the default credential chain is used.
+func staticCredentials(data map[string][]byte) (*credentials.Credentials, error) {
+	accessKey, hasAccessKey := data["access_key"]
+	secretKey, hasSecretKey := data["secret_key"]
+	switch {
+	case hasAccessKey && hasSecretKey:
+		return credentials.NewStaticCredentials(string(accessKey), string(secretKey), string(data["session_token"])), nil
+	case hasAccessKey:
+		return nil, errors.New("access_key is set without secret_key")
+	case hasSecretKey:
+		return nil, errors.New("secret_key is set without access_key")
+	}
+	return nil, nil
+}
+
+func (ti *TokenKeyInfo) Get(ctx context.Context, key string) (string, error) {
 	req := &ssm.GetParametersInput{
 		Names: []*string{
 			aws.String(key),
 		},
 		WithDecryption: aws.Bool(false),
 	}
-	params, err := ti.ssmService.GetParameters(req)
+	params, err := ti.ssmService.GetParametersWithContext(ctx, req)
 	if err != nil {
 		return "", errors.Wrap(err, "failed to get key from ssm")
 	}
 	if len(params.Parameters) == 0 {
-		return "", errors.New("failed to get key from ssm; empty response")
+		return "", api.NewNotFoundError("%s not found in ssm", key)
 	}
 	// Since len of the params is greater than zero
 	sDec, err := base64.StdEncoding.DecodeString(*params.Parameters[0].Value)
@@ -131,7 +209,7 @@ func (ti *TokenKeyInfo) Get(key string) (string, error) {
 	}
 
 	awsKmsSsmSpec := ti.vs.Spec.Unsealer.Mode.AwsKmsSsm
-	decryptOutput, err := ti.kmsService.Decrypt(&kms.DecryptInput{
+	decryptOutput, err := ti.kmsService.DecryptWithContext(ctx, &kms.DecryptInput{
 		CiphertextBlob: sDec,
 		EncryptionContext: map[string]*string{
 			"Tool": aws.String("vault-unsealer"),
@@ -146,23 +224,23 @@ func (ti *TokenKeyInfo) Get(key string) (string, error) {
 	return string(decryptOutput.Plaintext), nil
 }
 
-func (ti *TokenKeyInfo) Delete(key string) error {
+func (ti *TokenKeyInfo) Delete(ctx context.Context, key string) error {
 	req := &ssm.DeleteParameterInput{
 		Name: aws.String(key),
 	}
 
-	_, err := ti.ssmService.DeleteParameter(req)
+	_, err := ti.ssmService.DeleteParameterWithContext(ctx, req)
 	if err != nil {
-		return errors.Errorf("failed to delete key from ssm with %s", err.Error())
+		return errors.Wrap(err, "failed to delete key from ssm")
 	}
 
 	return nil
 }
 
-func (ti *TokenKeyInfo) Set(key, value string) error {
+func (ti *TokenKeyInfo) Set(ctx context.Context, key, value string) error {
 	awsKmsSsmSpec := ti.vs.Spec.Unsealer.Mode.AwsKmsSsm
 
-	out, err := ti.kmsService.Encrypt(&kms.EncryptInput{
+	out, err := ti.kmsService.EncryptWithContext(ctx, &kms.EncryptInput{
 		KeyId:     aws.String(awsKmsSsmSpec.KmsKeyID),
 		Plaintext: []byte(value),
 		EncryptionContext: map[string]*string{
@@ -182,34 +260,83 @@ func (ti *TokenKeyInfo) Set(key, value string) error {
 		Value:       aws.String(base64.StdEncoding.EncodeToString(out.CiphertextBlob)),
 	}
 
-	_, err = ti.ssmService.PutParameter(req)
+	_, err = ti.ssmService.PutParameterWithContext(ctx, req)
 	return err
 }
 
-func (ti *TokenKeyInfo) NewTokenName() string {
-	sts, err := ti.kubeClient.AppsV1().StatefulSets(ti.vs.Namespace).Get(context.TODO(), ti.vs.Name, metav1.GetOptions{})
-	if err != nil {
-		return ""
-	}
+// SetMany sets the keys one by one, restoring the previous values if a key fails.
+func (ti *TokenKeyInfo) SetMany(ctx context.Context, values map[string]string) error {
+	return api.SetManyWithRollback(ctx, ti, values)
+}
 
-	var keyPrefix string
-	for _, cont := range sts.Spec.Template.Spec.Containers {
-		if cont.Name != vaultapi.VaultUnsealerContainerName {
-			continue
+// DeleteMany deletes the keys one by one, restoring the deleted keys if a key fails.
+func (ti *TokenKeyInfo) DeleteMany(ctx context.Context, keys []string) error {
+	return api.DeleteManyWithRollback(ctx, ti, keys)
+}
+
+// List lists the ssm parameters starting with prefix. Hierarchical names (starting with /)
+// are listed by path, others are listed by the name filter of DescribeParameters.
+func (ti *TokenKeyInfo) List(ctx context.Context, prefix string) ([]api.KeyInfo, error) {
+	var keys []api.KeyInfo
+	if strings.HasPrefix(prefix, "/") {
+		path := "/"
+		if idx := strings.LastIndex(prefix, "/"); idx > 0 {
+			path = prefix[:idx]
+		}
+		req := &ssm.GetParametersByPathInput{
+			Path:           aws.String(path),
+			Recursive:      aws.Bool(true),
+			WithDecryption: aws.Bool(false),
 		}
-		for _, arg := range cont.Args {
-			if strings.HasPrefix(arg, "--key-prefix=") {
-				keyPrefix = arg[1+strings.Index(arg, "="):]
+		err := ti.ssmService.GetParametersByPathPagesWithContext(ctx, req, func(out *ssm.GetParametersByPathOutput, lastPage bool) bool {
+			for _, p := range out.Parameters {
+				if strings.HasPrefix(aws.StringValue(p.Name), prefix) {
+					keys = append(keys, api.KeyInfo{
+						Name:         aws.StringValue(p.Name),
+						LastModified: aws.TimeValue(p.LastModifiedDate),
+					})
+				}
 			}
+			return true
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list keys from ssm")
 		}
+		return keys, nil
 	}
 
-	awsKmsSsmSpec := ti.vs.Spec.Unsealer.Mode.AwsKmsSsm
-	if awsKmsSsmSpec.SsmKeyPrefix != "" {
-		return fmt.Sprintf("%s%s", awsKmsSsmSpec.SsmKeyPrefix, fmt.Sprintf("%s-root-token", keyPrefix))
+	req := &ssm.DescribeParametersInput{}
+	if len(prefix) > 0 {
+		req.ParameterFilters = []*ssm.ParameterStringFilter{
+			{
+				Key:    aws.String("Name"),
+				Option: aws.String("BeginsWith"),
+				Values: []*string{aws.String(prefix)},
+			},
+		}
+	}
+	err := ti.ssmService.DescribeParametersPagesWithContext(ctx, req, func(out *ssm.DescribeParametersOutput, lastPage bool) bool {
+		for _, p := range out.Parameters {
+			keys = append(keys, api.KeyInfo{
+				Name:         aws.StringValue(p.Name),
+				LastModified: aws.TimeValue(p.LastModifiedDate),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list keys from ssm")
+	}
+	return keys, nil
+}
+
+func (ti *TokenKeyInfo) NewTokenName(ctx context.Context) string {
+	name := api.NewTokenName(ctx, ti.kubeClient, ti.vs)
+	if len(name) == 0 {
+		return ""
 	}
 
-	return fmt.Sprintf("%s-root-token", keyPrefix)
+	return ti.vs.Spec.Unsealer.Mode.AwsKmsSsm.SsmKeyPrefix + name
 }
 
 func (ti *TokenKeyInfo) OldTokenName() string {
@@ -220,34 +347,13 @@ func (ti *TokenKeyInfo) OldTokenName() string {
 	return "vault-root-token"
 }
 
-func (ti *TokenKeyInfo) NewUnsealKeyName(id int) (string, error) {
-	sts, err := ti.kubeClient.AppsV1().StatefulSets(ti.vs.Namespace).Get(context.TODO(), ti.vs.Name, metav1.GetOptions{})
+func (ti *TokenKeyInfo) NewUnsealKeyName(ctx context.Context, id int) (string, error) {
+	name, err := api.NewUnsealKeyName(ctx, ti.kubeClient, ti.vs, id)
 	if err != nil {
 		return "", err
 	}
 
-	if int64(id) >= ti.vs.Spec.Unsealer.SecretShares {
-		return "", errors.Errorf("unseal-key-%d not available, available id range 0 to %d", id, ti.vs.Spec.Unsealer.SecretShares-1)
-	}
-
-	var keyPrefix string
-	for _, cont := range sts.Spec.Template.Spec.Containers {
-		if cont.Name != vaultapi.VaultUnsealerContainerName {
-			continue
-		}
-		for _, arg := range cont.Args {
-			if strings.HasPrefix(arg, "--key-prefix=") {
-				keyPrefix = arg[1+strings.Index(arg, "="):]
-			}
-		}
-	}
-
-	awsKmsSsmSpec := ti.vs.Spec.Unsealer.Mode.AwsKmsSsm
-	if awsKmsSsmSpec.SsmKeyPrefix != "" {
-		return fmt.Sprintf("%s%s", awsKmsSsmSpec.SsmKeyPrefix, fmt.Sprintf("%s-unseal-key-%d", keyPrefix, id)), nil
-	}
-
-	return fmt.Sprintf("%s-unseal-key-%d", keyPrefix, id), nil
+	return ti.vs.Spec.Unsealer.Mode.AwsKmsSsm.SsmKeyPrefix + name, nil
 }
 
 func (ti *TokenKeyInfo) OldUnsealKeyName(id int) (string, error) {
@@ -264,6 +370,4 @@ func (ti *TokenKeyInfo) OldUnsealKeyName(id int) (string, error) {
 }
 
 func (ti *TokenKeyInfo) Clean() {
-	_ = os.Unsetenv(AccessKey)
-	_ = os.Unsetenv(SecretKey)
 }
@@ -0,0 +1,172 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aws_kms_ssm
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+	"kubevault.dev/cli/pkg/token-keys-store/fake"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStaticCredentials(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      map[string][]byte
+		wantNil   bool
+		wantKey   string
+		wantToken string
+		wantErr   bool
+	}{
+		{
+			name:    "access_key and secret_key",
+			data:    map[string][]byte{"access_key": []byte("AKID"), "secret_key": []byte("SECRET")},
+			wantKey: "AKID",
+		},
+		{
+			name:      "session_token",
+			data:      map[string][]byte{"access_key": []byte("AKID"), "secret_key": []byte("SECRET"), "session_token": []byte("TOKEN")},
+			wantKey:   "AKID",
+			wantToken: "TOKEN",
+		},
+		{
+			name:    "neither key uses the default chain",
+			data:    map[string][]byte{"other": []byte("value")},
+			wantNil: true,
+		},
+		{
+			name:    "access_key only",
+			data:    map[string][]byte{"access_key": []byte("AKID")},
+			wantErr: true,
+		},
+		{
+			name:    "secret_key only",
+			data:    map[string][]byte{"secret_key": []byte("SECRET")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			creds, err := staticCredentials(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("staticCredentials() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if tt.wantNil {
+				if creds != nil {
+					t.Errorf("staticCredentials() = %v, want nil", creds)
+				}
+				return
+			}
+
+			value, err := creds.Get()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value.AccessKeyID != tt.wantKey || value.SessionToken != tt.wantToken {
+				t.Errorf("credentials = %s/%s, want %s/%s", value.AccessKeyID, value.SessionToken, tt.wantKey, tt.wantToken)
+			}
+		})
+	}
+}
+
+func TestNewWithOptions(t *testing.T) {
+	// keep the shared config and credentials of the machine out of the test
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv(WebIdentityTokenFile, "")
+
+	newVS := func(name, secretName string) *vaultapi.VaultServer {
+		vs := &vaultapi.VaultServer{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: name}}
+		vs.Spec.Unsealer = &vaultapi.UnsealerSpec{Mode: vaultapi.ModeSpec{AwsKmsSsm: &vaultapi.AwsKmsSsmSpec{
+			KmsKeyID: "key",
+			Region:   "us-east-1",
+		}}}
+		if len(secretName) > 0 {
+			vs.Spec.Unsealer.Mode.AwsKmsSsm.CredentialSecretRef = &core.LocalObjectReference{Name: secretName}
+		}
+		return vs
+	}
+	secret := func(name string, data map[string]string) *core.Secret {
+		s := &core.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: name}, Data: map[string][]byte{}}
+		for k, v := range data {
+			s.Data[k] = []byte(v)
+		}
+		return s
+	}
+	kubeClient := fake.SecretClient(t,
+		secret("aws-a", map[string]string{"access_key": "AKID-A", "secret_key": "SECRET-A"}),
+		secret("aws-b", map[string]string{"access_key": "AKID-B", "secret_key": "SECRET-B"}),
+		secret("aws-partial", map[string]string{"access_key": "AKID"}),
+	)
+	environ := os.Environ()
+
+	// every store keeps the credentials of its own vaultserver
+	stores := map[string]*TokenKeyInfo{}
+	for name, secretName := range map[string]string{"AKID-A": "aws-a", "AKID-B": "aws-b"} {
+		ti, err := NewWithOptions(newVS(secretName, secretName), kubeClient, &Options{KmsEndpoint: "https://kms.example.com"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		stores[name] = ti
+	}
+	for want, ti := range stores {
+		value, err := ti.kmsService.Config.Credentials.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value.AccessKeyID != want {
+			t.Errorf("kms access key = %s, want %s", value.AccessKeyID, want)
+		}
+		if value, _ = ti.ssmService.Config.Credentials.Get(); value.AccessKeyID != want {
+			t.Errorf("ssm access key = %s, want %s", value.AccessKeyID, want)
+		}
+		if ti.kmsService.Endpoint != "https://kms.example.com" {
+			t.Errorf("kms endpoint = %s, want https://kms.example.com", ti.kmsService.Endpoint)
+		}
+	}
+	if !slices.Equal(os.Environ(), environ) {
+		t.Error("NewWithOptions() changed the environment")
+	}
+
+	errTests := []struct {
+		name string
+		vs   *vaultapi.VaultServer
+		opts *Options
+	}{
+		{name: "partial credential secret", vs: newVS("vault", "aws-partial")},
+		{name: "missing credential secret", vs: newVS("vault", "aws-missing")},
+		{name: "role without web identity token file", vs: newVS("vault", ""), opts: &Options{RoleARN: "arn:aws:iam::123456789012:role/vault"}},
+		{name: "missing ca bundle", vs: newVS("vault", "aws-a"), opts: &Options{CABundle: filepath.Join(dir, "ca.crt")}},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewWithOptions(tt.vs, kubeClient, tt.opts); err == nil {
+				t.Error("NewWithOptions() error = nil, want an error")
+			}
+		})
+	}
+}
@@ -19,14 +19,15 @@ package azure_key_vault
 import (
 	"context"
 	"encoding/base64"
-	"fmt"
-	"os"
+	"net/http"
 	"strings"
 	"time"
 
 	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
 	"kubevault.dev/cli/pkg/token-keys-store/api"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/keyvault/azsecrets"
 	"github.com/pkg/errors"
@@ -37,13 +38,10 @@ import (
 
 const (
 	ContentTypePassword = "password"
-	ClientID            = "AZURE_CLIENT_ID"
-	ClientSecret        = "AZURE_CLIENT_SECRET"
-	TenantID            = "AZURE_TENANT_ID"
 )
 
 type TokenKeyInfo struct {
-	cred       *azidentity.DefaultAzureCredential
+	cred       azcore.TokenCredential
 	kubeClient kubernetes.Interface
 	vs         *vaultapi.VaultServer
 }
@@ -63,65 +61,126 @@ func New(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) (*TokenKeyIn
 		return nil, errors.New("kubeClient is nil")
 	}
 
-	if vs.Spec.Unsealer.Mode.AzureKeyVault.CredentialSecretRef != nil {
-		secret, err := kubeClient.CoreV1().Secrets(vs.Namespace).Get(context.TODO(), vs.Spec.Unsealer.Mode.AzureKeyVault.CredentialSecretRef.Name, metav1.GetOptions{})
+	cred, err := newCredential(vs, kubeClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenKeyInfo{
+		cred:       cred,
+		vs:         vs,
+		kubeClient: kubeClient,
+	}, nil
+}
+
+// cloudConfig returns the authority host of the cloud environment.
+// Both the identifiers used by the vault unsealer (e.g. AZUREUSGOVERNMENTCLOUD)
+// and the short names (e.g. AzureUSGovernment) are accepted.
+func cloudConfig(name string) (cloud.Configuration, error) {
+	switch strings.ToUpper(name) {
+	case "", "AZUREPUBLICCLOUD", "AZUREPUBLIC", "AZURECLOUD":
+		return cloud.AzurePublic, nil
+	case "AZUREUSGOVERNMENTCLOUD", "AZUREUSGOVERNMENT", "AZUREGOVERNMENT":
+		return cloud.AzureGovernment, nil
+	case "AZURECHINACLOUD", "AZURECHINA":
+		return cloud.AzureChina, nil
+	}
+
+	return cloud.Configuration{}, errors.Errorf("unknown/unsupported azure cloud %s", name)
+}
+
+// newCredential returns the credential described by the AzureKeyVault spec, in order of precedence:
+// - managed identity, if useManagedIdentity is set
+// - client certificate from tlsSecretRef, with the client-id from credentialSecretRef
+// - client secret from credentialSecretRef
+// - the default azure credential chain
+func newCredential(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) (azcore.TokenCredential, error) {
+	spec := vs.Spec.Unsealer.Mode.AzureKeyVault
+
+	cloudCfg, err := cloudConfig(spec.Cloud)
+	if err != nil {
+		return nil, err
+	}
+	clientOpts := azcore.ClientOptions{Cloud: cloudCfg}
+
+	var credData map[string][]byte
+	if spec.CredentialSecretRef != nil {
+		secret, err := kubeClient.CoreV1().Secrets(vs.Namespace).Get(context.TODO(), spec.CredentialSecretRef.Name, metav1.GetOptions{})
 		if err != nil {
 			return nil, err
 		}
+		credData = secret.Data
+	}
+	clientID := string(credData["client-id"])
+
+	if spec.UseManagedIdentity {
+		opts := &azidentity.ManagedIdentityCredentialOptions{ClientOptions: clientOpts}
+		// a client-id selects a user-assigned managed identity
+		if len(clientID) > 0 {
+			opts.ID = azidentity.ClientID(clientID)
+		}
+		return azidentity.NewManagedIdentityCredential(opts)
+	}
 
-		clientID, ok := secret.Data["client-id"]
-		if ok {
-			if err = os.Setenv(ClientID, string(clientID)); err != nil {
-				return nil, err
-			}
+	if spec.TLSSecretRef != nil {
+		secret, err := kubeClient.CoreV1().Secrets(vs.Namespace).Get(context.TODO(), spec.TLSSecretRef.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
 		}
 
-		clientSecret, ok := secret.Data["client-secret"]
-		if ok {
-			if err = os.Setenv(ClientSecret, string(clientSecret)); err != nil {
-				return nil, err
-			}
+		certData, ok := secret.Data["client-cert"]
+		if !ok {
+			return nil, errors.Errorf("client-cert not found in secret %s/%s", vs.Namespace, secret.Name)
 		}
-	} else {
-		if _, ok := os.LookupEnv(ClientID); !ok {
-			_, _ = fmt.Fprintf(os.Stderr, "WARNING!!! missing env variable %s", ClientID)
+		if len(clientID) == 0 {
+			return nil, errors.New("client-id is required in credentialSecretRef to use client certificate")
 		}
-		if _, ok := os.LookupEnv(ClientSecret); !ok {
-			_, _ = fmt.Fprintf(os.Stderr, "WARNING!!! missing env variable %s", ClientSecret)
+
+		certs, key, err := azidentity.ParseCertificates(certData, secret.Data["client-cert-password"])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse client certificate from secret %s/%s", vs.Namespace, secret.Name)
 		}
-	}
 
-	if err := os.Setenv(TenantID, vs.Spec.Unsealer.Mode.AzureKeyVault.TenantID); err != nil {
-		return nil, err
+		return azidentity.NewClientCertificateCredential(spec.TenantID, clientID, certs, key, &azidentity.ClientCertificateCredentialOptions{
+			ClientOptions: clientOpts,
+		})
 	}
 
-	cred, err := azidentity.NewDefaultAzureCredential(nil)
-	if err != nil {
-		return nil, err
+	if clientSecret, ok := credData["client-secret"]; ok {
+		if len(clientID) == 0 {
+			return nil, errors.New("client-id is required in credentialSecretRef to use client secret")
+		}
+
+		return azidentity.NewClientSecretCredential(spec.TenantID, clientID, string(clientSecret), &azidentity.ClientSecretCredentialOptions{
+			ClientOptions: clientOpts,
+		})
 	}
 
-	return &TokenKeyInfo{
-		cred:       cred,
-		vs:         vs,
-		kubeClient: kubeClient,
-	}, nil
+	return azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{
+		ClientOptions: clientOpts,
+		TenantID:      spec.TenantID,
+	})
 }
 
-func (ti *TokenKeyInfo) Get(key string) (string, error) {
+func (ti *TokenKeyInfo) Get(ctx context.Context, key string) (string, error) {
 	vaultBaseUrl := ti.vs.Spec.Unsealer.Mode.AzureKeyVault.VaultBaseURL
 	client := azsecrets.NewClient(vaultBaseUrl, ti.cred, nil)
 
-	version, err := ti.getLatestVersion(key)
+	version, err := ti.getLatestVersion(ctx, key)
 	if err != nil {
 		return "", err
 	}
 
+	if len(version) == 0 {
+		return "", api.NewNotFoundError("%s not found in key vault %s", key, vaultBaseUrl)
+	}
+
 	idx := strings.LastIndex(version, "/")
 	if idx == -1 {
 		return "", errors.New("version id not found")
 	}
 
-	resp, err := client.GetSecret(context.Background(), strings.ReplaceAll(key, ".", "-"), version[idx+1:], nil)
+	resp, err := client.GetSecret(ctx, strings.ReplaceAll(key, ".", "-"), version[idx+1:], nil)
 	if err != nil {
 		return "", err
 	}
@@ -138,35 +197,39 @@ func (ti *TokenKeyInfo) Get(key string) (string, error) {
 	return string(decoded), nil
 }
 
-func (ti *TokenKeyInfo) Delete(key string) error {
+func (ti *TokenKeyInfo) Delete(ctx context.Context, key string) error {
 	key = strings.ReplaceAll(key, ".", "-")
 
 	vaultBaseUrl := ti.vs.Spec.Unsealer.Mode.AzureKeyVault.VaultBaseURL
 	client := azsecrets.NewClient(vaultBaseUrl, ti.cred, nil)
 
-	_, err := client.DeleteSecret(context.TODO(), key, nil)
+	_, err := client.DeleteSecret(ctx, key, nil)
 	if err != nil {
 		return err
 	}
 
 	for i := 0; i < 15; i++ {
-		_, err = client.PurgeDeletedSecret(context.TODO(), key, nil)
+		_, err = client.PurgeDeletedSecret(ctx, key, nil)
 		if err == nil {
 			return nil
 		}
-		time.Sleep(2 * time.Second)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
 	}
 
 	return err
 }
 
-func (ti *TokenKeyInfo) Set(key, value string) error {
+func (ti *TokenKeyInfo) Set(ctx context.Context, key, value string) error {
 	key = strings.ReplaceAll(key, ".", "-")
 
 	vaultBaseUrl := ti.vs.Spec.Unsealer.Mode.AzureKeyVault.VaultBaseURL
 	client := azsecrets.NewClient(vaultBaseUrl, ti.cred, nil)
 
-	_, err := client.SetSecret(context.TODO(), key, azsecrets.SetSecretParameters{
+	_, err := client.SetSecret(ctx, key, azsecrets.SetSecretParameters{
 		Value:       pointer.StringP(base64.StdEncoding.EncodeToString([]byte(value))),
 		ContentType: pointer.StringP("password"),
 	}, nil)
@@ -177,7 +240,44 @@ func (ti *TokenKeyInfo) Set(key, value string) error {
 	return nil
 }
 
-func (ti *TokenKeyInfo) getLatestVersion(key string) (string, error) {
+// SetMany sets the keys one by one, restoring the previous values if a key fails.
+func (ti *TokenKeyInfo) SetMany(ctx context.Context, values map[string]string) error {
+	return api.SetManyWithRollback(ctx, ti, values)
+}
+
+// DeleteMany deletes the keys one by one, restoring the deleted keys if a key fails.
+func (ti *TokenKeyInfo) DeleteMany(ctx context.Context, keys []string) error {
+	return api.DeleteManyWithRollback(ctx, ti, keys)
+}
+
+func (ti *TokenKeyInfo) List(ctx context.Context, prefix string) ([]api.KeyInfo, error) {
+	prefix = strings.ReplaceAll(prefix, ".", "-")
+
+	vaultBaseUrl := ti.vs.Spec.Unsealer.Mode.AzureKeyVault.VaultBaseURL
+	client := azsecrets.NewClient(vaultBaseUrl, ti.cred, nil)
+
+	var keys []api.KeyInfo
+	pager := client.NewListSecretsPager(nil)
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to list secrets in key vault")
+		}
+		for _, item := range resp.Value {
+			if item.ID == nil || !strings.HasPrefix(item.ID.Name(), prefix) {
+				continue
+			}
+			key := api.KeyInfo{Name: item.ID.Name()}
+			if item.Attributes != nil && item.Attributes.Updated != nil {
+				key.LastModified = *item.Attributes.Updated
+			}
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (ti *TokenKeyInfo) getLatestVersion(ctx context.Context, key string) (string, error) {
 	key = strings.ReplaceAll(key, ".", "-")
 	vaultBaseUrl := ti.vs.Spec.Unsealer.Mode.AzureKeyVault.VaultBaseURL
 	client := azsecrets.NewClient(vaultBaseUrl, ti.cred, nil)
@@ -186,8 +286,12 @@ func (ti *TokenKeyInfo) getLatestVersion(key string) (string, error) {
 	var dur time.Duration
 	pager := client.NewListSecretVersionsPager(key, nil)
 	for pager.More() {
-		resp, err := pager.NextPage(context.Background())
+		resp, err := pager.NextPage(ctx)
 		if err != nil {
+			var respErr *azcore.ResponseError
+			if errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound {
+				return "", nil
+			}
 			return "", err
 		}
 		for _, ver := range resp.Value {
@@ -205,66 +309,21 @@ func (ti *TokenKeyInfo) getLatestVersion(key string) (string, error) {
 	return string(version), nil
 }
 
-func (ti *TokenKeyInfo) NewTokenName() string {
-	sts, err := ti.kubeClient.AppsV1().StatefulSets(ti.vs.Namespace).Get(context.TODO(), ti.vs.Name, metav1.GetOptions{})
-	if err != nil {
-		return ""
-	}
-
-	var keyPrefix string
-	for _, cont := range sts.Spec.Template.Spec.Containers {
-		if cont.Name != vaultapi.VaultUnsealerContainerName {
-			continue
-		}
-		for _, arg := range cont.Args {
-			if strings.HasPrefix(arg, "--key-prefix=") {
-				keyPrefix = arg[1+strings.Index(arg, "="):]
-			}
-		}
-	}
-
-	return fmt.Sprintf("%s-root-token", keyPrefix)
+func (ti *TokenKeyInfo) NewTokenName(ctx context.Context) string {
+	return api.NewTokenName(ctx, ti.kubeClient, ti.vs)
 }
 
 func (ti *TokenKeyInfo) OldTokenName() string {
-	return "vault-root-token"
+	return api.OldTokenName
 }
 
-func (ti *TokenKeyInfo) NewUnsealKeyName(id int) (string, error) {
-	sts, err := ti.kubeClient.AppsV1().StatefulSets(ti.vs.Namespace).Get(context.TODO(), ti.vs.Name, metav1.GetOptions{})
-	if err != nil {
-		return "", err
-	}
-
-	if int64(id) >= ti.vs.Spec.Unsealer.SecretShares {
-		return "", errors.Errorf("unseal-key-%d not available, available id range 0 to %d", id, ti.vs.Spec.Unsealer.SecretShares-1)
-	}
-
-	var keyPrefix string
-	for _, cont := range sts.Spec.Template.Spec.Containers {
-		if cont.Name != vaultapi.VaultUnsealerContainerName {
-			continue
-		}
-		for _, arg := range cont.Args {
-			if strings.HasPrefix(arg, "--key-prefix=") {
-				keyPrefix = arg[1+strings.Index(arg, "="):]
-			}
-		}
-	}
-
-	return fmt.Sprintf("%s-unseal-key-%d", keyPrefix, id), nil
+func (ti *TokenKeyInfo) NewUnsealKeyName(ctx context.Context, id int) (string, error) {
+	return api.NewUnsealKeyName(ctx, ti.kubeClient, ti.vs, id)
 }
 
 func (ti *TokenKeyInfo) OldUnsealKeyName(id int) (string, error) {
-	if int64(id) >= ti.vs.Spec.Unsealer.SecretShares {
-		return "", errors.Errorf("unseal-key-%d not available, available id range 0 to %d", id, ti.vs.Spec.Unsealer.SecretShares-1)
-	}
-
-	return fmt.Sprintf("vault-unseal-key-%d", id), nil
+	return api.OldUnsealKeyName(ti.vs, id)
 }
 
 func (ti *TokenKeyInfo) Clean() {
-	_ = os.Unsetenv(ClientID)
-	_ = os.Unsetenv(ClientSecret)
-	_ = os.Unsetenv(TenantID)
 }
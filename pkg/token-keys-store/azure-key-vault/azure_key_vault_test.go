@@ -0,0 +1,177 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure_key_vault
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+	"kubevault.dev/cli/pkg/token-keys-store/fake"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// clientCertPEM returns a self-signed client certificate with its private key, azure requires an rsa key.
+func clientCertPEM(t *testing.T) []byte {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "vault-unsealer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})...)
+}
+
+func TestNewCredential(t *testing.T) {
+	secret := func(name string, data map[string][]byte) *core.Secret {
+		return &core.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: name}, Data: data}
+	}
+	kubeClient := fake.SecretClient(t,
+		secret("azure-cred", map[string][]byte{"client-id": []byte("client"), "client-secret": []byte("secret")}),
+		secret("azure-client-id", map[string][]byte{"client-id": []byte("client")}),
+		secret("azure-no-client-id", map[string][]byte{"client-secret": []byte("secret")}),
+		secret("azure-tls", map[string][]byte{"client-cert": clientCertPEM(t)}),
+		secret("azure-no-cert", map[string][]byte{"tls.crt": []byte("cert")}),
+	)
+	ref := func(name string) *core.LocalObjectReference {
+		return &core.LocalObjectReference{Name: name}
+	}
+
+	tests := []struct {
+		name    string
+		spec    vaultapi.AzureKeyVault
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "managed identity takes precedence",
+			spec: vaultapi.AzureKeyVault{UseManagedIdentity: true, CredentialSecretRef: ref("azure-cred"), TLSSecretRef: ref("azure-tls")},
+			want: fmt.Sprintf("%T", &azidentity.ManagedIdentityCredential{}),
+		},
+		{
+			name: "client certificate over client secret",
+			spec: vaultapi.AzureKeyVault{CredentialSecretRef: ref("azure-cred"), TLSSecretRef: ref("azure-tls")},
+			want: fmt.Sprintf("%T", &azidentity.ClientCertificateCredential{}),
+		},
+		{
+			name: "client secret",
+			spec: vaultapi.AzureKeyVault{CredentialSecretRef: ref("azure-cred")},
+			want: fmt.Sprintf("%T", &azidentity.ClientSecretCredential{}),
+		},
+		{
+			name: "default credential chain",
+			spec: vaultapi.AzureKeyVault{CredentialSecretRef: ref("azure-client-id")},
+			want: fmt.Sprintf("%T", &azidentity.DefaultAzureCredential{}),
+		},
+		{
+			name:    "client secret without client-id",
+			spec:    vaultapi.AzureKeyVault{CredentialSecretRef: ref("azure-no-client-id")},
+			wantErr: true,
+		},
+		{
+			name:    "client certificate without client-id",
+			spec:    vaultapi.AzureKeyVault{TLSSecretRef: ref("azure-tls")},
+			wantErr: true,
+		},
+		{
+			name:    "tls secret without client-cert",
+			spec:    vaultapi.AzureKeyVault{CredentialSecretRef: ref("azure-cred"), TLSSecretRef: ref("azure-no-cert")},
+			wantErr: true,
+		},
+		{
+			name:    "missing credential secret",
+			spec:    vaultapi.AzureKeyVault{CredentialSecretRef: ref("azure-missing")},
+			wantErr: true,
+		},
+		{
+			name:    "unknown cloud",
+			spec:    vaultapi.AzureKeyVault{Cloud: "AzureGermanCloud", CredentialSecretRef: ref("azure-cred")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := tt.spec
+			spec.TenantID = "00000000-0000-0000-0000-000000000000"
+			vs := &vaultapi.VaultServer{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "vault"}}
+			vs.Spec.Unsealer = &vaultapi.UnsealerSpec{Mode: vaultapi.ModeSpec{AzureKeyVault: &spec}}
+
+			cred, err := newCredential(vs, kubeClient)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newCredential() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := fmt.Sprintf("%T", cred); got != tt.want {
+				t.Errorf("newCredential() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCloudConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    cloud.Configuration
+		wantErr bool
+	}{
+		{name: "", want: cloud.AzurePublic},
+		{name: "AZUREPUBLICCLOUD", want: cloud.AzurePublic},
+		{name: "AzureUSGovernment", want: cloud.AzureGovernment},
+		{name: "AZUREUSGOVERNMENTCLOUD", want: cloud.AzureGovernment},
+		{name: "AzureChina", want: cloud.AzureChina},
+		{name: "AzureGermanCloud", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cloudConfig(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("cloudConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.ActiveDirectoryAuthorityHost != tt.want.ActiveDirectoryAuthorityHost {
+				t.Errorf("cloudConfig() authority = %s, want %s", got.ActiveDirectoryAuthorityHost, tt.want.ActiveDirectoryAuthorityHost)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"kubevault.dev/cli/pkg/token-keys-store/api"
+
+	"github.com/pkg/errors"
+)
+
+// ErrWrite is returned by Set and Delete for the failing key.
+var ErrWrite = errors.New("write failed")
+
+// Store is an in-memory key store for tests. The key names are derived from KeyPrefix
+// and Shares like the names of the key stores from the unsealer key prefix and spec.
+type Store struct {
+	Values    map[string]string
+	KeyPrefix string
+	Shares    int
+
+	// Failing is the key that can't be set or deleted
+	Failing string
+	// GetErr is returned by every Get if set
+	GetErr error
+}
+
+var _ api.TokenKeyInterface = &Store{}
+
+// NewStore returns a Store with the given values, the key prefix vault and 5 shares.
+func NewStore(values map[string]string) *Store {
+	if values == nil {
+		values = map[string]string{}
+	}
+	return &Store{
+		Values:    values,
+		KeyPrefix: "vault",
+		Shares:    5,
+	}
+}
+
+func (s *Store) Get(_ context.Context, key string) (string, error) {
+	if s.GetErr != nil {
+		return "", s.GetErr
+	}
+	value, ok := s.Values[key]
+	if !ok {
+		return "", api.NewNotFoundError("%s not found", key)
+	}
+	return value, nil
+}
+
+func (s *Store) Set(_ context.Context, key, value string) error {
+	if key == s.Failing {
+		return ErrWrite
+	}
+	s.Values[key] = value
+	return nil
+}
+
+func (s *Store) Delete(_ context.Context, key string) error {
+	if key == s.Failing {
+		return ErrWrite
+	}
+	delete(s.Values, key)
+	return nil
+}
+
+func (s *Store) SetMany(ctx context.Context, values map[string]string) error {
+	return api.SetManyWithRollback(ctx, s, values)
+}
+
+func (s *Store) DeleteMany(ctx context.Context, keys []string) error {
+	return api.DeleteManyWithRollback(ctx, s, keys)
+}
+
+func (s *Store) List(_ context.Context, prefix string) ([]api.KeyInfo, error) {
+	var keys []api.KeyInfo
+	for key := range s.Values {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, api.KeyInfo{Name: key})
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Name < keys[j].Name
+	})
+	return keys, nil
+}
+
+func (s *Store) Clean() {
+}
+
+func (s *Store) NewTokenName(_ context.Context) string {
+	return fmt.Sprintf("%s-root-token", s.KeyPrefix)
+}
+
+func (s *Store) OldTokenName() string {
+	return api.OldTokenName
+}
+
+func (s *Store) NewUnsealKeyName(_ context.Context, id int) (string, error) {
+	if id >= s.Shares {
+		return "", errors.Errorf("unseal-key-%d not available, available id range 0 to %d", id, s.Shares-1)
+	}
+	return fmt.Sprintf("%s-unseal-key-%d", s.KeyPrefix, id), nil
+}
+
+func (s *Store) OldUnsealKeyName(id int) (string, error) {
+	if id >= s.Shares {
+		return "", errors.Errorf("unseal-key-%d not available, available id range 0 to %d", id, s.Shares-1)
+	}
+	return fmt.Sprintf("vault-unseal-key-%d", id), nil
+}
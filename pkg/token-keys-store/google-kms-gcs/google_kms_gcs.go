@@ -22,9 +22,6 @@ import (
 	"fmt"
 	"hash/crc32"
 	"io"
-	"os"
-	"path/filepath"
-	"strings"
 
 	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
 	"kubevault.dev/cli/pkg/token-keys-store/api"
@@ -33,8 +30,8 @@ import (
 	"cloud.google.com/go/kms/apiv1/kmspb"
 	"cloud.google.com/go/storage"
 	"github.com/pkg/errors"
-	passgen "gomodules.xyz/password-generator"
 	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -42,15 +39,16 @@ import (
 )
 
 const (
-	ServiceAccountJSON    = "sa.json"
-	GoogleApplicationCred = "GOOGLE_APPLICATION_CREDENTIALS"
+	ServiceAccountJSON = "sa.json"
 )
 
 type TokenKeyInfo struct {
 	storageClient *storage.Client
 	kubeClient    kubernetes.Interface
 	vs            *vaultapi.VaultServer
-	path          string
+	// clientOpts carries the service account credential of this key store, if any.
+	// Without it the google application default credentials are used.
+	clientOpts []option.ClientOption
 }
 
 var _ api.TokenKeyInterface = &TokenKeyInfo{}
@@ -68,7 +66,7 @@ func New(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) (*TokenKeyIn
 		return nil, errors.New("kubeClient is nil")
 	}
 
-	var path string
+	var clientOpts []option.ClientOption
 	if vs.Spec.Unsealer.Mode.GoogleKmsGcs.CredentialSecretRef != nil {
 		secret, err := kubeClient.CoreV1().Secrets(vs.Namespace).Get(context.TODO(), vs.Spec.Unsealer.Mode.GoogleKmsGcs.CredentialSecretRef.Name, metav1.GetOptions{})
 		if err != nil {
@@ -79,26 +77,10 @@ func New(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) (*TokenKeyIn
 			return nil, errors.Errorf("%s not found in secret", ServiceAccountJSON)
 		}
 
-		path = filepath.Join("/tmp", fmt.Sprintf("google-sa-cred-%s", passgen.Generate(6)))
-		if err = os.MkdirAll(path, os.ModePerm); err != nil {
-			return nil, err
-		}
-
-		saFile := filepath.Join(path, ServiceAccountJSON)
-		if err = os.WriteFile(saFile, secret.Data[ServiceAccountJSON], os.ModePerm); err != nil {
-			return nil, err
-		}
-
-		if err = os.Setenv(GoogleApplicationCred, saFile); err != nil {
-			return nil, err
-		}
-	} else {
-		if _, ok := os.LookupEnv(GoogleApplicationCred); !ok {
-			_, _ = fmt.Fprintf(os.Stderr, "WARNING!!! missing env variable %s", GoogleApplicationCred)
-		}
+		clientOpts = append(clientOpts, option.WithCredentialsJSON(secret.Data[ServiceAccountJSON]))
 	}
 
-	client, err := storage.NewClient(context.TODO())
+	client, err := storage.NewClient(context.TODO(), clientOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -107,13 +89,16 @@ func New(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) (*TokenKeyIn
 		storageClient: client,
 		kubeClient:    kubeClient,
 		vs:            vs,
-		path:          path,
+		clientOpts:    clientOpts,
 	}, nil
 }
 
-func (ti *TokenKeyInfo) Get(key string) (string, error) {
+func (ti *TokenKeyInfo) Get(ctx context.Context, key string) (string, error) {
 	googleKmsGcsSpec := ti.vs.Spec.Unsealer.Mode.GoogleKmsGcs
-	rc, err := ti.storageClient.Bucket(googleKmsGcsSpec.Bucket).Object(key).NewReader(context.TODO())
+	rc, err := ti.storageClient.Bucket(googleKmsGcsSpec.Bucket).Object(key).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return "", api.NewNotFoundError("%s not found in bucket %s", key, googleKmsGcsSpec.Bucket)
+	}
 	if err != nil {
 		return "", err
 	}
@@ -128,7 +113,7 @@ func (ti *TokenKeyInfo) Get(key string) (string, error) {
 		googleKmsGcsSpec.KmsProject, googleKmsGcsSpec.KmsLocation,
 		googleKmsGcsSpec.KmsKeyRing, googleKmsGcsSpec.KmsCryptoKey)
 
-	decryptedToken, err := decryptSymmetric(name, body)
+	decryptedToken, err := ti.decryptSymmetric(ctx, name, body)
 	if err != nil {
 		return "", err
 	}
@@ -136,21 +121,22 @@ func (ti *TokenKeyInfo) Get(key string) (string, error) {
 	return decryptedToken, nil
 }
 
-func (ti *TokenKeyInfo) Delete(key string) error {
+func (ti *TokenKeyInfo) Delete(ctx context.Context, key string) error {
 	bucket := ti.vs.Spec.Unsealer.Mode.GoogleKmsGcs.Bucket
 
 	o := ti.storageClient.Bucket(bucket).Object(key)
-	if err := o.Delete(context.TODO()); err != nil && err != storage.ErrObjectNotExist {
-		return errors.Errorf("failed to delete key %s with %s", key, err.Error())
+	if err := o.Delete(ctx); err != nil && err != storage.ErrObjectNotExist {
+		return errors.Wrapf(err, "failed to delete key %s", key)
 	}
 
 	return nil
 }
 
-func (ti *TokenKeyInfo) Set(key, value string) error {
-	kmsService, err := cloudkms.NewService(context.TODO(), option.WithScopes(cloudkms.CloudPlatformScope))
+func (ti *TokenKeyInfo) Set(ctx context.Context, key, value string) error {
+	opts := append([]option.ClientOption{option.WithScopes(cloudkms.CloudPlatformScope)}, ti.clientOpts...)
+	kmsService, err := cloudkms.NewService(ctx, opts...)
 	if err != nil {
-		return errors.Errorf("error creating google kms service client: %s", err.Error())
+		return errors.Wrap(err, "error creating google kms service client")
 	}
 
 	googleKmsGcsSpec := ti.vs.Spec.Unsealer.Mode.GoogleKmsGcs
@@ -161,9 +147,9 @@ func (ti *TokenKeyInfo) Set(key, value string) error {
 
 	resp, err := kmsService.Projects.Locations.KeyRings.CryptoKeys.Encrypt(name, &cloudkms.EncryptRequest{
 		Plaintext: base64.StdEncoding.EncodeToString([]byte(value)),
-	}).Do()
+	}).Context(ctx).Do()
 	if err != nil {
-		return errors.Errorf("error encrypting data: %s", err.Error())
+		return errors.Wrap(err, "error encrypting data")
 	}
 
 	cipherText, err := base64.StdEncoding.DecodeString(resp.Ciphertext)
@@ -173,16 +159,47 @@ func (ti *TokenKeyInfo) Set(key, value string) error {
 
 	bucket := ti.vs.Spec.Unsealer.Mode.GoogleKmsGcs.Bucket
 
-	w := ti.storageClient.Bucket(bucket).Object(key).NewWriter(context.TODO())
+	w := ti.storageClient.Bucket(bucket).Object(key).NewWriter(ctx)
 	if _, err := w.Write(cipherText); err != nil {
-		return fmt.Errorf("error writing key '%s' to gcs bucket '%s'", key, bucket)
+		return errors.Wrapf(err, "error writing key '%s' to gcs bucket '%s'", key, bucket)
 	}
 
 	return w.Close()
 }
 
-func decryptSymmetric(name string, ciphertext []byte) (string, error) {
-	client, err := kms.NewKeyManagementClient(context.TODO())
+// SetMany sets the keys one by one, restoring the previous values if a key fails.
+func (ti *TokenKeyInfo) SetMany(ctx context.Context, values map[string]string) error {
+	return api.SetManyWithRollback(ctx, ti, values)
+}
+
+// DeleteMany deletes the keys one by one, restoring the deleted keys if a key fails.
+func (ti *TokenKeyInfo) DeleteMany(ctx context.Context, keys []string) error {
+	return api.DeleteManyWithRollback(ctx, ti, keys)
+}
+
+func (ti *TokenKeyInfo) List(ctx context.Context, prefix string) ([]api.KeyInfo, error) {
+	bucket := ti.vs.Spec.Unsealer.Mode.GoogleKmsGcs.Bucket
+
+	var keys []api.KeyInfo
+	it := ti.storageClient.Bucket(bucket).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list keys of gcs bucket '%s'", bucket)
+		}
+		keys = append(keys, api.KeyInfo{
+			Name:         attrs.Name,
+			LastModified: attrs.Updated,
+		})
+	}
+	return keys, nil
+}
+
+func (ti *TokenKeyInfo) decryptSymmetric(ctx context.Context, name string, ciphertext []byte) (string, error) {
+	client, err := kms.NewKeyManagementClient(ctx, ti.clientOpts...)
 	if err != nil {
 		return "", errors.Errorf("failed to create kms client: %v", err)
 	}
@@ -200,9 +217,9 @@ func decryptSymmetric(name string, ciphertext []byte) (string, error) {
 		CiphertextCrc32C: wrapperspb.Int64(int64(ciphertextCRC32C)),
 	}
 
-	result, err := client.Decrypt(context.TODO(), req)
+	result, err := client.Decrypt(ctx, req)
 	if err != nil {
-		return "", errors.Errorf("failed to decrypt ciphertext with %s", err.Error())
+		return "", errors.Wrap(err, "failed to decrypt ciphertext")
 	}
 
 	if int64(crc32c(result.Plaintext)) != result.PlaintextCrc32C.Value {
@@ -212,65 +229,22 @@ func decryptSymmetric(name string, ciphertext []byte) (string, error) {
 	return string(result.Plaintext), nil
 }
 
-func (ti *TokenKeyInfo) NewTokenName() string {
-	sts, err := ti.kubeClient.AppsV1().StatefulSets(ti.vs.Namespace).Get(context.TODO(), ti.vs.Name, metav1.GetOptions{})
-	if err != nil {
-		return ""
-	}
-
-	var keyPrefix string
-	for _, cont := range sts.Spec.Template.Spec.Containers {
-		if cont.Name != vaultapi.VaultUnsealerContainerName {
-			continue
-		}
-		for _, arg := range cont.Args {
-			if strings.HasPrefix(arg, "--key-prefix=") {
-				keyPrefix = arg[1+strings.Index(arg, "="):]
-			}
-		}
-	}
-
-	return fmt.Sprintf("%s-root-token", keyPrefix)
+func (ti *TokenKeyInfo) NewTokenName(ctx context.Context) string {
+	return api.NewTokenName(ctx, ti.kubeClient, ti.vs)
 }
 
 func (ti *TokenKeyInfo) OldTokenName() string {
-	return "vault-root-token"
+	return api.OldTokenName
 }
 
-func (ti *TokenKeyInfo) NewUnsealKeyName(id int) (string, error) {
-	sts, err := ti.kubeClient.AppsV1().StatefulSets(ti.vs.Namespace).Get(context.TODO(), ti.vs.Name, metav1.GetOptions{})
-	if err != nil {
-		return "", err
-	}
-
-	if int64(id) >= ti.vs.Spec.Unsealer.SecretShares {
-		return "", errors.Errorf("unseal-key-%d not available, available id range 0 to %d", id, ti.vs.Spec.Unsealer.SecretShares-1)
-	}
-
-	var keyPrefix string
-	for _, cont := range sts.Spec.Template.Spec.Containers {
-		if cont.Name != vaultapi.VaultUnsealerContainerName {
-			continue
-		}
-		for _, arg := range cont.Args {
-			if strings.HasPrefix(arg, "--key-prefix=") {
-				keyPrefix = arg[1+strings.Index(arg, "="):]
-			}
-		}
-	}
-
-	return fmt.Sprintf("%s-unseal-key-%d", keyPrefix, id), nil
+func (ti *TokenKeyInfo) NewUnsealKeyName(ctx context.Context, id int) (string, error) {
+	return api.NewUnsealKeyName(ctx, ti.kubeClient, ti.vs, id)
 }
 
 func (ti *TokenKeyInfo) OldUnsealKeyName(id int) (string, error) {
-	if int64(id) >= ti.vs.Spec.Unsealer.SecretShares {
-		return "", errors.Errorf("unseal-key-%d not available, available id range 0 to %d", id, ti.vs.Spec.Unsealer.SecretShares-1)
-	}
-
-	return fmt.Sprintf("vault-unseal-key-%d", id), nil
+	return api.OldUnsealKeyName(ti.vs, id)
 }
 
 func (ti *TokenKeyInfo) Clean() {
-	_ = os.RemoveAll(ti.path)
-	_ = os.Unsetenv(GoogleApplicationCred)
+	_ = ti.storageClient.Close()
 }
@@ -0,0 +1,131 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package google_kms_gcs
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"reflect"
+	"slices"
+	"testing"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+	"kubevault.dev/cli/pkg/token-keys-store/fake"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// serviceAccountJSON returns the key file of a service account with a generated private key.
+func serviceAccountJSON(t *testing.T, email string) []byte {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "vault",
+		"private_key_id": "1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})),
+		"client_email":   email,
+		"client_id":      "1",
+		"token_uri":      "https://oauth2.googleapis.com/token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestNew(t *testing.T) {
+	// the credentials must neither be written to files nor to the environment
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+
+	secret := func(name string, data map[string][]byte) *core.Secret {
+		return &core.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: name}, Data: data}
+	}
+	saA := serviceAccountJSON(t, "a@vault.iam.gserviceaccount.com")
+	saB := serviceAccountJSON(t, "b@vault.iam.gserviceaccount.com")
+	kubeClient := fake.SecretClient(t,
+		secret("gcs-a", map[string][]byte{ServiceAccountJSON: saA}),
+		secret("gcs-b", map[string][]byte{ServiceAccountJSON: saB}),
+		secret("gcs-other", map[string][]byte{"key.json": saA}),
+	)
+	newVS := func(secretName string) *vaultapi.VaultServer {
+		vs := &vaultapi.VaultServer{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "vault"}}
+		vs.Spec.Unsealer = &vaultapi.UnsealerSpec{Mode: vaultapi.ModeSpec{GoogleKmsGcs: &vaultapi.GoogleKmsGcsSpec{
+			Bucket:              "vault-keys",
+			KmsProject:          "vault",
+			KmsLocation:         "global",
+			KmsKeyRing:          "vault",
+			KmsCryptoKey:        "unsealer",
+			CredentialSecretRef: &core.LocalObjectReference{Name: secretName},
+		}}}
+		return vs
+	}
+	environ := os.Environ()
+
+	tests := []struct {
+		name       string
+		secretName string
+		wantErr    bool
+	}{
+		{name: "service account a", secretName: "gcs-a"},
+		{name: "service account b", secretName: "gcs-b"},
+		{name: "secret without sa.json", secretName: "gcs-other", wantErr: true},
+		{name: "missing secret", secretName: "gcs-missing", wantErr: true},
+	}
+	var stores []*TokenKeyInfo
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ti, err := New(newVS(tt.secretName), kubeClient)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			t.Cleanup(ti.Clean)
+			if len(ti.clientOpts) != 1 {
+				t.Errorf("client options = %d, want the credential of the secret", len(ti.clientOpts))
+			}
+			stores = append(stores, ti)
+		})
+	}
+
+	// every store keeps the credential of its own vaultserver
+	if len(stores) == 2 && reflect.DeepEqual(stores[0].clientOpts, stores[1].clientOpts) {
+		t.Error("stores share the same credential")
+	}
+	if !slices.Equal(os.Environ(), environ) {
+		t.Error("New() changed the environment")
+	}
+	if entries, err := os.ReadDir(tmpDir); err != nil || len(entries) > 0 {
+		t.Errorf("New() wrote %d temporary files, err = %v", len(entries), err)
+	}
+}
@@ -18,7 +18,6 @@ package kubernetes_secret
 
 import (
 	"context"
-	"fmt"
 	"strings"
 
 	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
@@ -56,114 +55,81 @@ func New(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) (*TokenKeyIn
 	}, nil
 }
 
-func (ti *TokenKeyInfo) Get(key string) (string, error) {
+func (ti *TokenKeyInfo) Get(ctx context.Context, key string) (string, error) {
 	secretName := ti.vs.Spec.Unsealer.Mode.KubernetesSecret.SecretName
 	secretNamespace := ti.vs.Namespace
-	secret, err := ti.kubeClient.CoreV1().Secrets(secretNamespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+	secret, err := ti.kubeClient.CoreV1().Secrets(secretNamespace).Get(ctx, secretName, metav1.GetOptions{})
+	if errors2.IsNotFound(err) {
+		return "", api.NewNotFoundError("secret %s/%s not found", secretNamespace, secretName)
+	}
 	if err != nil {
 		return "", err
 	}
 
 	if _, ok := secret.Data[key]; !ok {
-		return "", errors.Errorf("%s not found in secret %s/%s", key, secretNamespace, secretName)
+		return "", api.NewNotFoundError("%s not found in secret %s/%s", key, secretNamespace, secretName)
 	}
 
 	return string(secret.Data[key]), nil
 }
 
-func (ti *TokenKeyInfo) Delete(key string) error {
-	secretName := ti.vs.Spec.Unsealer.Mode.KubernetesSecret.SecretName
-	secretNamespace := ti.vs.Namespace
-	secret, err := ti.kubeClient.CoreV1().Secrets(secretNamespace).Get(context.TODO(), secretName, metav1.GetOptions{})
-	if err != nil {
-		if errors2.IsNotFound(err) {
-			return nil
-		}
-		return err
-	}
+func (ti *TokenKeyInfo) Delete(ctx context.Context, key string) error {
+	return ti.DeleteMany(ctx, []string{key})
+}
 
-	if _, ok := secret.Data[key]; ok {
-		secret.Data[key] = nil
-		delete(secret.Data, key)
+func (ti *TokenKeyInfo) Set(ctx context.Context, key, value string) error {
+	return ti.SetMany(ctx, map[string]string{key: value})
+}
+
+// SetMany sets the keys with a single update of the secret, which is created if it does not exist.
+func (ti *TokenKeyInfo) SetMany(ctx context.Context, values map[string]string) error {
+	data := map[string][]byte{}
+	for key, value := range values {
+		data[key] = []byte(value)
 	}
+	return api.SetSecretData(ctx, ti.kubeClient, ti.vs.Namespace, ti.vs.Spec.Unsealer.Mode.KubernetesSecret.SecretName, data)
+}
 
-	_, err = ti.kubeClient.CoreV1().Secrets(secretNamespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
-	return err
+// DeleteMany deletes the keys with a single update of the secret.
+func (ti *TokenKeyInfo) DeleteMany(ctx context.Context, keys []string) error {
+	return api.DeleteSecretData(ctx, ti.kubeClient, ti.vs.Namespace, ti.vs.Spec.Unsealer.Mode.KubernetesSecret.SecretName, keys)
 }
 
-func (ti *TokenKeyInfo) Set(key, value string) error {
+// List lists the data keys of the secret, a secret does not record when its keys were modified.
+func (ti *TokenKeyInfo) List(ctx context.Context, prefix string) ([]api.KeyInfo, error) {
 	secretName := ti.vs.Spec.Unsealer.Mode.KubernetesSecret.SecretName
 	secretNamespace := ti.vs.Namespace
-	secret, err := ti.kubeClient.CoreV1().Secrets(secretNamespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+	secret, err := ti.kubeClient.CoreV1().Secrets(secretNamespace).Get(ctx, secretName, metav1.GetOptions{})
 	if err != nil {
 		if errors2.IsNotFound(err) {
-			return nil
+			return nil, nil
 		}
-		return err
+		return nil, err
 	}
 
-	secret.Data[key] = []byte(value)
-
-	_, err = ti.kubeClient.CoreV1().Secrets(secretNamespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
-	return err
-}
-
-func (ti *TokenKeyInfo) NewTokenName() string {
-	sts, err := ti.kubeClient.AppsV1().StatefulSets(ti.vs.Namespace).Get(context.TODO(), ti.vs.Name, metav1.GetOptions{})
-	if err != nil {
-		return ""
-	}
-
-	var keyPrefix string
-	for _, cont := range sts.Spec.Template.Spec.Containers {
-		if cont.Name != vaultapi.VaultUnsealerContainerName {
-			continue
-		}
-		for _, arg := range cont.Args {
-			if strings.HasPrefix(arg, "--key-prefix=") {
-				keyPrefix = arg[1+strings.Index(arg, "="):]
-			}
+	var keys []api.KeyInfo
+	for key := range secret.Data {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, api.KeyInfo{Name: key})
 		}
 	}
+	return keys, nil
+}
 
-	return fmt.Sprintf("%s-root-token", keyPrefix)
+func (ti *TokenKeyInfo) NewTokenName(ctx context.Context) string {
+	return api.NewTokenName(ctx, ti.kubeClient, ti.vs)
 }
 
 func (ti *TokenKeyInfo) OldTokenName() string {
-	return "vault-root-token"
+	return api.OldTokenName
 }
 
-func (ti *TokenKeyInfo) NewUnsealKeyName(id int) (string, error) {
-	sts, err := ti.kubeClient.AppsV1().StatefulSets(ti.vs.Namespace).Get(context.TODO(), ti.vs.Name, metav1.GetOptions{})
-	if err != nil {
-		return "", err
-	}
-
-	if int64(id) >= ti.vs.Spec.Unsealer.SecretShares {
-		return "", errors.Errorf("unseal-key-%d not available, available id range 0 to %d", id, ti.vs.Spec.Unsealer.SecretShares-1)
-	}
-
-	var keyPrefix string
-	for _, cont := range sts.Spec.Template.Spec.Containers {
-		if cont.Name != vaultapi.VaultUnsealerContainerName {
-			continue
-		}
-		for _, arg := range cont.Args {
-			if strings.HasPrefix(arg, "--key-prefix=") {
-				keyPrefix = arg[1+strings.Index(arg, "="):]
-			}
-		}
-	}
-
-	return fmt.Sprintf("%s-unseal-key-%d", keyPrefix, id), nil
+func (ti *TokenKeyInfo) NewUnsealKeyName(ctx context.Context, id int) (string, error) {
+	return api.NewUnsealKeyName(ctx, ti.kubeClient, ti.vs, id)
 }
 
 func (ti *TokenKeyInfo) OldUnsealKeyName(id int) (string, error) {
-	if int64(id) >= ti.vs.Spec.Unsealer.SecretShares {
-		return "", errors.Errorf("unseal-key-%d not available, available id range 0 to %d", id, ti.vs.Spec.Unsealer.SecretShares-1)
-	}
-
-	return fmt.Sprintf("vault-unseal-key-%d", id), nil
+	return api.OldUnsealKeyName(ti.vs, id)
 }
 
 func (ti *TokenKeyInfo) Clean() {
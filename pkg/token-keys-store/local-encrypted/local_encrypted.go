@@ -0,0 +1,539 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package local_encrypted
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+	"kubevault.dev/cli/pkg/token-keys-store/api"
+
+	"filippo.io/age"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/term"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// DataKeyName is the name under which the age encrypted data key is stored.
+	DataKeyName = ".data-key.age"
+
+	// PassphraseEnv is the environment variable read for the passphrase
+	// when neither ageIdentityFile nor passphraseFile is set.
+	PassphraseEnv = "KUBEVAULT_KEY_STORE_PASSPHRASE"
+)
+
+// Options configures the encrypted local key store. Exactly one of Directory or SecretName
+// and at most one of AgeIdentityFile or PassphraseFile must be set.
+type Options struct {
+	// Directory stores every key as a separate file in the local directory
+	Directory string `json:"directory,omitempty"`
+	// SecretName stores every key in the kubernetes secret in the namespace of the vaultserver
+	SecretName string `json:"secretName,omitempty"`
+	// AgeIdentityFile is an age identity file, as generated by age-keygen, used to encrypt the data key
+	AgeIdentityFile string `json:"ageIdentityFile,omitempty"`
+	// PassphraseFile contains the passphrase used to encrypt the data key with scrypt.
+	// If neither AgeIdentityFile nor PassphraseFile is set, the passphrase is read from
+	// the KUBEVAULT_KEY_STORE_PASSPHRASE environment variable or prompted for.
+	PassphraseFile string `json:"passphraseFile,omitempty"`
+}
+
+// TokenKeyInfo stores the unseal-keys and root-token using envelope encryption:
+// every value is sealed with a random data key, the data key itself is encrypted
+// with age, either to an age identity or with an scrypt passphrase, and stored
+// next to the values.
+type TokenKeyInfo struct {
+	kubeClient kubernetes.Interface
+	vs         *vaultapi.VaultServer
+	opts       Options
+
+	identities []age.Identity
+	recipients []age.Recipient
+	dataKey    []byte
+}
+
+var _ api.TokenKeyInterface = &TokenKeyInfo{}
+
+// passphrases caches the passphrase of every key store, so that it is prompted for
+// only once per command and not for every vaultserver.
+var (
+	passphrasesMu sync.Mutex
+	passphrases   = map[Options]string{}
+)
+
+func New(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface, opts *Options) (*TokenKeyInfo, error) {
+	if vs == nil {
+		return nil, errors.New("vs spec is empty")
+	}
+
+	if opts == nil {
+		return nil, errors.New("local-encrypted options is nil")
+	}
+
+	if kubeClient == nil {
+		return nil, errors.New("kubeClient is nil")
+	}
+
+	if (len(opts.Directory) == 0) == (len(opts.SecretName) == 0) {
+		return nil, errors.New("exactly one of directory or secretName must be set")
+	}
+
+	if len(opts.AgeIdentityFile) > 0 && len(opts.PassphraseFile) > 0 {
+		return nil, errors.New("ageIdentityFile and passphraseFile can't be used together")
+	}
+
+	ti := &TokenKeyInfo{
+		kubeClient: kubeClient,
+		vs:         vs,
+		opts:       *opts,
+	}
+
+	if err := ti.loadKeyEncryptionKey(); err != nil {
+		return nil, err
+	}
+
+	return ti, nil
+}
+
+// loadKeyEncryptionKey sets up the age identities and recipients used to decrypt and encrypt the data key.
+func (ti *TokenKeyInfo) loadKeyEncryptionKey() error {
+	if len(ti.opts.AgeIdentityFile) > 0 {
+		f, err := os.Open(ti.opts.AgeIdentityFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close() //nolint:errcheck
+
+		identities, err := age.ParseIdentities(f)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse age identity file %s", ti.opts.AgeIdentityFile)
+		}
+
+		for _, id := range identities {
+			x, ok := id.(*age.X25519Identity)
+			if !ok {
+				return errors.Errorf("unsupported age identity in %s", ti.opts.AgeIdentityFile)
+			}
+			ti.recipients = append(ti.recipients, x.Recipient())
+		}
+		ti.identities = identities
+		return nil
+	}
+
+	passphrase, err := ti.readPassphrase()
+	if err != nil {
+		return err
+	}
+	if len(passphrase) == 0 {
+		return errors.New("passphrase is empty")
+	}
+
+	r, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return err
+	}
+	id, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return err
+	}
+
+	ti.recipients = []age.Recipient{r}
+	ti.identities = []age.Identity{id}
+	return nil
+}
+
+func (ti *TokenKeyInfo) readPassphrase() (string, error) {
+	passphrasesMu.Lock()
+	defer passphrasesMu.Unlock()
+
+	if passphrase, ok := passphrases[ti.opts]; ok {
+		return passphrase, nil
+	}
+
+	passphrase, err := ti.promptPassphrase()
+	if err != nil {
+		return "", err
+	}
+	passphrases[ti.opts] = passphrase
+	return passphrase, nil
+}
+
+func (ti *TokenKeyInfo) promptPassphrase() (string, error) {
+	if len(ti.opts.PassphraseFile) > 0 {
+		data, err := os.ReadFile(ti.opts.PassphraseFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	if passphrase, ok := os.LookupEnv(PassphraseEnv); ok {
+		return passphrase, nil
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", errors.Errorf("no passphrase provided, set passphraseFile or %s", PassphraseEnv)
+	}
+
+	_, _ = fmt.Fprint(os.Stderr, "Enter key store passphrase: ")
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	_, _ = fmt.Fprintln(os.Stderr)
+	return string(passphrase), err
+}
+
+// getDataKey returns the decrypted data key. If create is true and
+// no data key exists yet, a new one is generated and stored.
+func (ti *TokenKeyInfo) getDataKey(ctx context.Context, create bool) ([]byte, error) {
+	if ti.dataKey != nil {
+		return ti.dataKey, nil
+	}
+
+	wrapped, found, err := ti.read(ctx, DataKeyName)
+	if err != nil {
+		return nil, err
+	}
+
+	if found {
+		r, err := age.Decrypt(bytes.NewReader(wrapped), ti.identities...)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decrypt data key")
+		}
+		key, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(key) != chacha20poly1305.KeySize {
+			return nil, errors.New("invalid data key")
+		}
+		ti.dataKey = key
+		return key, nil
+	}
+
+	if !create {
+		return nil, errors.New("data key not found")
+	}
+
+	// a new data key can't decrypt the stored values, so it is only created for an empty key store
+	stored, err := ti.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(stored) > 0 {
+		return nil, errors.Errorf("data key %s not found, but %d keys are stored that can't be decrypted without it", DataKeyName, len(stored))
+	}
+
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err = rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, ti.recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(key); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+
+	if err = ti.write(ctx, DataKeyName, buf.Bytes()); err != nil {
+		return nil, errors.Wrap(err, "failed to store data key")
+	}
+
+	ti.dataKey = key
+	return key, nil
+}
+
+func (ti *TokenKeyInfo) Get(ctx context.Context, key string) (string, error) {
+	data, found, err := ti.read(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", api.NewNotFoundError("%s not found", key)
+	}
+
+	dataKey, err := ti.getDataKey(ctx, false)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to decode %s", key)
+	}
+
+	aead, err := chacha20poly1305.NewX(dataKey)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.Errorf("%s is malformed", key)
+	}
+
+	// the key name is used as additional data, so values can't be swapped between keys
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	value, err := aead.Open(nil, nonce, ciphertext, []byte(key))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to decrypt %s", key)
+	}
+
+	return string(value), nil
+}
+
+func (ti *TokenKeyInfo) Set(ctx context.Context, key, value string) error {
+	data, err := ti.seal(ctx, key, value)
+	if err != nil {
+		return err
+	}
+	return ti.write(ctx, key, data)
+}
+
+func (ti *TokenKeyInfo) Delete(ctx context.Context, key string) error {
+	if key == DataKeyName {
+		return errors.Errorf("%s is reserved", key)
+	}
+
+	if len(ti.opts.Directory) > 0 {
+		path, err := ti.keyPath(key)
+		if err != nil {
+			return err
+		}
+		err = os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return api.DeleteSecretData(ctx, ti.kubeClient, ti.vs.Namespace, ti.opts.SecretName, []string{key})
+}
+
+// SetMany stores the keys with a single update of the secret, or writes the
+// files one by one restoring the previous files if a file fails.
+func (ti *TokenKeyInfo) SetMany(ctx context.Context, values map[string]string) error {
+	if len(ti.opts.Directory) > 0 {
+		return api.SetManyWithRollback(ctx, ti, values)
+	}
+
+	data := map[string][]byte{}
+	for key, value := range values {
+		sealed, err := ti.seal(ctx, key, value)
+		if err != nil {
+			return err
+		}
+		data[key] = sealed
+	}
+	return api.SetSecretData(ctx, ti.kubeClient, ti.vs.Namespace, ti.opts.SecretName, data)
+}
+
+// DeleteMany deletes the keys with a single update of the secret, or removes the
+// files one by one restoring the removed files if a file fails.
+func (ti *TokenKeyInfo) DeleteMany(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		if key == DataKeyName {
+			return errors.Errorf("%s is reserved", key)
+		}
+	}
+
+	if len(ti.opts.Directory) > 0 {
+		return api.DeleteManyWithRollback(ctx, ti, keys)
+	}
+	return api.DeleteSecretData(ctx, ti.kubeClient, ti.vs.Namespace, ti.opts.SecretName, keys)
+}
+
+// seal encrypts the value with the data key, using the key name as additional data.
+func (ti *TokenKeyInfo) seal(ctx context.Context, key, value string) ([]byte, error) {
+	if key == DataKeyName {
+		return nil, errors.Errorf("%s is reserved", key)
+	}
+
+	dataKey, err := ti.getDataKey(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := chacha20poly1305.NewX(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(key))
+
+	return []byte(base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// List lists the stored keys except the wrapped data key. Only the directory records
+// the modification time of the keys.
+func (ti *TokenKeyInfo) List(ctx context.Context, prefix string) ([]api.KeyInfo, error) {
+	var keys []api.KeyInfo
+	if len(ti.opts.Directory) > 0 {
+		entries, err := os.ReadDir(ti.opts.Directory)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		for _, entry := range entries {
+			// hidden files are the data key and temporary files of interrupted writes
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || !strings.HasPrefix(entry.Name(), prefix) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, api.KeyInfo{Name: entry.Name(), LastModified: info.ModTime()})
+		}
+		return keys, nil
+	}
+
+	secret, err := ti.kubeClient.CoreV1().Secrets(ti.vs.Namespace).Get(ctx, ti.opts.SecretName, metav1.GetOptions{})
+	if err != nil {
+		if errors2.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for key := range secret.Data {
+		if key != DataKeyName && strings.HasPrefix(key, prefix) {
+			keys = append(keys, api.KeyInfo{Name: key})
+		}
+	}
+	return keys, nil
+}
+
+// read returns the raw stored value of the key and whether it exists.
+func (ti *TokenKeyInfo) read(ctx context.Context, key string) ([]byte, bool, error) {
+	if len(ti.opts.Directory) > 0 {
+		path, err := ti.keyPath(key)
+		if err != nil {
+			return nil, false, err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, false, nil
+			}
+			return nil, false, err
+		}
+		return data, true, nil
+	}
+
+	secret, err := ti.kubeClient.CoreV1().Secrets(ti.vs.Namespace).Get(ctx, ti.opts.SecretName, metav1.GetOptions{})
+	if err != nil {
+		if errors2.IsNotFound(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	data, ok := secret.Data[key]
+	return data, ok, nil
+}
+
+// write stores the raw value of the key, creating the directory or secret if required.
+func (ti *TokenKeyInfo) write(ctx context.Context, key string, data []byte) error {
+	if len(ti.opts.Directory) > 0 {
+		path, err := ti.keyPath(key)
+		if err != nil {
+			return err
+		}
+		if err = os.MkdirAll(ti.opts.Directory, 0o700); err != nil {
+			return err
+		}
+		return writeFileAtomic(path, data)
+	}
+	return api.SetSecretData(ctx, ti.kubeClient, ti.vs.Namespace, ti.opts.SecretName, map[string][]byte{key: data})
+}
+
+// keyPath returns the path of the file of the key. Key names may come from flags,
+// so names that would refer to a file outside the directory are rejected.
+func (ti *TokenKeyInfo) keyPath(key string) (string, error) {
+	if len(key) == 0 || strings.ContainsAny(key, `/\`) || strings.Contains(key, "..") {
+		return "", errors.Errorf("invalid key name %q, it must not be empty or contain path separators or ..", key)
+	}
+	if strings.HasPrefix(key, ".") && key != DataKeyName {
+		return "", errors.Errorf("invalid key name %q, hidden files are reserved", key)
+	}
+	return filepath.Join(ti.opts.Directory, key), nil
+}
+
+// writeFileAtomic writes the data to a temporary file in the same directory and renames it,
+// so that the file either keeps its previous content or has the new one.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) //nolint:errcheck
+
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (ti *TokenKeyInfo) NewTokenName(ctx context.Context) string {
+	return api.NewTokenName(ctx, ti.kubeClient, ti.vs)
+}
+
+func (ti *TokenKeyInfo) OldTokenName() string {
+	return api.OldTokenName
+}
+
+func (ti *TokenKeyInfo) NewUnsealKeyName(ctx context.Context, id int) (string, error) {
+	return api.NewUnsealKeyName(ctx, ti.kubeClient, ti.vs, id)
+}
+
+func (ti *TokenKeyInfo) OldUnsealKeyName(id int) (string, error) {
+	return api.OldUnsealKeyName(ti.vs, id)
+}
+
+func (ti *TokenKeyInfo) Clean() {
+	for i := range ti.dataKey {
+		ti.dataKey[i] = 0
+	}
+	ti.dataKey = nil
+}
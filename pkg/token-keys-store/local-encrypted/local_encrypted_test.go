@@ -0,0 +1,214 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package local_encrypted
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+	"kubevault.dev/cli/pkg/token-keys-store/api"
+
+	"filippo.io/age"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// newTestStore returns a directory key store in dir with the passphrase in a file.
+func newTestStore(t *testing.T, dir, passphrase string) (*TokenKeyInfo, error) {
+	t.Helper()
+
+	passphraseFile := filepath.Join(t.TempDir(), "passphrase")
+	if err := os.WriteFile(passphraseFile, []byte(passphrase+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// the directory store doesn't use the kubernetes api
+	kubeClient, err := kubernetes.NewForConfig(&rest.Config{Host: "http://127.0.0.1:1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs := &vaultapi.VaultServer{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "vault"}}
+	return New(vs, kubeClient, &Options{Directory: dir, PassphraseFile: passphraseFile})
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "keys")
+
+	ti, err := newTestStore(t, dir, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ti.SetMany(ctx, map[string]string{"vault-unseal-key-0": "key0", "vault-root-token": "token"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = ti.Set(ctx, "vault-unseal-key-1", "key1"); err != nil {
+		t.Fatal(err)
+	}
+	ti.Clean()
+
+	// a new store decrypts the data key again
+	ti, err = newTestStore(t, dir, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"vault-unseal-key-0": "key0", "vault-unseal-key-1": "key1", "vault-root-token": "token"} {
+		got, err := ti.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get(%s) error = %v", key, err)
+		}
+		if got != want {
+			t.Errorf("Get(%s) = %q, want %q", key, got, want)
+		}
+	}
+
+	keys, err := ti.List(ctx, "vault-unseal-key-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Errorf("List() = %v, want 2 unseal-keys", keys)
+	}
+
+	if err = ti.DeleteMany(ctx, []string{"vault-unseal-key-0", "vault-unseal-key-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ti.Get(ctx, "vault-unseal-key-0"); !api.IsNotFound(err) {
+		t.Errorf("Get() of a deleted key error = %v, want not found", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != DataKeyName && entry.Name() != "vault-root-token" {
+			t.Errorf("unexpected file %s left in the key store", entry.Name())
+		}
+	}
+}
+
+func TestWrongPassphrase(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	ti, err := newTestStore(t, dir, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ti.Set(ctx, "vault-root-token", "token"); err != nil {
+		t.Fatal(err)
+	}
+
+	ti, err = newTestStore(t, dir, "wrong horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ti.Get(ctx, "vault-root-token"); err == nil {
+		t.Fatal("Get() with a wrong passphrase succeeded")
+	}
+	// the data key must not be replaced, as it would make the stored values unreadable
+	if err = ti.Set(ctx, "vault-unseal-key-0", "key0"); err == nil {
+		t.Fatal("Set() with a wrong passphrase succeeded")
+	}
+}
+
+func TestMissingDataKey(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	ti, err := newTestStore(t, dir, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ti.Set(ctx, "vault-root-token", "token"); err != nil {
+		t.Fatal(err)
+	}
+	ti.Clean()
+	if err = os.Remove(filepath.Join(dir, DataKeyName)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ti.Set(ctx, "vault-unseal-key-0", "key0"); err == nil {
+		t.Fatal("Set() created a new data key although values are stored")
+	}
+	if _, err = os.Stat(filepath.Join(dir, DataKeyName)); !os.IsNotExist(err) {
+		t.Errorf("Set() stored a new data key, error = %v", err)
+	}
+}
+
+func TestKeyPath(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "keys")
+
+	ti, err := newTestStore(t, dir, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"../vault-root-token", "keys/vault-root-token", "..", "", ".hidden", `..\vault-root-token`} {
+		if err = ti.Set(ctx, key, "token"); err == nil {
+			t.Errorf("Set(%q) succeeded", key)
+		}
+		if _, err = ti.Get(ctx, key); err == nil || api.IsNotFound(err) {
+			t.Errorf("Get(%q) error = %v, want invalid key name", key, err)
+		}
+		if err = ti.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q) succeeded", key)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(filepath.Dir(dir), "vault-root-token")); !os.IsNotExist(err) {
+		t.Errorf("a key was written outside the directory, error = %v", err)
+	}
+}
+
+func TestAgeIdentity(t *testing.T) {
+	ctx := context.Background()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityFile := filepath.Join(t.TempDir(), "identity.txt")
+	if err = os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	kubeClient, err := kubernetes.NewForConfig(&rest.Config{Host: "http://127.0.0.1:1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs := &vaultapi.VaultServer{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "vault"}}
+	opts := &Options{Directory: t.TempDir(), AgeIdentityFile: identityFile}
+
+	ti, err := New(vs, kubeClient, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ti.Set(ctx, "vault-root-token", "token"); err != nil {
+		t.Fatal(err)
+	}
+
+	ti, err = New(vs, kubeClient, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ti.Get(ctx, "vault-root-token"); err != nil || got != "token" {
+		t.Errorf("Get() = %q, %v, want %q", got, err, "token")
+	}
+}
@@ -0,0 +1,220 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token_keys_store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"kubevault.dev/cli/pkg/token-keys-store/api"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	vaultclient "github.com/hashicorp/vault/api"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// requestTimeout, if non-zero, limits every single key store call
+var requestTimeout time.Duration
+
+// SetRequestTimeout sets the timeout of every single key store call, zero means no timeout.
+func SetRequestTimeout(d time.Duration) {
+	requestTimeout = d
+}
+
+// defaultBackoff is used to retry key store calls that failed with a retryable error
+var defaultBackoff = wait.Backoff{
+	Duration: 500 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    5,
+	Cap:      10 * time.Second,
+}
+
+// retryingStore applies the request timeout to every call of the wrapped key store
+// and retries the calls that failed with a retryable error using exponential backoff.
+type retryingStore struct {
+	api.TokenKeyInterface
+	timeout time.Duration
+	backoff wait.Backoff
+}
+
+var _ api.TokenKeyInterface = &retryingStore{}
+
+func newRetryingStore(ti api.TokenKeyInterface) api.TokenKeyInterface {
+	return &retryingStore{
+		TokenKeyInterface: ti,
+		timeout:           requestTimeout,
+		backoff:           defaultBackoff,
+	}
+}
+
+func (s *retryingStore) Get(ctx context.Context, key string) (string, error) {
+	var value string
+	err := s.retry(ctx, func(ctx context.Context) error {
+		var err error
+		value, err = s.TokenKeyInterface.Get(ctx, key)
+		return err
+	})
+	return value, err
+}
+
+func (s *retryingStore) Set(ctx context.Context, key, value string) error {
+	return s.retry(ctx, func(ctx context.Context) error {
+		return s.TokenKeyInterface.Set(ctx, key, value)
+	})
+}
+
+func (s *retryingStore) Delete(ctx context.Context, key string) error {
+	return s.retry(ctx, func(ctx context.Context) error {
+		return s.TokenKeyInterface.Delete(ctx, key)
+	})
+}
+
+func (s *retryingStore) SetMany(ctx context.Context, values map[string]string) error {
+	return s.retry(ctx, func(ctx context.Context) error {
+		return s.TokenKeyInterface.SetMany(ctx, values)
+	})
+}
+
+func (s *retryingStore) DeleteMany(ctx context.Context, keys []string) error {
+	return s.retry(ctx, func(ctx context.Context) error {
+		return s.TokenKeyInterface.DeleteMany(ctx, keys)
+	})
+}
+
+func (s *retryingStore) List(ctx context.Context, prefix string) ([]api.KeyInfo, error) {
+	var keys []api.KeyInfo
+	err := s.retry(ctx, func(ctx context.Context) error {
+		var err error
+		keys, err = s.TokenKeyInterface.List(ctx, prefix)
+		return err
+	})
+	return keys, err
+}
+
+func (s *retryingStore) NewTokenName(ctx context.Context) string {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.TokenKeyInterface.NewTokenName(ctx)
+}
+
+func (s *retryingStore) NewUnsealKeyName(ctx context.Context, id int) (string, error) {
+	var name string
+	err := s.retry(ctx, func(ctx context.Context) error {
+		var err error
+		name, err = s.TokenKeyInterface.NewUnsealKeyName(ctx, id)
+		return err
+	})
+	return name, err
+}
+
+func (s *retryingStore) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.timeout > 0 {
+		return context.WithTimeout(ctx, s.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// retry calls fn until it succeeds, fails with an error that is not retryable,
+// the backoff steps are exhausted or ctx is done.
+func (s *retryingStore) retry(ctx context.Context, fn func(ctx context.Context) error) error {
+	backoff := s.backoff
+	for {
+		attemptCtx, cancel := s.withTimeout(ctx)
+		err := fn(attemptCtx)
+		cancel()
+
+		if err == nil || ctx.Err() != nil || !isRetryable(err) || backoff.Steps <= 1 {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff.Step()):
+		}
+	}
+}
+
+// isRetryable reports whether err is a transient error of the cloud provider,
+// vault or kubernetes api, e.g. throttling, a server side failure or a timeout.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	// aws, the sdk retries unknown errors, so only its own errors are checked
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		return request.IsErrorRetryable(awsErr) || request.IsErrorThrottle(awsErr)
+	}
+
+	// google cloud storage and kms rest api
+	var gErr *googleapi.Error
+	if errors.As(err, &gErr) {
+		return isRetryableStatusCode(gErr.Code)
+	}
+
+	// google cloud kms grpc api
+	if st, ok := status.FromError(err); ok {
+		switch st.Code() {
+		case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded, codes.Aborted:
+			return true
+		}
+	}
+
+	// azure key vault
+	var azErr *azcore.ResponseError
+	if errors.As(err, &azErr) {
+		return isRetryableStatusCode(azErr.StatusCode)
+	}
+
+	// vault transit
+	var vaultErr *vaultclient.ResponseError
+	if errors.As(err, &vaultErr) {
+		return isRetryableStatusCode(vaultErr.StatusCode)
+	}
+
+	// kubernetes secret
+	return kerr.IsServerTimeout(err) || kerr.IsTimeout(err) || kerr.IsTooManyRequests(err) ||
+		kerr.IsInternalError(err) || kerr.IsServiceUnavailable(err)
+}
+
+func isRetryableStatusCode(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
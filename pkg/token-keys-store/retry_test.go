@@ -0,0 +1,158 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package token_keys_store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"kubevault.dev/cli/pkg/token-keys-store/api"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	vaultclient "github.com/hashicorp/vault/api"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestIsRetryable(t *testing.T) {
+	secrets := schema.GroupResource{Resource: "secrets"}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "canceled", err: fmt.Errorf("get: %w", context.Canceled), want: false},
+		{name: "deadline exceeded", err: fmt.Errorf("get: %w", context.DeadlineExceeded), want: true},
+		{name: "unexpected eof", err: io.ErrUnexpectedEOF, want: true},
+		{name: "connection reset", err: fmt.Errorf("read: %w", syscall.ECONNRESET), want: true},
+		{name: "aws throttling", err: awserr.New("ThrottlingException", "rate exceeded", nil), want: true},
+		{name: "aws access denied", err: awserr.New("AccessDeniedException", "denied", nil), want: false},
+		{name: "google unavailable", err: &googleapi.Error{Code: http.StatusServiceUnavailable}, want: true},
+		{name: "google not found", err: &googleapi.Error{Code: http.StatusNotFound}, want: false},
+		{name: "grpc unavailable", err: status.Error(codes.Unavailable, "unavailable"), want: true},
+		{name: "grpc permission denied", err: status.Error(codes.PermissionDenied, "denied"), want: false},
+		{name: "azure throttling", err: &azcore.ResponseError{StatusCode: http.StatusTooManyRequests}, want: true},
+		{name: "azure forbidden", err: &azcore.ResponseError{StatusCode: http.StatusForbidden}, want: false},
+		{name: "vault bad gateway", err: &vaultclient.ResponseError{StatusCode: http.StatusBadGateway}, want: true},
+		{name: "vault bad request", err: &vaultclient.ResponseError{StatusCode: http.StatusBadRequest}, want: false},
+		{name: "kubernetes too many requests", err: kerr.NewTooManyRequests("slow down", 1), want: true},
+		{name: "kubernetes not found", err: kerr.NewNotFound(secrets, "vault-keys"), want: false},
+		{name: "key store not found", err: api.NewNotFoundError("%s not found", "vault-root-token"), want: false},
+		{name: "other", err: errors.New("invalid key"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeStore returns the errors of its Get calls in order and records whether they had a deadline.
+type fakeStore struct {
+	api.TokenKeyInterface
+	errs      []error
+	calls     int
+	deadlines int
+}
+
+func (s *fakeStore) Get(ctx context.Context, key string) (string, error) {
+	if _, ok := ctx.Deadline(); ok {
+		s.deadlines++
+	}
+	s.calls++
+	if s.calls <= len(s.errs) {
+		return "", s.errs[s.calls-1]
+	}
+	return "value", nil
+}
+
+func TestRetryingStore(t *testing.T) {
+	retryable := &vaultclient.ResponseError{StatusCode: http.StatusServiceUnavailable}
+	permanent := errors.New("invalid key")
+	tests := []struct {
+		name      string
+		errs      []error
+		steps     int
+		timeout   time.Duration
+		wantErr   error
+		wantCalls int
+	}{
+		{name: "success", steps: 3, wantCalls: 1},
+		{name: "retried until success", errs: []error{retryable, retryable}, steps: 3, wantCalls: 3},
+		{name: "steps exhausted", errs: []error{retryable, retryable, retryable}, steps: 3, wantErr: retryable, wantCalls: 3},
+		{name: "not retryable", errs: []error{permanent}, steps: 3, wantErr: permanent, wantCalls: 1},
+		{name: "request timeout", errs: []error{retryable}, steps: 3, timeout: time.Minute, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeStore{errs: tt.errs}
+			s := &retryingStore{
+				TokenKeyInterface: fake,
+				timeout:           tt.timeout,
+				backoff:           wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: tt.steps},
+			}
+
+			value, err := s.Get(context.Background(), "vault-root-token")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Get() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && value != "value" {
+				t.Errorf("Get() = %q, want %q", value, "value")
+			}
+			if fake.calls != tt.wantCalls {
+				t.Errorf("Get() called the key store %d times, want %d", fake.calls, tt.wantCalls)
+			}
+			wantDeadlines := 0
+			if tt.timeout > 0 {
+				wantDeadlines = tt.wantCalls
+			}
+			if fake.deadlines != wantDeadlines {
+				t.Errorf("%d of %d calls had a deadline, want %d", fake.deadlines, fake.calls, wantDeadlines)
+			}
+		})
+	}
+}
+
+func TestRetryingStoreCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	fake := &fakeStore{errs: []error{context.Canceled}}
+	s := &retryingStore{
+		TokenKeyInterface: fake,
+		backoff:           wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3},
+	}
+	if _, err := s.Get(ctx, "vault-root-token"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Get() error = %v, want %v", err, context.Canceled)
+	}
+	if fake.calls != 1 {
+		t.Errorf("Get() called the key store %d times after ctx was done, want 1", fake.calls)
+	}
+}
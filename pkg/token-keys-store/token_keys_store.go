@@ -17,7 +17,7 @@ limitations under the License.
 package token_keys_store
 
 import (
-	"errors"
+	"os"
 
 	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
 	"kubevault.dev/cli/pkg/token-keys-store/api"
@@ -25,14 +25,77 @@ import (
 	azure_key_vault "kubevault.dev/cli/pkg/token-keys-store/azure-key-vault"
 	google_kms_gcs "kubevault.dev/cli/pkg/token-keys-store/google-kms-gcs"
 	kubernetes_secret "kubevault.dev/cli/pkg/token-keys-store/kubernetes-secret"
+	local_encrypted "kubevault.dev/cli/pkg/token-keys-store/local-encrypted"
+	vault_transit "kubevault.dev/cli/pkg/token-keys-store/vault-transit"
 
+	"github.com/pkg/errors"
 	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
 )
 
+// StoreConfig selects a key store that is not part of the VaultServer unsealer modes.
+// At most one store must be set.
+type StoreConfig struct {
+	LocalEncrypted *local_encrypted.Options `json:"localEncrypted,omitempty"`
+	VaultTransit   *vault_transit.Options   `json:"vaultTransit,omitempty"`
+}
+
+// ReadStoreConfig reads a yaml/json key store config file.
+func ReadStoreConfig(file string) (*StoreConfig, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg StoreConfig
+	if err = yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse key store config %s", file)
+	}
+
+	var stores int
+	if cfg.LocalEncrypted != nil {
+		stores++
+	}
+	if cfg.VaultTransit != nil {
+		stores++
+	}
+	if stores != 1 {
+		return nil, errors.Errorf("key store config %s must contain exactly one key store, found %d", file, stores)
+	}
+
+	return &cfg, nil
+}
+
+// NewTokenKeyInterface returns the key store of the VaultServer unsealer mode.
 func NewTokenKeyInterface(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface) (api.TokenKeyInterface, error) {
+	return NewTokenKeyInterfaceForConfig(vs, kubeClient, nil)
+}
+
+// NewTokenKeyInterfaceForConfig returns the key store described by cfg,
+// or the key store of the VaultServer unsealer mode if cfg is nil.
+// Every call of the key store is limited by the request timeout and retried on transient errors.
+func NewTokenKeyInterfaceForConfig(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface, cfg *StoreConfig) (api.TokenKeyInterface, error) {
+	ti, err := newTokenKeyInterface(vs, kubeClient, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRetryingStore(ti), nil
+}
+
+func newTokenKeyInterface(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface, cfg *StoreConfig) (api.TokenKeyInterface, error) {
 	if vs.Spec.Unsealer == nil {
 		return nil, errors.New("vaultServer unsealer spec is empty")
 	}
+	if cfg != nil {
+		switch true {
+		case cfg.LocalEncrypted != nil:
+			return local_encrypted.New(vs, kubeClient, cfg.LocalEncrypted)
+		case cfg.VaultTransit != nil:
+			return vault_transit.New(vs, kubeClient, cfg.VaultTransit)
+		}
+	}
+
 	mode := vs.Spec.Unsealer.Mode
 
 	switch true {
@@ -0,0 +1,366 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vault_transit
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path"
+	"strings"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+	"kubevault.dev/cli/pkg/token-keys-store/api"
+
+	vaultclient "github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	authv1 "k8s.io/api/authentication/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	defaultTransitMount    = "transit"
+	defaultKubernetesMount = "kubernetes"
+)
+
+// Options configures a key store that encrypts every value with a Transit key
+// of another vault and stores the ciphertext in a kubernetes secret.
+type Options struct {
+	// Address of the vault that hosts the transit key, e.g. https://bootstrap-vault:8200
+	Address string `json:"address"`
+	// CACertFile is the PEM encoded CA bundle used to verify the vault server certificate
+	CACertFile string `json:"caCertFile,omitempty"`
+	// TLSServerName is the server name used to verify the vault server certificate
+	TLSServerName string `json:"tlsServerName,omitempty"`
+	// Mount is the path of the transit secret engine, defaults to transit
+	Mount string `json:"mount,omitempty"`
+	// KeyName is the name of the transit key. It must be created with derived=true, every value is
+	// encrypted with the vaultserver and key name as context, so that stored values can't be swapped.
+	// The vault token needs read access to the key, to verify that.
+	KeyName string `json:"keyName"`
+	// SecretName is the kubernetes secret, in the namespace of the vaultserver, that stores the ciphertext
+	SecretName string `json:"secretName"`
+	// Auth is used to log in to the vault that hosts the transit key
+	Auth AuthOptions `json:"auth"`
+}
+
+// AuthOptions contains exactly one of the supported auth methods.
+// If none is set, the token is read from the VAULT_TOKEN environment variable.
+type AuthOptions struct {
+	// Token is a vault token
+	Token string `json:"token,omitempty"`
+	// TokenFile contains a vault token
+	TokenFile string `json:"tokenFile,omitempty"`
+	// Kubernetes logs in using the vault kubernetes auth method
+	Kubernetes *KubernetesAuth `json:"kubernetes,omitempty"`
+}
+
+// KubernetesAuth logs in with a service account token, read either from JWTFile
+// or requested for ServiceAccountName in the namespace of the vaultserver.
+type KubernetesAuth struct {
+	// Mount is the path of the kubernetes auth method, defaults to kubernetes
+	Mount              string `json:"mount,omitempty"`
+	Role               string `json:"role"`
+	JWTFile            string `json:"jwtFile,omitempty"`
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+}
+
+type TokenKeyInfo struct {
+	kubeClient  kubernetes.Interface
+	vs          *vaultapi.VaultServer
+	opts        Options
+	vaultClient *vaultclient.Client
+	// loggedIn is true if the vault token was issued by a login of this store
+	loggedIn bool
+}
+
+var _ api.TokenKeyInterface = &TokenKeyInfo{}
+
+func New(vs *vaultapi.VaultServer, kubeClient kubernetes.Interface, opts *Options) (*TokenKeyInfo, error) {
+	if vs == nil {
+		return nil, errors.New("vs spec is empty")
+	}
+
+	if opts == nil {
+		return nil, errors.New("vault-transit options is nil")
+	}
+
+	if kubeClient == nil {
+		return nil, errors.New("kubeClient is nil")
+	}
+
+	if len(opts.Address) == 0 || len(opts.KeyName) == 0 || len(opts.SecretName) == 0 {
+		return nil, errors.New("address, keyName and secretName are required")
+	}
+
+	ti := &TokenKeyInfo{
+		kubeClient: kubeClient,
+		vs:         vs,
+		opts:       *opts,
+	}
+	if len(ti.opts.Mount) == 0 {
+		ti.opts.Mount = defaultTransitMount
+	}
+
+	ctx := context.TODO()
+	if err := ti.login(ctx); err != nil {
+		return nil, err
+	}
+	if err := ti.checkDerivedKey(ctx); err != nil {
+		return nil, err
+	}
+
+	return ti, nil
+}
+
+// login creates the vault client and sets its token from the configured auth method.
+func (ti *TokenKeyInfo) login(ctx context.Context) error {
+	cfg := vaultclient.DefaultConfig()
+	cfg.Address = ti.opts.Address
+	if len(ti.opts.CACertFile) > 0 || len(ti.opts.TLSServerName) > 0 {
+		if err := cfg.ConfigureTLS(&vaultclient.TLSConfig{
+			CACert:        ti.opts.CACertFile,
+			TLSServerName: ti.opts.TLSServerName,
+		}); err != nil {
+			return err
+		}
+	}
+
+	client, err := vaultclient.NewClient(cfg)
+	if err != nil {
+		return err
+	}
+	ti.vaultClient = client
+
+	auth := ti.opts.Auth
+	switch {
+	case len(auth.Token) > 0:
+		client.SetToken(auth.Token)
+	case len(auth.TokenFile) > 0:
+		data, err := os.ReadFile(auth.TokenFile)
+		if err != nil {
+			return err
+		}
+		client.SetToken(strings.TrimSpace(string(data)))
+	case auth.Kubernetes != nil:
+		return ti.kubernetesLogin(ctx, auth.Kubernetes)
+	}
+
+	if len(client.Token()) == 0 {
+		return errors.New("no vault token found, set auth.token, auth.tokenFile, auth.kubernetes or VAULT_TOKEN")
+	}
+	return nil
+}
+
+func (ti *TokenKeyInfo) kubernetesLogin(ctx context.Context, auth *KubernetesAuth) error {
+	if len(auth.Role) == 0 {
+		return errors.New("kubernetes auth role is required")
+	}
+
+	var jwt string
+	switch {
+	case len(auth.JWTFile) > 0:
+		data, err := os.ReadFile(auth.JWTFile)
+		if err != nil {
+			return err
+		}
+		jwt = strings.TrimSpace(string(data))
+	case len(auth.ServiceAccountName) > 0:
+		tr, err := ti.kubeClient.CoreV1().ServiceAccounts(ti.vs.Namespace).CreateToken(ctx, auth.ServiceAccountName, &authv1.TokenRequest{}, metav1.CreateOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "failed to create token for service account %s/%s", ti.vs.Namespace, auth.ServiceAccountName)
+		}
+		jwt = tr.Status.Token
+	default:
+		return errors.New("either kubernetes auth jwtFile or serviceAccountName is required")
+	}
+
+	mount := auth.Mount
+	if len(mount) == 0 {
+		mount = defaultKubernetesMount
+	}
+
+	secret, err := ti.vaultClient.Logical().WriteWithContext(ctx, path.Join("auth", mount, "login"), map[string]any{
+		"role": auth.Role,
+		"jwt":  jwt,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to log in to vault using kubernetes auth")
+	}
+	if secret == nil || secret.Auth == nil {
+		return errors.New("vault kubernetes auth login returned no token")
+	}
+
+	ti.vaultClient.SetToken(secret.Auth.ClientToken)
+	ti.loggedIn = true
+	return nil
+}
+
+// keyContext returns the transit context of the key. The transit key derives a separate
+// encryption key for every context, so a ciphertext only decrypts under the key it was stored as.
+func (ti *TokenKeyInfo) keyContext(key string) string {
+	return base64.StdEncoding.EncodeToString([]byte(path.Join(ti.vs.Namespace, ti.vs.Name, key)))
+}
+
+// checkDerivedKey ensures that the transit key derives its encryption keys from the context,
+// a key without derivation ignores the context.
+func (ti *TokenKeyInfo) checkDerivedKey(ctx context.Context) error {
+	secret, err := ti.vaultClient.Logical().ReadWithContext(ctx, path.Join(ti.opts.Mount, "keys", ti.opts.KeyName))
+	if err != nil {
+		return errors.Wrapf(err, "failed to read transit key %s", ti.opts.KeyName)
+	}
+	if secret == nil {
+		return errors.Errorf("transit key %s not found", ti.opts.KeyName)
+	}
+	if derived, _ := secret.Data["derived"].(bool); !derived {
+		return errors.Errorf("transit key %s must be created with derived=true", ti.opts.KeyName)
+	}
+	return nil
+}
+
+func (ti *TokenKeyInfo) encrypt(ctx context.Context, key, value string) (string, error) {
+	secret, err := ti.vaultClient.Logical().WriteWithContext(ctx, path.Join(ti.opts.Mount, "encrypt", ti.opts.KeyName), map[string]any{
+		"plaintext": base64.StdEncoding.EncodeToString([]byte(value)),
+		"context":   ti.keyContext(key),
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to encrypt using transit key %s", ti.opts.KeyName)
+	}
+	if secret == nil {
+		return "", errors.New("transit encrypt returned no data")
+	}
+
+	ciphertext, ok := secret.Data["ciphertext"].(string)
+	if !ok {
+		return "", errors.New("transit encrypt returned no ciphertext")
+	}
+	return ciphertext, nil
+}
+
+func (ti *TokenKeyInfo) decrypt(ctx context.Context, key, ciphertext string) (string, error) {
+	secret, err := ti.vaultClient.Logical().WriteWithContext(ctx, path.Join(ti.opts.Mount, "decrypt", ti.opts.KeyName), map[string]any{
+		"ciphertext": ciphertext,
+		"context":    ti.keyContext(key),
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to decrypt using transit key %s", ti.opts.KeyName)
+	}
+	if secret == nil {
+		return "", errors.New("transit decrypt returned no data")
+	}
+
+	plaintext, ok := secret.Data["plaintext"].(string)
+	if !ok {
+		return "", errors.New("transit decrypt returned no plaintext")
+	}
+
+	value, err := base64.StdEncoding.DecodeString(plaintext)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+func (ti *TokenKeyInfo) Get(ctx context.Context, key string) (string, error) {
+	secretName := ti.opts.SecretName
+	secretNamespace := ti.vs.Namespace
+	secret, err := ti.kubeClient.CoreV1().Secrets(secretNamespace).Get(ctx, secretName, metav1.GetOptions{})
+	if errors2.IsNotFound(err) {
+		return "", api.NewNotFoundError("secret %s/%s not found", secretNamespace, secretName)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := secret.Data[key]; !ok {
+		return "", api.NewNotFoundError("%s not found in secret %s/%s", key, secretNamespace, secretName)
+	}
+
+	return ti.decrypt(ctx, key, string(secret.Data[key]))
+}
+
+func (ti *TokenKeyInfo) Set(ctx context.Context, key, value string) error {
+	return ti.SetMany(ctx, map[string]string{key: value})
+}
+
+func (ti *TokenKeyInfo) Delete(ctx context.Context, key string) error {
+	return ti.DeleteMany(ctx, []string{key})
+}
+
+// SetMany encrypts the values and stores the ciphertexts with a single update of the secret,
+// which is created if it does not exist.
+func (ti *TokenKeyInfo) SetMany(ctx context.Context, values map[string]string) error {
+	ciphertexts := map[string][]byte{}
+	for key, value := range values {
+		ciphertext, err := ti.encrypt(ctx, key, value)
+		if err != nil {
+			return err
+		}
+		ciphertexts[key] = []byte(ciphertext)
+	}
+	return api.SetSecretData(ctx, ti.kubeClient, ti.vs.Namespace, ti.opts.SecretName, ciphertexts)
+}
+
+// DeleteMany deletes the keys with a single update of the secret.
+func (ti *TokenKeyInfo) DeleteMany(ctx context.Context, keys []string) error {
+	return api.DeleteSecretData(ctx, ti.kubeClient, ti.vs.Namespace, ti.opts.SecretName, keys)
+}
+
+// List lists the data keys of the secret holding the ciphertexts, a secret does not
+// record when its keys were modified.
+func (ti *TokenKeyInfo) List(ctx context.Context, prefix string) ([]api.KeyInfo, error) {
+	secret, err := ti.kubeClient.CoreV1().Secrets(ti.vs.Namespace).Get(ctx, ti.opts.SecretName, metav1.GetOptions{})
+	if err != nil {
+		if errors2.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var keys []api.KeyInfo
+	for key := range secret.Data {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, api.KeyInfo{Name: key})
+		}
+	}
+	return keys, nil
+}
+
+func (ti *TokenKeyInfo) NewTokenName(ctx context.Context) string {
+	return api.NewTokenName(ctx, ti.kubeClient, ti.vs)
+}
+
+func (ti *TokenKeyInfo) OldTokenName() string {
+	return api.OldTokenName
+}
+
+func (ti *TokenKeyInfo) NewUnsealKeyName(ctx context.Context, id int) (string, error) {
+	return api.NewUnsealKeyName(ctx, ti.kubeClient, ti.vs, id)
+}
+
+func (ti *TokenKeyInfo) OldUnsealKeyName(id int) (string, error) {
+	return api.OldUnsealKeyName(ti.vs, id)
+}
+
+func (ti *TokenKeyInfo) Clean() {
+	if ti.loggedIn {
+		_ = ti.vaultClient.Auth().Token().RevokeSelfWithContext(context.Background(), "")
+		ti.loggedIn = false
+	}
+}
@@ -0,0 +1,315 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vault_transit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	vaultapi "kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+	"kubevault.dev/cli/pkg/token-keys-store/api"
+
+	authv1 "k8s.io/api/authentication/v1"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	testKeyName    = "unsealer"
+	testSecretName = "vault-keys"
+	testToken      = "hvs.configuredtoken"
+	testJWT        = "service-account-jwt"
+	testLoginToken = "hvs.kubernetesLogintoken"
+)
+
+// fakeTransit is a vault that serves a transit key, the kubernetes auth login and
+// revoke-self. The ciphertext is the plaintext and the context in the clear, a
+// decryption with another context fails like it does for a derived key.
+type fakeTransit struct {
+	mu      sync.Mutex
+	derived bool
+	noKey   bool
+	revoked []string
+}
+
+func (f *fakeTransit) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	token := r.Header.Get("X-Vault-Token")
+	var req map[string]string
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	reply := func(data map[string]any) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(data)
+	}
+	fail := func(code int) {
+		w.WriteHeader(code)
+		_, _ = w.Write([]byte(`{"errors":["fake transit error"]}`))
+	}
+
+	if r.URL.Path == "/v1/auth/kubernetes/login" {
+		if req["role"] != "unsealer" || req["jwt"] != testJWT {
+			fail(http.StatusForbidden)
+			return
+		}
+		reply(map[string]any{"auth": map[string]any{"client_token": testLoginToken}})
+		return
+	}
+	if token != testToken && token != testLoginToken {
+		fail(http.StatusForbidden)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v1/auth/token/revoke-self":
+		f.revoked = append(f.revoked, token)
+		w.WriteHeader(http.StatusNoContent)
+	case "/v1/transit/keys/" + testKeyName:
+		if f.noKey {
+			fail(http.StatusNotFound)
+			return
+		}
+		reply(map[string]any{"data": map[string]any{"derived": f.derived}})
+	case "/v1/transit/encrypt/" + testKeyName:
+		reply(map[string]any{"data": map[string]any{
+			"ciphertext": "vault:v1:" + req["context"] + ":" + req["plaintext"],
+		}})
+	case "/v1/transit/decrypt/" + testKeyName:
+		ctxt, plaintext, _ := strings.Cut(strings.TrimPrefix(req["ciphertext"], "vault:v1:"), ":")
+		if ctxt != req["context"] {
+			fail(http.StatusBadRequest)
+			return
+		}
+		reply(map[string]any{"data": map[string]any{"plaintext": plaintext}})
+	default:
+		fail(http.StatusNotFound)
+	}
+}
+
+// fakeKube serves the secrets of one namespace and service account token requests.
+type fakeKube struct {
+	mu      sync.Mutex
+	secrets map[string]*core.Secret
+}
+
+func (f *fakeKube) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if strings.HasSuffix(r.URL.Path, "/token") {
+		_ = json.NewEncoder(w).Encode(&authv1.TokenRequest{Status: authv1.TokenRequestStatus{Token: testJWT}})
+		return
+	}
+
+	name := path.Base(r.URL.Path)
+	switch r.Method {
+	case http.MethodPost, http.MethodPut:
+		var secret core.Secret
+		_ = json.NewDecoder(r.Body).Decode(&secret)
+		f.secrets[secret.Name] = &secret
+		_ = json.NewEncoder(w).Encode(&secret)
+		return
+	case http.MethodGet:
+		if secret, ok := f.secrets[name]; ok {
+			_ = json.NewEncoder(w).Encode(secret)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNotFound)
+	_ = json.NewEncoder(w).Encode(kerr.NewNotFound(schema.GroupResource{Resource: "secrets"}, name).ErrStatus)
+}
+
+func newTestServers(t *testing.T, transit *fakeTransit) (string, *fakeKube, kubernetes.Interface) {
+	t.Helper()
+	t.Setenv("VAULT_TOKEN", "")
+
+	vaultSrv := httptest.NewServer(transit)
+	t.Cleanup(vaultSrv.Close)
+
+	kube := &fakeKube{secrets: map[string]*core.Secret{}}
+	kubeSrv := httptest.NewServer(kube)
+	t.Cleanup(kubeSrv.Close)
+
+	// the fake decodes the secrets it stores as json
+	kubeClient, err := kubernetes.NewForConfig(&rest.Config{
+		Host:          kubeSrv.URL,
+		ContentConfig: rest.ContentConfig{ContentType: "application/json"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vaultSrv.URL, kube, kubeClient
+}
+
+func testVaultServer() *vaultapi.VaultServer {
+	return &vaultapi.VaultServer{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "vault"}}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		transit  *fakeTransit
+		auth     AuthOptions
+		wantErr  bool
+		loggedIn bool
+	}{
+		{
+			name:    "token",
+			transit: &fakeTransit{derived: true},
+			auth:    AuthOptions{Token: testToken},
+		},
+		{
+			name:     "kubernetes auth with a service account",
+			transit:  &fakeTransit{derived: true},
+			auth:     AuthOptions{Kubernetes: &KubernetesAuth{Role: "unsealer", ServiceAccountName: "unsealer"}},
+			loggedIn: true,
+		},
+		{
+			name:    "kubernetes auth with a wrong role",
+			transit: &fakeTransit{derived: true},
+			auth:    AuthOptions{Kubernetes: &KubernetesAuth{Role: "other", ServiceAccountName: "unsealer"}},
+			wantErr: true,
+		},
+		{
+			name:    "kubernetes auth without a jwt",
+			transit: &fakeTransit{derived: true},
+			auth:    AuthOptions{Kubernetes: &KubernetesAuth{Role: "unsealer"}},
+			wantErr: true,
+		},
+		{
+			name:    "no token",
+			transit: &fakeTransit{derived: true},
+			wantErr: true,
+		},
+		{
+			name:    "wrong token",
+			transit: &fakeTransit{derived: true},
+			auth:    AuthOptions{Token: "hvs.wrong"},
+			wantErr: true,
+		},
+		{
+			name:    "key without derivation",
+			transit: &fakeTransit{},
+			auth:    AuthOptions{Token: testToken},
+			wantErr: true,
+		},
+		{
+			name:    "missing key",
+			transit: &fakeTransit{derived: true, noKey: true},
+			auth:    AuthOptions{Token: testToken},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, _, kubeClient := newTestServers(t, tt.transit)
+			ti, err := New(testVaultServer(), kubeClient, &Options{
+				Address:    addr,
+				KeyName:    testKeyName,
+				SecretName: testSecretName,
+				Auth:       tt.auth,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if ti.loggedIn != tt.loggedIn {
+				t.Errorf("loggedIn = %v, want %v", ti.loggedIn, tt.loggedIn)
+			}
+
+			// only a token issued by the login of the store is revoked
+			ti.Clean()
+			var want []string
+			if tt.loggedIn {
+				want = []string{testLoginToken}
+			}
+			if strings.Join(tt.transit.revoked, ",") != strings.Join(want, ",") {
+				t.Errorf("revoked tokens = %v, want %v", tt.transit.revoked, want)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	addr, kube, kubeClient := newTestServers(t, &fakeTransit{derived: true})
+	ti, err := New(testVaultServer(), kubeClient, &Options{
+		Address:    addr,
+		KeyName:    testKeyName,
+		SecretName: testSecretName,
+		Auth:       AuthOptions{Token: testToken},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := t.Context()
+
+	values := map[string]string{
+		"vault-root-token":   "hvs.root",
+		"vault-unseal-key-0": "share-0",
+	}
+	if err := ti.SetMany(ctx, values); err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range values {
+		got, err := ti.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get(%s) error = %v", key, err)
+		}
+		if got != value {
+			t.Errorf("Get(%s) = %q, want %q", key, got, value)
+		}
+		stored := string(kube.secrets[testSecretName].Data[key])
+		if !strings.HasPrefix(stored, "vault:v1:") || strings.Contains(stored, value) {
+			t.Errorf("stored value of %s = %q, want the transit ciphertext", key, stored)
+		}
+	}
+
+	keys, err := ti.List(ctx, "vault-unseal-key-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].Name != "vault-unseal-key-0" {
+		t.Errorf("List() = %v, want [vault-unseal-key-0]", keys)
+	}
+
+	// a ciphertext only decrypts under the name it was stored as
+	data := kube.secrets[testSecretName].Data
+	data["vault-root-token"], data["vault-unseal-key-0"] = data["vault-unseal-key-0"], data["vault-root-token"]
+	if _, err := ti.Get(ctx, "vault-root-token"); err == nil {
+		t.Error("Get() of a swapped ciphertext succeeded, want an error")
+	}
+
+	if err := ti.Delete(ctx, "vault-root-token"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ti.Get(ctx, "vault-root-token"); !api.IsNotFound(err) {
+		t.Errorf("Get() of a deleted key error = %v, want not found", err)
+	}
+}
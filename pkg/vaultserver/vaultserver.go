@@ -0,0 +1,75 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package vaultserver reads VaultServers of every served api version as the hub version v1alpha2.
+package vaultserver
+
+import (
+	"context"
+
+	"kubevault.dev/apimachinery/apis/kubevault/v1alpha1"
+	"kubevault.dev/apimachinery/apis/kubevault/v1alpha2"
+	vaultcs "kubevault.dev/apimachinery/client/clientset/versioned/typed/kubevault/v1alpha2"
+
+	"github.com/pkg/errors"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ToHub returns the object converted to the hub version if it is a VaultServer of an older
+// api version. Any other object is returned unchanged.
+func ToHub(obj runtime.Object) (runtime.Object, error) {
+	old, ok := obj.(*v1alpha1.VaultServer)
+	if !ok {
+		return obj, nil
+	}
+
+	vs := &v1alpha2.VaultServer{}
+	if err := old.ConvertTo(vs); err != nil {
+		return nil, err
+	}
+	return vs, nil
+}
+
+// Get returns the VaultServer as the hub version. A cluster that only serves the
+// older api version answers not found to the hub version, the VaultServer is read
+// with the older api version then.
+func Get(ctx context.Context, c vaultcs.KubevaultV1alpha2Interface, namespace, name string) (*v1alpha2.VaultServer, error) {
+	vs, err := c.VaultServers(namespace).Get(ctx, name, metav1.GetOptions{})
+	if !kerr.IsNotFound(err) {
+		return vs, err
+	}
+
+	old := &v1alpha1.VaultServer{}
+	err2 := c.RESTClient().Get().
+		AbsPath("/apis", v1alpha1.SchemeGroupVersion.Group, v1alpha1.SchemeGroupVersion.Version).
+		Namespace(namespace).
+		Resource(v1alpha1.ResourceVaultServers).
+		Name(name).
+		Do(ctx).
+		Into(old)
+	if err2 != nil {
+		// the error of the hub version is more helpful if neither version has the VaultServer
+		return nil, err
+	}
+
+	obj, err := ToHub(old)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to convert vaultserver %s/%s", namespace, name)
+	}
+	return obj.(*v1alpha2.VaultServer), nil
+}